@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/shrtyk/greenlight/internal/blob"
 	"github.com/shrtyk/greenlight/internal/data"
 	"github.com/shrtyk/greenlight/internal/mailer"
 	"github.com/shrtyk/greenlight/internal/testutils/assertions"
@@ -387,7 +389,7 @@ func TestApi(t *testing.T) {
 				Title:   "Moana",
 				Year:    2016,
 				Runtime: 107,
-				Genres:  []string{"animation, adventure"},
+				Genres:  []string{"animation", "adventure"},
 			},
 			want: envelope{
 				"movie": data.Movie{
@@ -395,7 +397,7 @@ func TestApi(t *testing.T) {
 					Title:   "Moana",
 					Year:    2016,
 					Runtime: 107,
-					Genres:  []string{"animation, adventure"},
+					Genres:  []string{"animation", "adventure"},
 					Version: 1,
 				},
 			},
@@ -412,12 +414,23 @@ func TestApi(t *testing.T) {
 					Title:   "Moana",
 					Year:    2016,
 					Runtime: 107,
-					Genres:  []string{"animation, adventure"},
+					Genres:  []string{"animation", "adventure"},
 					Version: 1,
 				},
 			},
 			code: http.StatusOK,
 		},
+		{
+			name:   "get unmodified movie",
+			method: http.MethodGet,
+			path:   "/v1/movies/1",
+			headers: map[string][]string{
+				"Authorization": bobHeader["Authorization"],
+				"If-None-Match": {`"1-1"`},
+			},
+			want: nil,
+			code: http.StatusNotModified,
+		},
 		{
 			name:    "get movie as non active user",
 			method:  http.MethodGet,
@@ -529,6 +542,33 @@ func TestApi(t *testing.T) {
 			want:    envelope{"error": "the requested resource could not be found"},
 			code:    http.StatusNotFound,
 		},
+		{
+			name:   "update movie with stale etag",
+			method: http.MethodPatch,
+			path:   "/v1/movies/2",
+			headers: map[string][]string{
+				"Authorization": bobHeader["Authorization"],
+				"If-Match":      {`"2-0"`},
+			},
+			body: getMovieUpdateBody("Black Panther", 2018, 134, nil),
+			want: envelope{
+				"error": "the resource has been modified since it was last fetched, fetch it again and retry",
+			},
+			code: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "delete movie with stale etag",
+			method: http.MethodDelete,
+			path:   "/v1/movies/4",
+			headers: map[string][]string{
+				"Authorization": bobHeader["Authorization"],
+				"If-Match":      {`"4-2"`, `W/"4-1"`},
+			},
+			want: envelope{
+				"error": "the resource has been modified since it was last fetched, fetch it again and retry",
+			},
+			code: http.StatusPreconditionFailed,
+		},
 		{
 			name:    "update movie",
 			method:  http.MethodPatch,
@@ -621,6 +661,130 @@ func TestApi(t *testing.T) {
 			},
 			code: http.StatusOK,
 		},
+		{
+			name:    "search movies by relevance with highlight",
+			method:  http.MethodGet,
+			path:    "/v1/movies?title=breakf&sort=relevance&highlight=true",
+			headers: bobHeader,
+			want: envelope{
+				"metadata": data.Metadata{
+					CurrentPage:  1,
+					PageSize:     20,
+					FirstPage:    1,
+					LastPage:     1,
+					TotalRecords: 1,
+				},
+				"movies": []data.Movie{
+					{
+						ID:        4,
+						Title:     "The Breakfast Club",
+						Year:      1986,
+						Runtime:   96,
+						Genres:    []string{"drama"},
+						Version:   1,
+						Highlight: "The <mark>Breakfast</mark> Club",
+					},
+				},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "get movies with facets",
+			method:  http.MethodGet,
+			path:    "/v1/movies?genres=action&page_size=1&facets=genres,decade",
+			headers: bobHeader,
+			want: envelope{
+				"facets": data.Facets{
+					"decade": {{Value: "2010s", Count: 1}},
+					"genres": {
+						{Value: "action", Count: 1},
+						{Value: "adventure", Count: 1},
+						{Value: "sci-fi", Count: 1},
+					},
+				},
+				"metadata": data.Metadata{
+					CurrentPage:  1,
+					PageSize:     1,
+					FirstPage:    1,
+					LastPage:     1,
+					TotalRecords: 1,
+				},
+				"movies": []data.Movie{
+					{
+						ID:      2,
+						Title:   "Black Panther",
+						Year:    2018,
+						Runtime: 134,
+						Genres:  []string{"sci-fi", "action", "adventure"},
+						Version: 2,
+					},
+				},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "get movies with unknown facet",
+			method:  http.MethodGet,
+			path:    "/v1/movies?facets=genres,studio",
+			headers: bobHeader,
+			want:    envelope{"error": map[string]string{"facets": "must only contain genres, decade, runtime_bucket"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "get movies with invalid ranges",
+			method:  http.MethodGet,
+			path:    "/v1/movies?year_min=2000&year_max=1990&runtime_min=-1&created_after=2024-01-01",
+			headers: bobHeader,
+			want: envelope{"error": map[string]string{
+				"year_max":      "must not be less than year_min",
+				"runtime_min":   "must be a positive integer",
+				"created_after": "must be an RFC 3339 timestamp",
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "sort by relevance without title",
+			method:  http.MethodGet,
+			path:    "/v1/movies?sort=relevance&cursor=",
+			headers: bobHeader,
+			want: envelope{"error": map[string]string{
+				"title":  "must be provided to sort by relevance",
+				"cursor": "must not be used with relevance sort",
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "update movie with current etag",
+			method: http.MethodPatch,
+			path:   "/v1/movies/4",
+			headers: map[string][]string{
+				"Authorization": bobHeader["Authorization"],
+				"If-Match":      {`"4-1"`},
+			},
+			body: getMovieUpdateBody("", 1985, 0, nil),
+			want: envelope{
+				"movie": data.Movie{
+					ID:      4,
+					Title:   "The Breakfast Club",
+					Year:    1985,
+					Runtime: 96,
+					Genres:  []string{"drama"},
+					Version: 2,
+				},
+			},
+			code: http.StatusCreated,
+		},
+		{
+			name:   "delete movie with current etag",
+			method: http.MethodDelete,
+			path:   "/v1/movies/4",
+			headers: map[string][]string{
+				"Authorization": bobHeader["Authorization"],
+				"If-Match":      {`"4-2"`},
+			},
+			want: envelope{"message:": "movie successfully deleted"},
+			code: http.StatusOK,
+		},
 	}
 
 	for _, c := range movieCases {
@@ -633,6 +797,80 @@ func TestApi(t *testing.T) {
 
 			server.ServeHTTP(rw, req)
 
+			// Responses without body (e.g. 304 Not Modified) are described by nil envelope
+			want := []byte{}
+			if c.want != nil {
+				want, err = io.ReadAll(helpers.MustJSON(t, c.want))
+				assertions.AssertNoError(t, err)
+			}
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
+
+func TestGetMoviesByIDs(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	reader := newActivatedUser(t, app, "alice@example.com", data.MoviesRead)
+
+	var movies []*data.Movie
+	for _, title := range []string{"Moana", "Heat", "Alien"} {
+		movie := &data.Movie{Title: title, Year: 2000, Runtime: 100, Genres: data.Genres{"drama"}}
+		assertions.AssertNoError(t, app.models.Movies.Insert(movie, 0))
+		movies = append(movies, movie)
+	}
+	assertions.AssertNoError(t, app.models.Movies.Delete(movies[1], 0))
+
+	cases := []struct {
+		name string
+		path string
+		want envelope
+		code int
+	}{
+		{
+			name: "get movies in requested order",
+			path: "/v1/movies?ids=3,99,1,2",
+			want: envelope{"missing": []int64{99, 2}, "movies": []*data.Movie{movies[2], movies[0]}},
+			code: http.StatusOK,
+		},
+		{
+			name: "get movies with fields",
+			path: "/v1/movies?ids=1&fields=title",
+			want: envelope{"missing": []int64{}, "movies": []envelope{{"title": "Moana"}}},
+			code: http.StatusOK,
+		},
+		{
+			name: "get movies with malformed ids",
+			path: "/v1/movies?ids=1,two",
+			want: envelope{"error": map[string]string{"ids": "must contain comma separated positive integers"}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "get movies with duplicate ids",
+			path: "/v1/movies?ids=1,1",
+			want: envelope{"error": map[string]string{"ids": "must not contain duplicate ids"}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "get movies with pagination",
+			path: "/v1/movies?ids=1&page=2",
+			want: envelope{"error": map[string]string{"page": "must not be used along with ids"}},
+			code: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, reader)
+
+			server.ServeHTTP(rw, req)
+
 			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
 			assertions.AssertNoError(t, err)
 
@@ -673,3 +911,40 @@ func getMovieUpdateBody(title string, year int32, runtime data.Runtime, genres [
 	}
 	return body
 }
+
+// newTestApplication returns application backed by in-memory models
+func newTestApplication(t testing.TB) *application {
+	t.Helper()
+
+	return newApplication(
+		withConfig(config{env: "development"}),
+		withLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		withModels(data.NewMockModels()),
+		withRateLimiter(NewMockLimiter(false)),
+		withMailer(mailer.NewMockMailer(&[]mailer.MailData{})),
+		withVersion("test"),
+		withBlobStore(blob.NewFileStore(t.TempDir())),
+		withWebhookClient(newWebhookClient(5*time.Second)),
+	)
+}
+
+// newActivatedUser registers activated user with given permissions and returns
+// headers authenticating requests on behalf of that user.
+func newActivatedUser(t testing.TB, app *application, email string, permissions ...string) map[string][]string {
+	t.Helper()
+
+	user := &data.User{Name: email, Email: email, Activated: true}
+	assertions.AssertNoError(t, user.Password.Set("pa55word"))
+	assertions.AssertNoError(t, app.models.Users.Insert(user))
+
+	if len(permissions) > 0 {
+		assertions.AssertNoError(t, app.models.Permissions.AddForUser(user.ID, permissions...))
+	}
+
+	token, err := app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	assertions.AssertNoError(t, err)
+
+	return map[string][]string{
+		"Authorization": {"Bearer " + token.Plaintext},
+	}
+}
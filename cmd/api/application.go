@@ -7,12 +7,14 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/shrtyk/greenlight/internal/blob"
 	"github.com/shrtyk/greenlight/internal/data"
 	"github.com/shrtyk/greenlight/internal/mailer"
 )
@@ -25,14 +27,27 @@ type application struct {
 	models  data.Models
 	limiter RateLimiter
 	mailer  mailer.MailWriter
+	blobs   blob.BlobStore
+	// shutdown is closed when the server starts shutting down, so that
+	// long-lived responses like event streams can end
+	shutdown chan struct{}
+	// webhookClient sends webhook deliveries and webhookWake wakes up the
+	// dispatcher when new deliveries are queued or a sender is done.
+	// webhookSenders holds a value per delivery being sent.
+	webhookClient  *http.Client
+	webhookWake    chan struct{}
+	webhookSenders chan struct{}
 }
 
 type config struct {
-	port    int
-	env     string
-	db      dbConfig
-	limiter rateLimiterCfg
-	smtp    struct {
+	port        int
+	env         string
+	db          dbConfig
+	limiter     rateLimiterCfg
+	trash       trashCfg
+	idempotency idempotencyCfg
+	webhooks    webhookCfg
+	smtp        struct {
 		host     string
 		port     int
 		username string
@@ -42,12 +57,22 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	requireIfMatch bool
+	storage        struct {
+		backend string
+		dir     string
+		s3      blob.S3Config
+	}
 }
 
 type option func(*application)
 
 func newApplication(opts ...option) *application {
-	app := new(application)
+	app := &application{
+		shutdown:       make(chan struct{}),
+		webhookWake:    make(chan struct{}, 1),
+		webhookSenders: make(chan struct{}, maxWebhookSenders),
+	}
 
 	for _, opt := range opts {
 		opt(app)
@@ -92,6 +117,30 @@ func withMailer(mailer mailer.MailWriter) option {
 	}
 }
 
+func withBlobStore(store blob.BlobStore) option {
+	return func(app *application) {
+		app.blobs = store
+	}
+}
+
+func withWebhookClient(client *http.Client) option {
+	return func(app *application) {
+		app.webhookClient = client
+	}
+}
+
+// newBlobStore returns blob store of the configured storage backend
+func newBlobStore(cfg config) (blob.BlobStore, error) {
+	switch cfg.storage.backend {
+	case "fs":
+		return blob.NewFileStore(cfg.storage.dir), nil
+	case "s3":
+		return blob.NewS3Store(cfg.storage.s3), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
+
 func openPostgresDB(cfg config) (*sql.DB, error) {
 	if cfg.env == "development" {
 		cfg.db.host = "localhost"
@@ -146,12 +195,46 @@ func (cfg *config) initFlags() {
 		"Frequency of rebuilding limiter cache to prevent map memory leak",
 	)
 
+	flag.DurationVar(
+		&cfg.trash.retention,
+		"trash-retention",
+		30*24*time.Hour,
+		"Time deleted movies are kept in the trash before purging (0 disables purging)",
+	)
+	flag.DurationVar(&cfg.trash.purgeFreq, "trash-purge-freq", time.Hour, "Frequency of purging expired movies from the trash")
+
+	flag.DurationVar(
+		&cfg.idempotency.ttl,
+		"idempotency-ttl",
+		24*time.Hour,
+		"Time responses to Idempotency-Key requests are replayed (0 disables idempotency keys)",
+	)
+	flag.DurationVar(
+		&cfg.idempotency.cleanupFreq,
+		"idempotency-cleanup-freq",
+		time.Hour,
+		"Frequency of deleting expired idempotency keys",
+	)
+
+	flag.DurationVar(&cfg.webhooks.pollFreq, "webhook-poll-freq", 5*time.Second, "Frequency of checking for due webhook deliveries")
+	flag.DurationVar(&cfg.webhooks.timeout, "webhook-timeout", 10*time.Second, "Timeout of webhook delivery requests")
+
 	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
 	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTP_SENDER"), "SMTP sender")
 
+	flag.BoolVar(&cfg.requireIfMatch, "require-if-match", false, "Reject movie updates and deletes without If-Match header")
+
+	flag.StringVar(&cfg.storage.backend, "storage", "fs", "Storage of uploaded images (fs|s3)")
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory of uploaded images for fs storage")
+	flag.StringVar(&cfg.storage.s3.Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "S3 endpoint URL")
+	flag.StringVar(&cfg.storage.s3.Region, "s3-region", os.Getenv("S3_REGION"), "S3 region")
+	flag.StringVar(&cfg.storage.s3.Bucket, "s3-bucket", os.Getenv("S3_BUCKET"), "S3 bucket")
+	flag.StringVar(&cfg.storage.s3.AccessKey, "s3-access-key", os.Getenv("S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.storage.s3.SecretKey, "s3-secret-key", os.Getenv("S3_SECRET_KEY"), "S3 secret key")
+
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(origin string) error {
 		cfg.cors.trustedOrigins = strings.Fields(origin)
 		return nil
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// movieChangesBatch is the number of logged changes read at once
+	movieChangesBatch = 100
+	// sseKeepAliveInterval is how often idle event streams receive a comment,
+	// so that proxies don't close them
+	sseKeepAliveInterval = 15 * time.Second
+)
+
+// movieChangesHandler streams movie changes as server-sent events. Clients
+// resuming with Last-Event-ID header receive changes logged after that event
+// first, others only receive new changes.
+//
+// Changes are streamed in the order of their transactions and only once no
+// older transaction is in progress, so that none of them is skipped. That's
+// why any long-running transaction with a transaction id, even one that
+// doesn't touch movies (e.g. an atomic import or a manual session left open),
+// holds back the stream of every client until it ends.
+func (app *application) movieChangesHandler(w http.ResponseWriter, r *http.Request) {
+	// Subscribe before reading the log, so that no change falls in between
+	notify, unsubscribe := app.models.MovieChanges.Subscribe()
+	defer unsubscribe()
+
+	var lastID int64
+	var err error
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			app.badRequestResponse(w, r, errors.New("Last-Event-ID header must be a non-negative integer"))
+			return
+		}
+	} else if lastID, err = app.models.MovieChanges.LastID(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The stream outlives the server write timeout
+	rc := http.NewResponseController(w)
+	if err = rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		app.logger.Error("couldn't flush event stream", "err", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		if lastID, err = app.writeMovieChanges(w, lastID); err != nil {
+			app.logger.Error("couldn't stream movie changes", "err", err)
+			return
+		}
+		if err = rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-notify:
+		case <-keepAlive.C:
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-app.shutdown:
+			return
+		}
+	}
+}
+
+// writeMovieChanges writes events of changes logged after lastID and returns
+// id of the last written one
+func (app *application) writeMovieChanges(w http.ResponseWriter, lastID int64) (int64, error) {
+	for {
+		changes, err := app.models.MovieChanges.GetAfter(lastID, movieChangesBatch)
+		if err != nil {
+			return lastID, err
+		}
+
+		for _, change := range changes {
+			b, err := json.Marshal(change)
+			if err != nil {
+				return lastID, err
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.ID, change.Action, b); err != nil {
+				return lastID, err
+			}
+			lastID = change.ID
+		}
+
+		if len(changes) < movieChangesBatch {
+			return lastID, nil
+		}
+	}
+}
+
+// listenMovieChanges keeps listening for movie changes logged by other
+// processes until the context is done, retrying after failures
+func (app *application) listenMovieChanges(ctx context.Context) {
+	for {
+		err := app.models.MovieChanges.Listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			app.logger.Error("couldn't listen for movie changes", "err", err)
+		}
+
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
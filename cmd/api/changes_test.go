@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+// openEventStream connects to the movie changes stream. The stream is closed
+// when the test finishes.
+func openEventStream(t *testing.T, url string, headers map[string][]string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/v1/movies/changes", nil)
+	assertions.AssertNoError(t, err)
+	setRequestHeaders(t, req, headers)
+
+	res, err := http.DefaultClient.Do(req)
+	assertions.AssertNoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res, bufio.NewReader(res.Body)
+}
+
+// readEvent reads lines of the next event without the terminating blank line
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var event strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		assertions.AssertNoError(t, err)
+		if line == "\n" {
+			return event.String()
+		}
+		event.WriteString(line)
+	}
+}
+
+func changeEvent(id, movieID int64, action string, version int32) string {
+	return fmt.Sprintf(
+		"id: %d\nevent: %s\ndata: {\"id\":%d,\"movie_id\":%d,\"action\":%q,\"version\":%d,\"created_at\":\"3000-01-01T12:00:00Z\"}\n",
+		id, action, id, movieID, action, version,
+	)
+}
+
+func TestMovieChanges(t *testing.T) {
+	app := newTestApplication(t)
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+
+	reader := newActivatedUser(t, app, "alice@example.com", data.MoviesRead)
+	stranger := newActivatedUser(t, app, "bob@example.com", data.MoviesWrite)
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(moana, 0))
+
+	t.Run("new changes", func(t *testing.T) {
+		res, stream := openEventStream(t, ts.URL, reader)
+		assertions.AssertStatusCode(t, res.StatusCode, http.StatusOK)
+		assertions.AssertStrings(t, res.Header.Get("Content-Type"), "text/event-stream")
+
+		moana.Runtime = 110
+		assertions.AssertNoError(t, app.models.Movies.Update(moana, 0))
+		assertions.AssertStrings(t, readEvent(t, stream), changeEvent(2, 1, data.ChangeUpdated, 2))
+
+		assertions.AssertNoError(t, app.models.Movies.Delete(moana, 0))
+		assertions.AssertStrings(t, readEvent(t, stream), changeEvent(3, 1, data.ChangeDeleted, 3))
+	})
+
+	t.Run("resume after last event id", func(t *testing.T) {
+		headers := map[string][]string{"Authorization": reader["Authorization"], "Last-Event-ID": {"1"}}
+		res, stream := openEventStream(t, ts.URL, headers)
+		assertions.AssertStatusCode(t, res.StatusCode, http.StatusOK)
+
+		assertions.AssertStrings(t, readEvent(t, stream), changeEvent(2, 1, data.ChangeUpdated, 2))
+		assertions.AssertStrings(t, readEvent(t, stream), changeEvent(3, 1, data.ChangeDeleted, 3))
+
+		_, err := app.models.Movies.Restore(moana.ID, 0)
+		assertions.AssertNoError(t, err)
+		assertions.AssertStrings(t, readEvent(t, stream), changeEvent(4, 1, data.ChangeCreated, 4))
+	})
+
+	cases := []struct {
+		name    string
+		headers map[string][]string
+		want    envelope
+		code    int
+	}{
+		{
+			name:    "invalid last event id",
+			headers: map[string][]string{"Authorization": reader["Authorization"], "Last-Event-ID": {"abc"}},
+			want:    envelope{"error": "Last-Event-ID header must be a non-negative integer"},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "without permission",
+			headers: stranger,
+			want:    envelope{"error": "your user account doesn't have the necessary permissions to access this resource"},
+			code:    http.StatusForbidden,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, _ := openEventStream(t, ts.URL, c.headers)
+
+			got, err := io.ReadAll(res.Body)
+			assertions.AssertNoError(t, err)
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, string(got), string(want))
+			assertions.AssertStatusCode(t, res.StatusCode, c.code)
+		})
+	}
+}
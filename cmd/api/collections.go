@@ -0,0 +1,443 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type collectionCreateBody struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+}
+
+type collectionUpdateBody struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Public      *bool   `json:"public"`
+}
+
+type collectionMoviesBody struct {
+	MovieIDs []int64 `json:"movie_ids"`
+}
+
+type collectionMovieBody struct {
+	MovieID  int64 `json:"movie_id"`
+	Position *int  `json:"position"`
+}
+
+type collectionPositionBody struct {
+	Position int `json:"position"`
+}
+
+func (app *application) readMovieIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("movie_id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid movie_id parameter")
+	}
+	return id, nil
+}
+
+// readCollection fetches the collection from the id path parameter. Private
+// collections of other users are reported as missing. If owned is set, the
+// collection must belong to the user. Returns false if a response was written.
+func (app *application) readCollection(w http.ResponseWriter, r *http.Request, owned bool) (*data.Collection, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+	switch {
+	case !collection.VisibleTo(user):
+		app.notFoundResponse(w, r)
+		return nil, false
+	case owned && collection.OwnerID != user.ID:
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return collection, true
+}
+
+// checkCollectionFilter makes sure movies are only filtered by collections
+// visible to the user
+func (app *application) checkCollectionFilter(r *http.Request, collectionID int64, v *validator.Validator) error {
+	if collectionID == 0 {
+		return nil
+	}
+
+	collection, err := app.models.Collections.Get(collectionID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+	case err != nil:
+		return err
+	case collection.VisibleTo(app.contextGetUser(r)):
+		return nil
+	}
+
+	v.AddError("collection_id", "must reference an existing collection")
+	return nil
+}
+
+func (app *application) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafelist = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+
+	if input.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	collections, metadata, err := app.models.Collections.GetAllVisible(app.contextGetUser(r).ID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"collections": collections, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var input collectionCreateBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := &data.Collection{
+		OwnerID:     app.contextGetUser(r).ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Public:      input.Public,
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Collections.Insert(collection); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/collections/%d", collection.ID))
+
+	if err := app.writeJSON(w, envelope{"collection": collection}, http.StatusCreated, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getCollectionHandler responds with the collection along with its movies in
+// the collection order. Trashed movies are left out.
+func (app *application) getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	langs := app.readLanguages(w, r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	collection, ok := app.readCollection(w, r, false)
+	if !ok {
+		return
+	}
+
+	movies := []*data.Movie{}
+	if len(collection.MovieIDs) > 0 {
+		filters := data.Filters{
+			Page:         1,
+			PageSize:     len(collection.MovieIDs),
+			Sort:         "id",
+			SortSafelist: []string{"id"},
+		}
+
+		var err error
+		movies, _, err = app.models.Movies.GetAll(data.MovieFilters{CollectionID: collection.ID}, filters)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrCloseRows):
+				app.logError(r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		slices.SortFunc(movies, func(a, b *data.Movie) int {
+			return slices.Index(collection.MovieIDs, a.ID) - slices.Index(collection.MovieIDs, b.ID)
+		})
+
+		if err = app.localizeMovies(langs, movies...); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := app.writeJSON(w, envelope{"collection": collection, "movies": movies}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r, true)
+	if !ok {
+		return
+	}
+
+	var input collectionUpdateBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		collection.Name = *input.Name
+	}
+	if input.Description != nil {
+		collection.Description = *input.Description
+	}
+	if input.Public != nil {
+		collection.Public = *input.Public
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Collections.Update(collection); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, envelope{"collection": collection}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r, true)
+	if !ok {
+		return
+	}
+
+	if err := app.models.Collections.Delete(collection.ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, envelope{"message": "collection successfully deleted"}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setCollectionMoviesHandler replaces movies of the collection, which is also
+// the way to reorder all of them at once
+func (app *application) setCollectionMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r, true)
+	if !ok {
+		return
+	}
+
+	var input collectionMoviesBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.MovieIDs == nil {
+		input.MovieIDs = []int64{}
+	}
+
+	v := validator.New()
+	if data.ValidateCollectionMovies(v, input.MovieIDs); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Trashed movies may stay in the collection, but can't be added to it
+	for _, id := range input.MovieIDs {
+		if slices.Contains(collection.MovieIDs, id) {
+			continue
+		}
+		if _, err := app.models.Movies.GetByID(id); err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("movie_ids", "must only reference existing movies")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	app.saveCollectionMovies(w, r, collection, input.MovieIDs, "movie_ids")
+}
+
+// addCollectionMovieHandler inserts the movie at the given 1-based position or
+// appends it to the collection
+func (app *application) addCollectionMovieHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r, true)
+	if !ok {
+		return
+	}
+
+	var input collectionMovieBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	position := len(collection.MovieIDs) + 1
+	if input.Position != nil {
+		position = *input.Position
+	}
+
+	v := validator.New()
+	v.Check(input.MovieID > 0, "movie_id", "must be a positive integer")
+	v.Check(!slices.Contains(collection.MovieIDs, input.MovieID), "movie_id", "is already in the collection")
+	v.Check(position >= 1 && position <= len(collection.MovieIDs)+1, "position", fmt.Sprintf("must be between 1 and %d", len(collection.MovieIDs)+1))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, err := app.models.Movies.GetByID(input.MovieID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "must reference an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movieIDs := slices.Insert(slices.Clone(collection.MovieIDs), position-1, input.MovieID)
+	if v.Check(len(movieIDs) <= data.MaxCollectionMovies, "movie_id", fmt.Sprintf("must not exceed the limit of %d movies", data.MaxCollectionMovies)); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.saveCollectionMovies(w, r, collection, movieIDs, "movie_id")
+}
+
+// moveCollectionMovieHandler moves the movie to the given 1-based position
+func (app *application) moveCollectionMovieHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r, true)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readMovieIDParam(r)
+	i := slices.Index(collection.MovieIDs, movieID)
+	if err != nil || i == -1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input collectionPositionBody
+
+	if err = app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Position >= 1 && input.Position <= len(collection.MovieIDs), "position", fmt.Sprintf("must be between 1 and %d", len(collection.MovieIDs))); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movieIDs := slices.Delete(slices.Clone(collection.MovieIDs), i, i+1)
+	movieIDs = slices.Insert(movieIDs, input.Position-1, movieID)
+
+	app.saveCollectionMovies(w, r, collection, movieIDs, "position")
+}
+
+func (app *application) removeCollectionMovieHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r, true)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readMovieIDParam(r)
+	i := slices.Index(collection.MovieIDs, movieID)
+	if err != nil || i == -1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movieIDs := slices.Delete(slices.Clone(collection.MovieIDs), i, i+1)
+
+	app.saveCollectionMovies(w, r, collection, movieIDs, "movie_id")
+}
+
+// saveCollectionMovies stores the new movie list of the collection and responds
+// with the updated collection. Unknown movies are reported under the key.
+func (app *application) saveCollectionMovies(w http.ResponseWriter, r *http.Request, collection *data.Collection, movieIDs []int64, key string) {
+	if err := app.models.Collections.SetMovies(collection, movieIDs); err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownMovie):
+			v := validator.New()
+			v.AddError(key, "must only reference existing movies")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, envelope{"collection": collection}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestCollections(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	alice := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+	bob := newActivatedUser(t, app, "bob@example.com", data.MoviesRead)
+
+	fellowship := &data.Movie{Title: "The Fellowship of the Ring", Year: 2001, Runtime: 178, Genres: data.Genres{"fantasy"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(fellowship, 0))
+	towers := &data.Movie{Title: "The Two Towers", Year: 2002, Runtime: 179, Genres: data.Genres{"fantasy"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(towers, 0))
+	king := &data.Movie{Title: "The Return of the King", Year: 2003, Runtime: 201, Genres: data.Genres{"fantasy"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(king, 0))
+
+	lotr := func(version int32, public bool, movieIDs ...int64) data.Collection {
+		return data.Collection{
+			ID: 1, CreatedAt: data.MockTimeStamp, OwnerID: 1, Name: "The Lord of the Rings",
+			Public: public, MovieIDs: append([]int64{}, movieIDs...), Version: version,
+		}
+	}
+	criterion := data.Collection{
+		ID: 2, CreatedAt: data.MockTimeStamp, OwnerID: 2, Name: "Criterion Picks", Public: true, MovieIDs: []int64{}, Version: 1,
+	}
+
+	cases := []struct {
+		name     string
+		user     map[string][]string
+		method   string
+		path     string
+		body     any
+		want     envelope
+		code     int
+		location string
+	}{
+		{
+			name:     "create private collection",
+			user:     alice,
+			method:   http.MethodPost,
+			path:     "/v1/collections",
+			body:     collectionCreateBody{Name: "The Lord of the Rings"},
+			want:     envelope{"collection": lotr(1, false)},
+			code:     http.StatusCreated,
+			location: "/v1/collections/1",
+		},
+		{
+			name:   "create collection without name",
+			user:   alice,
+			method: http.MethodPost,
+			path:   "/v1/collections",
+			body:   collectionCreateBody{Name: " "},
+			want:   envelope{"error": map[string]string{"name": "must be provided"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "create public collection",
+			user:     bob,
+			method:   http.MethodPost,
+			path:     "/v1/collections",
+			body:     collectionCreateBody{Name: "Criterion Picks", Public: true},
+			want:     envelope{"collection": criterion},
+			code:     http.StatusCreated,
+			location: "/v1/collections/2",
+		},
+		{
+			name:   "list visible collections",
+			user:   bob,
+			method: http.MethodGet,
+			path:   "/v1/collections",
+			want: envelope{
+				"collections": []data.Collection{criterion},
+				"metadata":    data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "get private collection of another user",
+			user:   bob,
+			method: http.MethodGet,
+			path:   "/v1/collections/1",
+			want:   envelope{"error": "the requested resource could not be found"},
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "update public collection of another user",
+			user:   alice,
+			method: http.MethodPatch,
+			path:   "/v1/collections/2",
+			body:   collectionUpdateBody{Name: new(string)},
+			want:   envelope{"error": "your user account doesn't have the necessary permissions to access this resource"},
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "set movies",
+			user:   alice,
+			method: http.MethodPut,
+			path:   "/v1/collections/1/movies",
+			body:   collectionMoviesBody{MovieIDs: []int64{3, 1}},
+			want:   envelope{"collection": lotr(2, false, 3, 1)},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "set duplicate movies",
+			user:   alice,
+			method: http.MethodPut,
+			path:   "/v1/collections/1/movies",
+			body:   collectionMoviesBody{MovieIDs: []int64{1, 1}},
+			want:   envelope{"error": map[string]string{"movie_ids": "must not contain duplicate movies"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "set unknown movies",
+			user:   alice,
+			method: http.MethodPut,
+			path:   "/v1/collections/1/movies",
+			body:   collectionMoviesBody{MovieIDs: []int64{1, 99}},
+			want:   envelope{"error": map[string]string{"movie_ids": "must only reference existing movies"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "add movie at position",
+			user:   alice,
+			method: http.MethodPost,
+			path:   "/v1/collections/1/movies",
+			body:   collectionMovieBody{MovieID: 2, Position: func() *int { p := 1; return &p }()},
+			want:   envelope{"collection": lotr(3, false, 2, 3, 1)},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "add movie twice",
+			user:   alice,
+			method: http.MethodPost,
+			path:   "/v1/collections/1/movies",
+			body:   collectionMovieBody{MovieID: 2},
+			want:   envelope{"error": map[string]string{"movie_id": "is already in the collection"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "move movie",
+			user:   alice,
+			method: http.MethodPatch,
+			path:   "/v1/collections/1/movies/2",
+			body:   collectionPositionBody{Position: 3},
+			want:   envelope{"collection": lotr(4, false, 3, 1, 2)},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "move movie out of range",
+			user:   alice,
+			method: http.MethodPatch,
+			path:   "/v1/collections/1/movies/2",
+			body:   collectionPositionBody{Position: 4},
+			want:   envelope{"error": map[string]string{"position": "must be between 1 and 3"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "move movie outside of collection",
+			user:   alice,
+			method: http.MethodPatch,
+			path:   "/v1/collections/1/movies/99",
+			body:   collectionPositionBody{Position: 1},
+			want:   envelope{"error": "the requested resource could not be found"},
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "get collection with movies in order",
+			user:   alice,
+			method: http.MethodGet,
+			path:   "/v1/collections/1",
+			want: envelope{
+				"collection": lotr(4, false, 3, 1, 2),
+				"movies":     []*data.Movie{king, fellowship, towers},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "remove movie",
+			user:   alice,
+			method: http.MethodDelete,
+			path:   "/v1/collections/1/movies/1",
+			want:   envelope{"collection": lotr(5, false, 3, 2)},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "filter movies by collection",
+			user:   alice,
+			method: http.MethodGet,
+			path:   "/v1/movies?collection_id=1",
+			want: envelope{
+				"movies":   []*data.Movie{towers, king},
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "filter movies by private collection of another user",
+			user:   bob,
+			method: http.MethodGet,
+			path:   "/v1/movies?collection_id=1",
+			want:   envelope{"error": map[string]string{"collection_id": "must reference an existing collection"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "publish collection",
+			user:   alice,
+			method: http.MethodPatch,
+			path:   "/v1/collections/1",
+			body:   collectionUpdateBody{Public: func() *bool { b := true; return &b }()},
+			want:   envelope{"collection": lotr(6, true, 3, 2)},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "list collections after publishing",
+			user:   bob,
+			method: http.MethodGet,
+			path:   "/v1/collections?sort=name",
+			want: envelope{
+				"collections": []data.Collection{criterion, lotr(6, true, 3, 2)},
+				"metadata":    data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "delete collection of another user",
+			user:   bob,
+			method: http.MethodDelete,
+			path:   "/v1/collections/1",
+			want:   envelope{"error": "your user account doesn't have the necessary permissions to access this resource"},
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "delete collection",
+			user:   alice,
+			method: http.MethodDelete,
+			path:   "/v1/collections/1",
+			want:   envelope{"message": "collection successfully deleted"},
+			code:   http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.user)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			if c.location != "" {
+				assertions.AssertStrings(t, rw.Header().Get("Location"), c.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type movieMergeBody struct {
+	Into int64 `json:"into"`
+}
+
+// listDuplicatesHandler reports pairs of movies which are likely the same one
+// entered twice, so editors can merge them
+func (app *application) listDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	minSimilarity := app.readFloat(qs, "min_similarity", 0.6, v)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-similarity")
+	input.SortSafelist = []string{"similarity", "-similarity"}
+
+	v.Check(minSimilarity >= 0.3 && minSimilarity <= 1, "min_similarity", "must be between 0.3 and 1")
+	if input.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	duplicates, metadata, err := app.models.Movies.Duplicates(minSimilarity, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"duplicates": duplicates, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeMovieHandler folds the movie into the one given in the body. The merged
+// movie id keeps answering with a redirect to the survivor.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	from, err := app.models.Movies.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, from) {
+		return
+	}
+
+	var input movieMergeBody
+
+	if err = app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Into > 0, "into", "must be a positive integer")
+	v.Check(input.Into != id, "into", "must differ from the merged movie")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	into, err := app.models.Movies.GetByID(input.Into)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "must reference an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	adopted := into.Poster == nil
+
+	if err = app.models.Movies.Merge(from, into, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !adopted {
+		app.deletePosterBlobs(from.Poster)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", into.ID))
+	headers.Set("ETag", movieETag(into))
+
+	if err = app.writeJSON(w, envelope{"movie": into}, http.StatusOK, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redirectMergedMovie redirects requests of a merged movie to the survivor or
+// answers with 404 if the movie was never merged
+func (app *application) redirectMergedMovie(w http.ResponseWriter, r *http.Request, id int64) {
+	movieID, err := app.models.Movies.GetRedirect(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	location := fmt.Sprintf("/v1/movies/%d", movieID)
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", location)
+
+	err = app.writeJSON(w, envelope{"message": "the movie was merged into another one"}, http.StatusMovedPermanently, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
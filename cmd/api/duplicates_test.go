@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestMovieDuplicates(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	editor := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+
+	starWars := &data.Movie{Title: "Star Wars", Year: 1977, Runtime: 121, Genres: data.Genres{"sci-fi"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(starWars, 0))
+	newHope := &data.Movie{Title: "Star Wars: A New Hope", Year: 1977, Runtime: 121, Genres: data.Genres{"adventure", "sci-fi"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(newHope, 0))
+	heat := &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(heat, 0))
+
+	assertions.AssertNoError(t, app.models.Ratings.Insert(&data.Rating{MovieID: starWars.ID, UserID: 1, Rating: 8}))
+	assertions.AssertNoError(t, app.models.Ratings.Insert(&data.Rating{MovieID: newHope.ID, UserID: 1, Rating: 4}))
+	assertions.AssertNoError(t, app.models.Ratings.Insert(&data.Rating{MovieID: newHope.ID, UserID: 2, Rating: 10}))
+	_, err := app.models.Watchlist.Add(1, newHope)
+	assertions.AssertNoError(t, err)
+
+	cases := []struct {
+		name     string
+		method   string
+		path     string
+		body     any
+		want     envelope
+		code     int
+		location string
+	}{
+		{
+			name:   "create duplicate",
+			method: http.MethodPost,
+			path:   "/v1/movies",
+			body:   movieCreateBody{Title: "star  wars", Year: 1977, Runtime: 121, Genres: []string{"sci-fi"}},
+			want:   envelope{"error": map[string]string{"title": "a movie with this title and year already exists"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "create remake",
+			method: http.MethodPost,
+			path:   "/v1/movies",
+			body:   movieCreateBody{Title: "Heat", Year: 2026, Runtime: 120, Genres: []string{"crime"}},
+			want: envelope{"movie": data.Movie{
+				ID: 4, Title: "Heat", Year: 2026, Runtime: 120, Genres: data.Genres{"crime"}, Version: 1,
+			}},
+			code:     http.StatusCreated,
+			location: "/v1/movies/4",
+		},
+		{
+			name:   "report without similar enough titles",
+			method: http.MethodGet,
+			path:   "/v1/movies/duplicates",
+			want:   envelope{"duplicates": []*data.DuplicatePair{}, "metadata": data.Metadata{}},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "report with lower similarity",
+			method: http.MethodGet,
+			path:   "/v1/movies/duplicates?min_similarity=0.4",
+			want: envelope{
+				"duplicates": []*data.DuplicatePair{{
+					Movie:      &data.Movie{ID: 1, Title: "Star Wars", Year: 1977},
+					Duplicate:  &data.Movie{ID: 2, Title: "Star Wars: A New Hope", Year: 1977},
+					Similarity: 0.48,
+				}},
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "report with too low similarity",
+			method: http.MethodGet,
+			path:   "/v1/movies/duplicates?min_similarity=0.1",
+			want:   envelope{"error": map[string]string{"min_similarity": "must be between 0.3 and 1"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "merge movie into itself",
+			method: http.MethodPost,
+			path:   "/v1/movies/2/merge",
+			body:   movieMergeBody{Into: 2},
+			want:   envelope{"error": map[string]string{"into": "must differ from the merged movie"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "merge movie into unknown one",
+			method: http.MethodPost,
+			path:   "/v1/movies/2/merge",
+			body:   movieMergeBody{Into: 99},
+			want:   envelope{"error": map[string]string{"into": "must reference an existing movie"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "merge movie",
+			method: http.MethodPost,
+			path:   "/v1/movies/2/merge",
+			body:   movieMergeBody{Into: 1},
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "Star Wars", Year: 1977, Runtime: 121, Genres: data.Genres{"sci-fi", "adventure"}, Version: 2,
+				Rating: 9, RatingCount: 2,
+			}},
+			code:     http.StatusOK,
+			location: "/v1/movies/1",
+		},
+		{
+			name:     "get merged movie",
+			method:   http.MethodGet,
+			path:     "/v1/movies/2?include=credits",
+			want:     envelope{"message": "the movie was merged into another one"},
+			code:     http.StatusMovedPermanently,
+			location: "/v1/movies/1?include=credits",
+		},
+		{
+			name:   "merge already merged movie",
+			method: http.MethodPost,
+			path:   "/v1/movies/2/merge",
+			body:   movieMergeBody{Into: 3},
+			want:   envelope{"error": "the requested resource could not be found"},
+			code:   http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, editor)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			if c.location != "" {
+				assertions.AssertStrings(t, rw.Header().Get("Location"), c.location)
+			}
+		})
+	}
+
+	entries, _, err := app.models.Watchlist.GetAll(1, data.Filters{
+		Page: 1, PageSize: 20, Sort: "added_at", SortSafelist: []string{"added_at"},
+	})
+	assertions.AssertNoError(t, err)
+	if len(entries) != 1 || entries[0].Movie.ID != starWars.ID {
+		t.Errorf("got watchlist %v, want the surviving movie only", entries)
+	}
+}
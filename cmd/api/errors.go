@@ -59,6 +59,22 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, msg)
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "the resource has been modified since it was last fetched, fetch it again and retry"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, msg)
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "this request must be conditional, provide an If-Match header"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, msg)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+	msg := "the request body must be application/json, " + mergePatchType + " or " + jsonPatchType
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, msg)
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	msg := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, msg)
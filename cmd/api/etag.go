@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/shrtyk/greenlight/internal/data"
+)
+
+// movieETag returns strong entity tag of the movie representation. It changes
+// with every update since Update always bumps the version.
+func movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version)
+}
+
+// sparseMovieETag returns entity tag of the movie representation narrowed down
+// to the fields. Every set of fields is a representation of its own, so their
+// names are part of the tag. Such tags are accepted by checkIfMatch as well.
+func sparseMovieETag(movie *data.Movie, fields []string) string {
+	if len(fields) == 0 {
+		return movieETag(movie)
+	}
+	fields = slices.Compact(slices.Sorted(slices.Values(fields)))
+	return fmt.Sprintf(`"%d-%d-%s"`, movie.ID, movie.Version, strings.Join(fields, "+"))
+}
+
+// localizedMovieETag returns weak entity tag of the movie representation with
+// its title localized by localizeMovies. Alternate titles change without
+// bumping the movie version, so the chosen title is hashed into the tag. Weak
+// tags only validate cached responses, If-Match never accepts them.
+func localizedMovieETag(movie *data.Movie, fields []string) string {
+	etag := sparseMovieETag(movie, fields)
+	if movie.OriginalTitle == "" {
+		return etag
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(movie.Title))
+	return fmt.Sprintf(`W/%s-%x"`, strings.TrimSuffix(etag, `"`), h.Sum32())
+}
+
+// etagMatches reports whether the etag matches any entity tag in the header value
+// (or the header is "*"). Weak comparison ignores the W/ prefix, strong comparison
+// never matches weak tags.
+func etagMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if strings.HasPrefix(etag, "W/") {
+		if !weak {
+			return false
+		}
+		etag = strings.TrimPrefix(etag, "W/")
+	}
+
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch verifies the If-Match precondition of a request modifying the movie.
+// If it doesn't hold, the error response is written and false returned.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	header := r.Header.Get("If-Match")
+	switch {
+	case header == "" && app.config.requireIfMatch:
+		app.preconditionRequiredResponse(w, r)
+		return false
+	case header != "" && !ifMatchesMovie(header, movie):
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+	return true
+}
+
+// ifMatchesMovie reports whether the If-Match header matches strong entity tag
+// of the movie version, either the whole or narrowed down to any fields
+func ifMatchesMovie(header string, movie *data.Movie) bool {
+	if etagMatches(header, movieETag(movie), false) {
+		return true
+	}
+
+	prefix := strings.TrimSuffix(movieETag(movie), `"`) + "-"
+	for candidate := range strings.SplitSeq(header, ",") {
+		if strings.HasPrefix(strings.TrimSpace(candidate), prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+)
+
+func TestETagMatches(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{name: "exact", header: `"1-2"`, etag: `"1-2"`, want: true},
+		{name: "wildcard", header: "*", etag: `"1-2"`, want: true},
+		{name: "list", header: `"1-1", "1-2"`, etag: `"1-2"`, want: true},
+		{name: "other version", header: `"1-1"`, etag: `"1-2"`, want: false},
+		{name: "weak in strong comparison", header: `W/"1-2"`, etag: `"1-2"`, want: false},
+		{name: "weak in weak comparison", header: `W/"1-2"`, etag: `"1-2"`, weak: true, want: true},
+		{name: "weak etag in strong comparison", header: `W/"1-2-ab"`, etag: `W/"1-2-ab"`, want: false},
+		{name: "weak etag in weak comparison", header: `"1-2-ab"`, etag: `W/"1-2-ab"`, weak: true, want: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := etagMatches(c.header, c.etag, c.weak); got != c.want {
+				t.Errorf("got: %v, want: %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestIfMatchesMovie(t *testing.T) {
+	movie := &data.Movie{ID: 1, Version: 2}
+
+	cases := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "whole movie", header: `"1-2"`, want: true},
+		{name: "sparse fields", header: sparseMovieETag(movie, []string{"year", "title"}), want: true},
+		{name: "sparse fields of other version", header: `"1-1-title+year"`, want: false},
+		{name: "other movie", header: `"12-2"`, want: false},
+		{name: "weak localized tag", header: `W/"1-2-1a2b3c4d"`, want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ifMatchesMovie(c.header, movie); got != c.want {
+				t.Errorf("got: %v, want: %v", got, c.want)
+			}
+		})
+	}
+}
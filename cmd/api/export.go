@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+const (
+	// Number of movies written between flushes of export response
+	exportFlushEvery = 200
+	// Time given to write the next chunk of export response. It's extended on
+	// every flush, so exports may last longer than server's WriteTimeout.
+	exportWriteTimeout = 10 * time.Second
+)
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	movieFilters := app.readMovieFilters(qs, v)
+	format := app.readString(qs, "format", "ndjson")
+
+	if err := app.checkCollectionFilter(r, movieFilters.CollectionID, v); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if v.Check(validator.PermittedValue(format, "ndjson", "csv"), "format", "invalid format value"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var enc movieEncoder
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.csv"`)
+		enc = newMovieCSVEncoder(w)
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc = newMovieNDJSONEncoder(w)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	written := 0
+	err := app.models.Movies.Export(r.Context(), movieFilters, func(movie *data.Movie) error {
+		if err := enc.Encode(movie); err != nil {
+			return err
+		}
+
+		if written++; written%exportFlushEvery == 0 {
+			return flushExport(rc, enc)
+		}
+		return nil
+	})
+	if err == nil {
+		err = flushExport(rc, enc)
+	}
+
+	if err != nil {
+		// Status line is already sent. Abort the response, so the client doesn't
+		// take truncated export for a complete one.
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func flushExport(rc *http.ResponseController, enc movieEncoder) error {
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+type movieEncoder interface {
+	Encode(movie *data.Movie) error
+	// Flush writes any buffered data to the underlying writer
+	Flush() error
+}
+
+type movieNDJSONEncoder struct {
+	enc *json.Encoder
+}
+
+func newMovieNDJSONEncoder(w io.Writer) *movieNDJSONEncoder {
+	return &movieNDJSONEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *movieNDJSONEncoder) Encode(movie *data.Movie) error {
+	return e.enc.Encode(movie)
+}
+
+func (e *movieNDJSONEncoder) Flush() error {
+	return nil
+}
+
+// movieCSVEncoder writes movies in the format accepted by importMoviesHandler
+type movieCSVEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newMovieCSVEncoder(w io.Writer) *movieCSVEncoder {
+	return &movieCSVEncoder{w: csv.NewWriter(w)}
+}
+
+var movieCSVHeader = []string{"id", "title", "year", "runtime", "genres", "version"}
+
+func (e *movieCSVEncoder) Encode(movie *data.Movie) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	return e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.Runtime), 10),
+		strings.Join(movie.Genres, "|"),
+		strconv.FormatInt(int64(movie.Version), 10),
+	})
+}
+
+func (e *movieCSVEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// writeHeader writes header row once, so even empty exports have one
+func (e *movieCSVEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(movieCSVHeader)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func TestExportMovies(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+	headers := newActivatedUser(t, app, "bob@example.com", data.MoviesRead)
+
+	for _, m := range []*data.Movie{
+		{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation", "adventure"}},
+		{Title: "Black Panther", Year: 2018, Runtime: 134, Genres: data.Genres{"action", "adventure"}},
+		{Title: "Deadpool", Year: 2016, Runtime: 108, Genres: data.Genres{"action", "comedy"}},
+	} {
+		assertions.AssertNoError(t, app.models.Movies.Insert(m, 0))
+	}
+
+	cases := []struct {
+		name        string
+		path        string
+		contentType string
+		want        string
+		code        int
+	}{
+		{
+			name:        "ndjson",
+			path:        "/v1/movies/export?genres=adventure",
+			contentType: "application/x-ndjson",
+			want: `{"id":1,"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation","adventure"],"version":1}` + "\n" +
+				`{"id":2,"title":"Black Panther","year":2018,"runtime":"134 mins","genres":["action","adventure"],"version":1}` + "\n",
+			code: http.StatusOK,
+		},
+		{
+			name:        "csv",
+			path:        "/v1/movies/export?format=csv&title=dead",
+			contentType: "text/csv",
+			want: "id,title,year,runtime,genres,version\n" +
+				"3,Deadpool,2016,108,action|comedy,1\n",
+			code: http.StatusOK,
+		},
+		{
+			name:        "empty csv",
+			path:        "/v1/movies/export?format=csv&genres=drama",
+			contentType: "text/csv",
+			want:        "id,title,year,runtime,genres,version\n",
+			code:        http.StatusOK,
+		},
+		{
+			name:        "unknown format",
+			path:        "/v1/movies/export?format=xml",
+			contentType: "application/json",
+			want:        `{"error":{"format":"invalid format value"}}`,
+			code:        http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, headers)
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			assertions.AssertStrings(t, rw.Header().Get("Content-Type"), c.contentType)
+			assertions.AssertStrings(t, rw.Body.String(), c.want)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type movieUpsertBody struct {
+	Title       string           `json:"title"`
+	Year        int32            `json:"year"`
+	Runtime     data.Runtime     `json:"runtime"`
+	Genres      []string         `json:"genres"`
+	ExternalIDs data.ExternalIDs `json:"external_ids"`
+}
+
+// lookupMovieHandler finds the movie by its identifier at one of the external
+// providers, e.g. /v1/movies/lookup?imdb=tt0111161
+func (app *application) lookupMovieHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	providers := slices.Sorted(maps.Keys(data.ExternalProviders))
+
+	var given []string
+	for _, provider := range providers {
+		if qs.Has(provider) {
+			given = append(given, provider)
+		}
+	}
+
+	v := validator.New()
+
+	if len(given) != 1 {
+		v.AddError("provider", "exactly one of "+strings.Join(providers, ", ")+" must be provided")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	provider, externalID := given[0], qs.Get(given[0])
+	if v.Check(validator.Matches(externalID, data.ExternalProviders[provider]), provider, "must be a valid "+provider+" identifier"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByExternalID(provider, externalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie))
+
+	if err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// upsertMovieByExternalIDHandler replaces the movie having the external id or
+// creates a new one with it, so repeated ingestion doesn't produce duplicates.
+// External ids from the body are added to the ones the movie already has.
+func (app *application) upsertMovieByExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	provider, externalID := r.PathValue("provider"), r.PathValue("id")
+	if _, ok := data.ExternalProviders[provider]; !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input movieUpsertBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if id, ok := input.ExternalIDs[provider]; ok && id != externalID {
+		v.AddError("external_ids."+provider, "must match the identifier in the URL")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByExternalID(provider, externalID)
+	created := errors.Is(err, data.ErrRecordNotFound)
+	switch {
+	case created:
+		movie = &data.Movie{}
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	case !app.checkIfMatch(w, r, movie):
+		return
+	}
+
+	externalIDs := make(data.ExternalIDs, len(movie.ExternalIDs)+len(input.ExternalIDs)+1)
+	maps.Copy(externalIDs, movie.ExternalIDs)
+	maps.Copy(externalIDs, input.ExternalIDs)
+	externalIDs[provider] = externalID
+
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
+	movie.ExternalIDs = externalIDs
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data.ValidateMovie(v, movie, taxonomy)
+	data.ValidateExternalIDs(v, movie.ExternalIDs)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if created {
+		err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
+	} else {
+		err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMovieAlreadyExists):
+			v.AddError("title", "a movie with this title and year already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "must not contain identifiers of other movies")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	status := http.StatusOK
+	if created {
+		headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+		status = http.StatusCreated
+	}
+
+	if err = app.writeJSON(w, envelope{"movie": movie}, status, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
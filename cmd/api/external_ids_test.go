@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestMovieExternalIDs(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	editor := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+
+	shawshank := movieUpsertBody{
+		Title:       "The Shawshank Redemption",
+		Year:        1994,
+		Runtime:     142,
+		Genres:      []string{"drama"},
+		ExternalIDs: data.ExternalIDs{"tmdb": "278"},
+	}
+	recut := shawshank
+	recut.Runtime = 144
+	recut.ExternalIDs = data.ExternalIDs{"wikidata": "Q172241"}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   envelope
+		code   int
+	}{
+		{
+			name:   "lookup without provider",
+			method: http.MethodGet,
+			path:   "/v1/movies/lookup",
+			want:   envelope{"error": map[string]string{"provider": "exactly one of imdb, tmdb, wikidata must be provided"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "lookup with invalid identifier",
+			method: http.MethodGet,
+			path:   "/v1/movies/lookup?imdb=111161",
+			want:   envelope{"error": map[string]string{"imdb": "must be a valid imdb identifier"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "upsert creates movie",
+			method: http.MethodPut,
+			path:   "/v1/movies/by-external/imdb/tt0111161",
+			body:   shawshank,
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "The Shawshank Redemption", Year: 1994, Runtime: 142, Genres: data.Genres{"drama"}, Version: 1,
+				ExternalIDs: data.ExternalIDs{"imdb": "tt0111161", "tmdb": "278"},
+			}},
+			code: http.StatusCreated,
+		},
+		{
+			name:   "upsert updates movie",
+			method: http.MethodPut,
+			path:   "/v1/movies/by-external/imdb/tt0111161",
+			body:   recut,
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "The Shawshank Redemption", Year: 1994, Runtime: 144, Genres: data.Genres{"drama"}, Version: 2,
+				ExternalIDs: data.ExternalIDs{"imdb": "tt0111161", "tmdb": "278", "wikidata": "Q172241"},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:   "lookup by another provider",
+			method: http.MethodGet,
+			path:   "/v1/movies/lookup?tmdb=278",
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "The Shawshank Redemption", Year: 1994, Runtime: 144, Genres: data.Genres{"drama"}, Version: 2,
+				ExternalIDs: data.ExternalIDs{"imdb": "tt0111161", "tmdb": "278", "wikidata": "Q172241"},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:   "lookup unknown identifier",
+			method: http.MethodGet,
+			path:   "/v1/movies/lookup?imdb=tt0068646",
+			want:   envelope{"error": "the requested resource could not be found"},
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "upsert by unknown provider",
+			method: http.MethodPut,
+			path:   "/v1/movies/by-external/letterboxd/shawshank",
+			body:   shawshank,
+			want:   envelope{"error": "the requested resource could not be found"},
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "upsert with invalid identifier",
+			method: http.MethodPut,
+			path:   "/v1/movies/by-external/imdb/0068646",
+			body:   movieUpsertBody{Title: "The Godfather", Year: 1972, Runtime: 175, Genres: []string{"crime"}},
+			want:   envelope{"error": map[string]string{"external_ids.imdb": "must be a valid imdb identifier"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "upsert with mismatching identifier",
+			method: http.MethodPut,
+			path:   "/v1/movies/by-external/imdb/tt0068646",
+			body: movieUpsertBody{
+				Title: "The Godfather", Year: 1972, Runtime: 175, Genres: []string{"crime"},
+				ExternalIDs: data.ExternalIDs{"imdb": "tt0068647"},
+			},
+			want: envelope{"error": map[string]string{"external_ids.imdb": "must match the identifier in the URL"}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "upsert with identifier of another movie",
+			method: http.MethodPut,
+			path:   "/v1/movies/by-external/imdb/tt0068646",
+			body: movieUpsertBody{
+				Title: "The Godfather", Year: 1972, Runtime: 175, Genres: []string{"crime"},
+				ExternalIDs: data.ExternalIDs{"tmdb": "278"},
+			},
+			want: envelope{"error": map[string]string{"external_ids": "must not contain identifiers of other movies"}},
+			code: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, editor)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type genreCreateBody struct {
+	Slug    string   `json:"slug"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+type genreUpdateBody struct {
+	Slug    *string  `json:"slug"`
+	Name    *string  `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+type genreMergeBody struct {
+	Into string `json:"into"`
+}
+
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"genres": genres}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, err := app.models.Genres.Get(r.PathValue("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"genre": genre}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input genreCreateBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre := &data.Genre{
+		Slug:    input.Slug,
+		Name:    input.Name,
+		Aliases: input.Aliases,
+	}
+	if genre.Aliases == nil {
+		genre.Aliases = []string{}
+	}
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, genre, taxonomy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = app.models.Genres.Insert(genre); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddError("slug", "a genre with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", "/v1/genres/"+genre.Slug)
+
+	if err = app.writeJSON(w, envelope{"genre": genre}, http.StatusCreated, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateGenreHandler renames the genre. Changed slug is rewritten in all movies.
+func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	genre, err := app.models.Genres.Get(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input genreUpdateBody
+
+	if err = app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Slug != nil {
+		genre.Slug = *input.Slug
+	}
+	if input.Name != nil {
+		genre.Name = *input.Name
+	}
+	if input.Aliases != nil {
+		genre.Aliases = input.Aliases
+	}
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, genre, taxonomy.Without(slug)); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = app.models.Genres.Update(slug, genre, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddError("slug", "a genre with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"genre": genre}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeGenreHandler moves all movies of the genre to another one and deletes it
+func (app *application) mergeGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	var input genreMergeBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Into != "", "into", "must be provided")
+	v.Check(input.Into != slug, "into", "must differ from the merged genre")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, err := app.models.Genres.Get(slug); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	genre, err := app.models.Genres.Merge(slug, input.Into, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "must reference an existing genre")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"genre": genre}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
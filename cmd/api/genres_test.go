@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestGenres(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	editor := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+	admin := newActivatedUser(t, app, "bob@example.com", data.MoviesRead, data.MoviesWrite, data.Admin)
+
+	heat := &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime", "thriller"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(heat, 0))
+	seven := &data.Movie{Title: "Se7en", Year: 1995, Runtime: 127, Genres: data.Genres{"mystery", "thriller"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(seven, 0))
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		body    any
+		want    envelope
+		code    int
+	}{
+		{
+			name:    "create movie with unknown genre",
+			method:  http.MethodPost,
+			path:    "/v1/movies",
+			headers: editor,
+			body:    movieCreateBody{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"Science Fiction"}},
+			want: envelope{"error": map[string]string{
+				"genres": `must only contain known genres, "Science Fiction" is unknown, did you mean "sci-fi"?`,
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "create genre without permission",
+			method:  http.MethodPost,
+			path:    "/v1/genres",
+			headers: editor,
+			body:    genreCreateBody{Slug: "noir", Name: "Film Noir"},
+			want:    envelope{"error": "your user account doesn't have the necessary permissions to access this resource"},
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "create genre with taken alias",
+			method:  http.MethodPost,
+			path:    "/v1/genres",
+			headers: admin,
+			body:    genreCreateBody{Slug: "space-opera", Name: "Space Opera", Aliases: []string{"SciFi"}},
+			want:    envelope{"error": map[string]string{"aliases": `"SciFi" is already used by genre "sci-fi"`}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "create genre with invalid slug",
+			method:  http.MethodPost,
+			path:    "/v1/genres",
+			headers: admin,
+			body:    genreCreateBody{Slug: "Film Noir", Name: "Film Noir"},
+			want:    envelope{"error": map[string]string{"slug": "must only contain lowercase letters, digits and single hyphens"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "create genre",
+			method:  http.MethodPost,
+			path:    "/v1/genres",
+			headers: admin,
+			body:    genreCreateBody{Slug: "noir", Name: "Film Noir", Aliases: []string{"film-noir"}},
+			want:    envelope{"genre": data.Genre{Slug: "noir", Name: "Film Noir", Aliases: []string{"film-noir"}, Version: 1}},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "rename genre",
+			method:  http.MethodPatch,
+			path:    "/v1/genres/crime",
+			headers: admin,
+			body:    envelope{"slug": "crime-drama", "name": "Crime Drama"},
+			want: envelope{"genre": data.Genre{
+				Slug: "crime-drama", Name: "Crime Drama", Aliases: []string{}, MovieCount: 1, Version: 2,
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:    "merge genre into unknown one",
+			method:  http.MethodPost,
+			path:    "/v1/genres/thriller/merge",
+			headers: admin,
+			body:    genreMergeBody{Into: "suspense"},
+			want:    envelope{"error": map[string]string{"into": "must reference an existing genre"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "merge genre",
+			method:  http.MethodPost,
+			path:    "/v1/genres/thriller/merge",
+			headers: admin,
+			body:    genreMergeBody{Into: "mystery"},
+			want: envelope{"genre": data.Genre{
+				Slug: "mystery", Name: "Mystery", Aliases: []string{"thriller"}, MovieCount: 2, Version: 2,
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:    "get merged genre",
+			method:  http.MethodGet,
+			path:    "/v1/genres/thriller",
+			headers: editor,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "movies are rewritten",
+			method:  http.MethodGet,
+			path:    "/v1/movies?sort=id",
+			headers: editor,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+				"movies": []data.Movie{
+					{ID: 1, Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime-drama", "mystery"}, Version: 3},
+					{ID: 2, Title: "Se7en", Year: 1995, Runtime: 127, Genres: data.Genres{"mystery"}, Version: 2},
+				},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "old slug suggests the merged genre",
+			method:  http.MethodPatch,
+			path:    "/v1/movies/2",
+			headers: editor,
+			body:    envelope{"genres": []string{"thriller"}},
+			want: envelope{"error": map[string]string{
+				"genres": `must only contain known genres, "thriller" is unknown, did you mean "mystery"?`,
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,10 +9,12 @@ import (
 	"maps"
 	"net/http"
 	"net/url"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/julienschmidt/httprouter"
 	"github.com/shrtyk/greenlight/internal/data"
 	"github.com/shrtyk/greenlight/internal/validator"
 )
@@ -19,10 +22,163 @@ import (
 // Wrapper for http responses
 type envelope map[string]any
 
-func (app *application) readIDParam(r *http.Request) (int64, error) {
-	params := httprouter.ParamsFromContext(r.Context())
+// includeLoader loads a related resource of the resources with the given ids.
+// Resources without the related one are left out of the result.
+type includeLoader func(ids []int64) (map[int64]any, error)
+
+// embedded holds loaded related resources by include name and by id of the
+// resource they are embedded into
+type embedded map[string]map[int64]any
+
+// loadIncludes runs loaders of the included related resources
+func loadIncludes(loaders map[string]includeLoader, include []string, ids ...int64) (embedded, error) {
+	if len(include) == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+
+	e := make(embedded, len(include))
+	for _, name := range include {
+		resources, err := loaders[name](ids)
+		if err != nil {
+			return nil, err
+		}
+		e[name] = resources
+	}
+	return e, nil
+}
+
+// anyValues adapts results of repositories to includeLoader
+func anyValues[T any](m map[int64]T) map[int64]any {
+	values := make(map[int64]any, len(m))
+	for id, v := range m {
+		values[id] = v
+	}
+	return values
+}
+
+// sparseResource marshals a struct resource, or a slice of them, keeping only
+// the requested fields and appending embedded related resources. Resources are
+// matched with the embedded ones by their "id" field.
+type sparseResource struct {
+	value    any
+	fields   []string
+	embedded embedded
+}
+
+// sparse wraps the value to be written by writeJSON with only the fields (all
+// of them if fields is empty) and the embedded resources
+func sparse(value any, fields []string, embedded embedded) any {
+	if len(fields) == 0 && len(embedded) == 0 {
+		return value
+	}
+	return sparseResource{value: value, fields: fields, embedded: embedded}
+}
+
+func (s sparseResource) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	v := reflect.ValueOf(s.value)
+	if v.Kind() != reflect.Slice {
+		if err := s.project(&buf, v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteByte('[')
+	for i := range v.Len() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := s.project(&buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// project writes the struct as JSON object marshalling only the selected fields.
+// Fields are named and omitted the same way encoding/json does it.
+func (s sparseResource) project(buf *bytes.Buffer, v reflect.Value) error {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("can't select fields of %s", v.Type())
+	}
+
+	buf.WriteByte('{')
+	start := buf.Len()
+	write := func(key string, value any) error {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if buf.Len() > start {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(b)
+		return nil
+	}
+
+	var id int64
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field := v.Field(i)
+		if name == "id" && field.CanInt() {
+			id = field.Int()
+		}
+		if len(s.fields) > 0 && !slices.Contains(s.fields, name) {
+			continue
+		}
+		if slices.Contains(strings.Split(opts, ","), "omitempty") && isEmptyValue(field) {
+			continue
+		}
+		if err := write(name, field.Interface()); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.embedded)) {
+		resource, ok := s.embedded[name][id]
+		if !ok {
+			continue
+		}
+		if err := write(name, resource); err != nil {
+			return err
+		}
+	}
+
+	buf.WriteByte('}')
+	return nil
+}
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+// isEmptyValue reports whether the value is omitted by the omitempty option
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+func (app *application) readIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 	if err != nil || id < 1 {
 		return 0, errors.New("invalid id parameter")
 	}
@@ -117,6 +273,22 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue data.Gen
 	return data.Genres(strings.Split(csv, ","))
 }
 
+// readIDs reads comma separated ids reporting malformed ones to v
+func (app *application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	csv := app.readCSV(qs, key, nil)
+
+	ids := make([]int64, 0, len(csv))
+	for _, s := range csv {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || id < 1 {
+			v.AddError(key, "must contain comma separated positive integers")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	nStr := qs.Get(key)
 	if nStr == "" {
@@ -132,6 +304,92 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return n
 }
 
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	fStr := qs.Get(key)
+	if fStr == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(fStr, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return f
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	bStr := qs.Get(key)
+	if bStr == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(bStr)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readTime reads RFC 3339 timestamp. Absent key results in zero time.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	tStr := qs.Get(key)
+	if tStr == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, tStr)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return time.Time{}
+	}
+
+	return t
+}
+
+// readInclude reads comma separated names of related resources to embed into the
+// response. Names without a loader are reported to v.
+func (app *application) readInclude(qs url.Values, v *validator.Validator, loaders map[string]includeLoader) []string {
+	return app.readPermittedCSV(qs, "include", v, slices.Sorted(maps.Keys(loaders))...)
+}
+
+// readFields reads comma separated names of fields to keep in the response.
+// Names outside of permitted ones are reported to v.
+func (app *application) readFields(qs url.Values, v *validator.Validator, permitted ...string) []string {
+	return app.readPermittedCSV(qs, "fields", v, permitted...)
+}
+
+// readPermittedCSV reads comma separated values reporting ones outside of permitted to v
+func (app *application) readPermittedCSV(qs url.Values, key string, v *validator.Validator, permitted ...string) []string {
+	values := app.readCSV(qs, key, nil)
+	for _, value := range values {
+		if !validator.PermittedValue(value, permitted...) {
+			v.AddError(key, "must only contain "+strings.Join(permitted, ", "))
+			return nil
+		}
+	}
+	return values
+}
+
+// readCursor returns nil if key is absent so the caller falls back to page based pagination.
+// Present but empty key requests the first page in cursor mode.
+func (app *application) readCursor(qs url.Values, key string, v *validator.Validator) *data.Cursor {
+	if !qs.Has(key) {
+		return nil
+	}
+
+	cursor, err := data.DecodeCursor(qs.Get(key))
+	if err != nil {
+		v.AddError(key, "must be a valid cursor")
+		return nil
+	}
+
+	return cursor
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
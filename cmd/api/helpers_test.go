@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestSparseFieldsets(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	reader := newActivatedUser(t, app, "alice@example.com", data.MoviesRead)
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(moana, 0))
+	heat := &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(heat, 0))
+
+	director := &data.Person{Name: "Ron Clements"}
+	assertions.AssertNoError(t, app.models.People.Insert(director))
+	assertions.AssertNoError(t, app.models.Credits.SetForMovie(moana.ID, []*data.Credit{{PersonID: director.ID, Role: "director"}}))
+
+	type titleYear struct {
+		Title string `json:"title"`
+		Year  int32  `json:"year"`
+	}
+
+	cases := []struct {
+		name string
+		path string
+		want envelope
+		code int
+		etag string
+	}{
+		{
+			name: "list movies with fields",
+			path: "/v1/movies?fields=id,title,year",
+			want: envelope{
+				"movies": []struct {
+					ID    int64  `json:"id"`
+					Title string `json:"title"`
+					Year  int32  `json:"year"`
+				}{{1, "Moana", 2016}, {2, "Heat", 1995}},
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name: "get movie with fields",
+			path: "/v1/movies/2?fields=year,title",
+			want: envelope{"movie": titleYear{"Heat", 1995}},
+			code: http.StatusOK,
+			etag: `"2-1-title+year"`,
+		},
+		{
+			name: "get movie with same fields in other order",
+			path: "/v1/movies/2?fields=title,year,title",
+			want: envelope{"movie": titleYear{"Heat", 1995}},
+			code: http.StatusOK,
+			etag: `"2-1-title+year"`,
+		},
+		{
+			name: "get movie with other fields",
+			path: "/v1/movies/2?fields=id",
+			want: envelope{"movie": envelope{"id": 2}},
+			code: http.StatusOK,
+			etag: `"2-1-id"`,
+		},
+		{
+			name: "get movie with fields and includes",
+			path: "/v1/movies/1?fields=title,year&include=credits",
+			want: envelope{"movie": struct {
+				titleYear
+				Credits []*data.Credit `json:"credits"`
+			}{
+				titleYear{"Moana", 2016},
+				[]*data.Credit{{MovieID: 1, PersonID: 1, Name: "Ron Clements", Role: "director"}},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name: "get movie with unknown field",
+			path: "/v1/movies/1?fields=title,budget",
+			want: envelope{"error": map[string]string{
+				"fields": "must only contain id, title, original_title, year, runtime, genres, version, rating, rating_count, poster, external_ids, highlight",
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, reader)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			assertions.AssertStrings(t, rw.Header().Get("ETag"), c.etag)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+)
+
+type idempotencyCfg struct {
+	ttl         time.Duration
+	cleanupFreq time.Duration
+}
+
+// idempotencyResponseWriter passes the response through while recording it.
+// Only headers set by the wrapped handler are recorded: the inherited ones come
+// from outer middleware, such as CORS, and depend on the request.
+type idempotencyResponseWriter struct {
+	wrapped   http.ResponseWriter
+	inherited http.Header
+	status    int
+	header    http.Header
+	body      bytes.Buffer
+}
+
+func (iw *idempotencyResponseWriter) Header() http.Header {
+	return iw.wrapped.Header()
+}
+
+func (iw *idempotencyResponseWriter) WriteHeader(statusCode int) {
+	if iw.status == 0 {
+		iw.status = statusCode
+		iw.header = addedHeader(iw.inherited, iw.wrapped.Header())
+	}
+	iw.wrapped.WriteHeader(statusCode)
+}
+
+func (iw *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	if iw.status == 0 {
+		iw.WriteHeader(http.StatusOK)
+	}
+	iw.body.Write(b)
+	return iw.wrapped.Write(b)
+}
+
+func (iw *idempotencyResponseWriter) Unwrap() http.ResponseWriter {
+	return iw.wrapped
+}
+
+// addedHeader returns values of header that weren't there before. A key whose
+// earlier values were replaced is returned with all of its values.
+func addedHeader(before, header http.Header) http.Header {
+	added := make(http.Header)
+	for key, values := range header {
+		if n := len(before[key]); n <= len(values) && slices.Equal(values[:n], before[key]) {
+			values = values[n:]
+		}
+		if len(values) > 0 {
+			added[key] = slices.Clone(values)
+		}
+	}
+	return added
+}
+
+// idempotent makes the handler honour the Idempotency-Key header. The first
+// response to the key is recorded and replayed to retries of the same request
+// until the key expires. Server errors aren't recorded, so such requests can be
+// retried. Keys are scoped per user, so requests of anonymous users, who would
+// all share a single scope, are never recorded. Zero TTL disables idempotency
+// keys.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || app.config.idempotency.ttl <= 0 || app.contextGetUser(r).IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key header must not be more than 255 bytes long"))
+			return
+		}
+
+		maxBytes := 1_048_576
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesError):
+				app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		h := sha256.New()
+		fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+		h.Write(body)
+
+		record := &data.IdempotencyRecord{
+			UserID:      app.contextGetUser(r).ID,
+			Key:         key,
+			Fingerprint: h.Sum(nil),
+			ExpiresAt:   time.Now().Add(app.config.idempotency.ttl),
+		}
+
+		existing, err := app.models.Idempotency.Reserve(record)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound), existing != nil && existing.InProgress():
+			app.errorResponse(w, r, http.StatusConflict, "a request with the same Idempotency-Key is still in progress")
+			return
+		case existing != nil && !existing.Matches(record.Fingerprint):
+			app.errorResponse(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+			return
+		case existing != nil:
+			for key, values := range existing.Header {
+				for _, value := range values {
+					w.Header().Add(key, value)
+				}
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(existing.Status)
+			if _, err = w.Write(existing.Body); err != nil {
+				app.logger.Error("couldn't replay response", "err", err)
+			}
+			return
+		}
+
+		iw := &idempotencyResponseWriter{wrapped: w, inherited: w.Header().Clone()}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := app.models.Idempotency.Delete(record.UserID, record.Key); err != nil {
+				app.logger.Error("couldn't release idempotency key", "err", err)
+			}
+		}()
+
+		next.ServeHTTP(iw, r)
+
+		if iw.status == 0 || iw.status >= http.StatusInternalServerError {
+			return
+		}
+
+		record.Status = iw.status
+		record.Header = iw.header
+		record.Body = iw.body.Bytes()
+		if err = app.models.Idempotency.Complete(record); err != nil {
+			app.logger.Error("couldn't record idempotent response", "err", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// runIdempotencyCleanup periodically deletes expired idempotency keys
+func (app *application) runIdempotencyCleanup(ctx context.Context) {
+	if app.config.idempotency.ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.idempotency.cleanupFreq)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deleted, err := app.models.Idempotency.DeleteExpired(time.Now())
+			if err != nil {
+				app.logger.Error("couldn't delete expired idempotency keys", "err", err)
+				continue
+			}
+			if deleted > 0 {
+				app.logger.Info("deleted expired idempotency keys", "keys", deleted)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.idempotency.ttl = time.Hour
+	server := app.routes()
+
+	alice := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+	bob := newActivatedUser(t, app, "bob@example.com", data.MoviesRead, data.MoviesWrite)
+
+	moana := movieCreateBody{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation", "adventure"}}
+	coco := movieCreateBody{Title: "Coco", Year: 2017, Runtime: 105, Genres: []string{"animation"}}
+	tom := userCreateBody{Email: "tom@example.com", Name: "tom", Password: "pa55word"}
+
+	createdMoana := envelope{"movie": data.Movie{
+		ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation", "adventure"}, Version: 1,
+	}}
+	createdTom := envelope{"user": data.User{
+		ID: 3, Email: "tom@example.com", Name: "tom", CreatedAt: data.MockTimeStamp,
+	}}
+
+	cases := []struct {
+		name     string
+		path     string
+		headers  map[string][]string
+		key      string
+		body     any
+		want     envelope
+		code     int
+		replayed bool
+	}{
+		{
+			name:    "create movie",
+			path:    "/v1/movies",
+			headers: alice,
+			key:     "create-moana",
+			body:    moana,
+			want:    createdMoana,
+			code:    http.StatusCreated,
+		},
+		{
+			name:     "retry create movie",
+			path:     "/v1/movies",
+			headers:  alice,
+			key:      "create-moana",
+			body:     moana,
+			want:     createdMoana,
+			code:     http.StatusCreated,
+			replayed: true,
+		},
+		{
+			name:    "reuse key with different body",
+			path:    "/v1/movies",
+			headers: alice,
+			key:     "create-moana",
+			body:    coco,
+			want:    envelope{"error": "Idempotency-Key was already used with a different request"},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "same key of another user",
+			path:    "/v1/movies",
+			headers: bob,
+			key:     "create-moana",
+			body:    coco,
+			want: envelope{"movie": data.Movie{
+				ID: 2, Title: "Coco", Year: 2017, Runtime: 105, Genres: data.Genres{"animation"}, Version: 1,
+			}},
+			code: http.StatusCreated,
+		},
+		{
+			name:    "create movie without key",
+			path:    "/v1/movies",
+			headers: alice,
+			body:    moana,
+			want:    envelope{"error": map[string]string{"title": "a movie with this title and year already exists"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "too long key",
+			path:    "/v1/movies",
+			headers: alice,
+			key:     strings.Repeat("k", 256),
+			body:    moana,
+			want:    envelope{"error": "Idempotency-Key header must not be more than 255 bytes long"},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name: "register user",
+			path: "/v1/users",
+			key:  "register-tom",
+			body: tom,
+			want: createdTom,
+			code: http.StatusCreated,
+		},
+		{
+			name: "anonymous retry isn't replayed",
+			path: "/v1/users",
+			key:  "register-tom",
+			body: tom,
+			want: envelope{"error": map[string]string{"email": "a user with this email address already exists"}},
+			code: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+			if c.key != "" {
+				req.Header.Set("Idempotency-Key", c.key)
+			}
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+
+			replayed := rw.Header().Get("Idempotent-Replayed") == "true"
+			if replayed != c.replayed {
+				t.Errorf("got replayed %t, want %t", replayed, c.replayed)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyRequestHeaders(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.idempotency.ttl = time.Hour
+	app.config.cors.trustedOrigins = []string{"https://a.example.com", "https://b.example.com"}
+	server := app.routes()
+
+	alice := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+	moana := movieCreateBody{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+
+	for i, origin := range app.config.cors.trustedOrigins {
+		rw := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/v1/movies", helpers.MustJSON(t, moana))
+		assertions.AssertNoError(t, err)
+		setRequestHeaders(t, req, alice)
+		req.Header.Set("Idempotency-Key", "create-moana")
+		req.Header.Set("Origin", origin)
+
+		server.ServeHTTP(rw, req)
+
+		assertions.AssertStatusCode(t, rw.Code, http.StatusCreated)
+		if replayed := rw.Header().Get("Idempotent-Replayed") == "true"; replayed != (i > 0) {
+			t.Errorf("got replayed %t, want %t", replayed, i > 0)
+		}
+		if got := rw.Header().Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != origin {
+			t.Errorf("got Access-Control-Allow-Origin %q, want %q", got, origin)
+		}
+		if got := rw.Header().Values("Vary"); len(got) != len(slices.Compact(slices.Sorted(slices.Values(got)))) {
+			t.Errorf("got duplicated Vary values %q", got)
+		}
+		if got := rw.Header().Values("Location"); len(got) != 1 || got[0] != "/v1/movies/1" {
+			t.Errorf("got Location %q, want %q", got, "/v1/movies/1")
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+const (
+	maxImportBytes = 32 << 20
+	maxImportRows  = 50_000
+	// Number of valid movies inserted at once while the body is being read
+	importBatchSize = 500
+)
+
+const (
+	importModeAtomic     = "atomic"
+	importModeBestEffort = "best_effort"
+)
+
+var errTooManyImportRows = fmt.Errorf("body must not contain more than %d movies", maxImportRows)
+
+// importRow is a single parsed movie of an import body. CSV rows are numbered
+// from 1 not counting the header, NDJSON rows are numbered by line, blank lines
+// included.
+type importRow struct {
+	row    int
+	movie  *data.Movie
+	errors map[string]string
+}
+
+type importRowReport struct {
+	Row    int               `json:"row"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	Mode     string            `json:"mode"`
+	Total    int               `json:"total"`
+	Imported int               `json:"imported"`
+	Failed   int               `json:"failed"`
+	Rows     []importRowReport `json:"rows"`
+}
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	mode := app.readString(r.URL.Query(), "mode", importModeAtomic)
+	v.Check(validator.PermittedValue(mode, importModeAtomic, importModeBestEffort), "mode", "invalid mode value")
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	v.Check(
+		validator.PermittedValue(mediaType, "text/csv", "application/x-ndjson", "application/ndjson"),
+		"content_type",
+		"must be text/csv or application/x-ndjson",
+	)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var rd importReader
+	if mediaType == "text/csv" {
+		rd = newCSVImportReader(body, taxonomy)
+	} else {
+		rd = newNDJSONImportReader(body, taxonomy)
+	}
+
+	atomic := mode == importModeAtomic
+	imp, err := app.models.Movies.BeginImport(atomic, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer func() {
+		_ = imp.Rollback()
+	}()
+
+	report := importReport{Mode: mode, Rows: []importRowReport{}}
+
+	// Valid movies are inserted in batches of importBatchSize while the body is
+	// being read. Once an atomic import meets an invalid row it's rolled back
+	// and the rest of the body is only read to report the other invalid rows.
+	var (
+		batch        []*data.Movie
+		batchRows    []int
+		imported     []*data.Movie
+		importedRows []int
+		rolledBack   bool
+	)
+	insertBatch := func() error {
+		rowErrs, err := imp.Insert(batch)
+		if err != nil {
+			return err
+		}
+
+		for j, i := range batchRows {
+			switch {
+			case errors.Is(rowErrs[j], data.ErrMovieAlreadyExists):
+				report.Rows[i].Status = "failed"
+				report.Rows[i].Errors = map[string]string{"title": "a movie with this title and year already exists"}
+				report.Failed++
+			case rowErrs[j] != nil:
+				app.logError(r, fmt.Errorf("import row %d: %w", report.Rows[i].Row, rowErrs[j]))
+				report.Rows[i].Status = "failed"
+				report.Rows[i].Errors = map[string]string{"movie": "couldn't be saved"}
+				report.Failed++
+			default:
+				report.Rows[i].Status = "imported"
+				imported = append(imported, batch[j])
+				importedRows = append(importedRows, i)
+			}
+		}
+
+		batch, batchRows = batch[:0], batchRows[:0]
+		return nil
+	}
+
+	for {
+		row, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesError):
+				app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		if len(report.Rows) == maxImportRows {
+			app.badRequestResponse(w, r, errTooManyImportRows)
+			return
+		}
+
+		i := len(report.Rows)
+		report.Rows = append(report.Rows, importRowReport{Row: row.row, Errors: row.errors})
+
+		switch {
+		case row.errors != nil:
+			report.Rows[i].Status = "invalid"
+			report.Failed++
+			if atomic && !rolledBack {
+				_ = imp.Rollback()
+				rolledBack = true
+			}
+			continue
+		case rolledBack:
+			report.Rows[i].Status = "skipped"
+			continue
+		}
+
+		batch = append(batch, row.movie)
+		batchRows = append(batchRows, i)
+		if len(batch) == importBatchSize {
+			if err = insertBatch(); err != nil {
+				app.importFailedResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	report.Total = len(report.Rows)
+	if report.Total == 0 {
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
+		return
+	}
+
+	if rolledBack {
+		for _, i := range append(importedRows, batchRows...) {
+			report.Rows[i].Status = "skipped"
+		}
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	if len(batch) > 0 {
+		if err = insertBatch(); err != nil {
+			app.importFailedResponse(w, r, err)
+			return
+		}
+	}
+
+	if err = imp.Commit(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for j, i := range importedRows {
+		report.Rows[i].ID = imported[j].ID
+	}
+	report.Imported = len(imported)
+
+	status := http.StatusCreated
+	if report.Failed > 0 {
+		status = http.StatusOK
+	}
+
+	if err = app.writeJSON(w, envelope{"report": report}, status, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importFailedResponse responds to an error of inserting a batch of imported movies
+func (app *application) importFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrMovieAlreadyExists):
+		app.errorResponse(w, r, http.StatusConflict, "import contains an already existing movie, nothing was imported")
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newImportRow validates the parsed movie. Any errors found while parsing the
+// row must be already stored in v.
+func newImportRow(n int, movie *data.Movie, v *validator.Validator, taxonomy *data.Taxonomy) importRow {
+	if v.Valid() {
+		data.ValidateMovie(v, movie, taxonomy)
+	}
+
+	row := importRow{row: n, movie: movie}
+	if !v.Valid() {
+		row.errors = v.Errors
+	}
+	return row
+}
+
+// importReader reads movies of an import body one at a time. Read returns
+// io.EOF after the last movie.
+type importReader interface {
+	Read() (importRow, error)
+}
+
+// csvImportReader reads CSV body with a header row naming title, year, runtime
+// and genres columns in any order. Runtime is a number of minutes and genres are
+// separated by "|".
+type csvImportReader struct {
+	rd       *csv.Reader
+	taxonomy *data.Taxonomy
+	header   []string
+	columns  map[string]int
+	n        int
+}
+
+func newCSVImportReader(body io.Reader, taxonomy *data.Taxonomy) *csvImportReader {
+	rd := csv.NewReader(body)
+	rd.ReuseRecord = true
+	return &csvImportReader{rd: rd, taxonomy: taxonomy}
+}
+
+func (cr *csvImportReader) Read() (importRow, error) {
+	if cr.columns == nil {
+		if err := cr.readHeader(); err != nil {
+			return importRow{}, err
+		}
+	}
+
+	record, err := cr.rd.Read()
+	if errors.Is(err, io.EOF) {
+		return importRow{}, io.EOF
+	}
+	cr.n++
+
+	v := validator.New()
+	movie := new(data.Movie)
+
+	switch {
+	case errors.Is(err, csv.ErrFieldCount):
+		v.AddError("row", fmt.Sprintf("must contain %d fields", len(cr.header)))
+	case err != nil:
+		return importRow{}, fmt.Errorf("body contains badly-formed CSV: %w", err)
+	default:
+		movie.Title = record[cr.columns["title"]]
+
+		year, err := strconv.ParseInt(strings.TrimSpace(record[cr.columns["year"]]), 10, 32)
+		v.Check(err == nil, "year", "must be an integer value")
+		movie.Year = int32(year)
+
+		runtime, err := strconv.ParseInt(strings.TrimSpace(record[cr.columns["runtime"]]), 10, 32)
+		v.Check(err == nil, "runtime", "must be an integer number of minutes")
+		movie.Runtime = data.Runtime(runtime)
+
+		if genres := strings.TrimSpace(record[cr.columns["genres"]]); genres != "" {
+			movie.Genres = strings.Split(genres, "|")
+		}
+	}
+
+	return newImportRow(cr.n, movie, v, cr.taxonomy), nil
+}
+
+func (cr *csvImportReader) readHeader() error {
+	header, err := cr.rd.Read()
+	if err != nil {
+		return err
+	}
+
+	// The header is kept for error messages, so it must outlive the reused record
+	cr.header = slices.Clone(header)
+	cr.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		cr.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := cr.columns[name]; !ok {
+			return fmt.Errorf("csv header must contain %q column", name)
+		}
+	}
+	return nil
+}
+
+// ndjsonImportReader reads newline delimited JSON body. Every non-empty line
+// holds a movie in the same format as accepted by createMovieHandler.
+type ndjsonImportReader struct {
+	sc       *bufio.Scanner
+	taxonomy *data.Taxonomy
+	line     int
+}
+
+func newNDJSONImportReader(body io.Reader, taxonomy *data.Taxonomy) *ndjsonImportReader {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+	return &ndjsonImportReader{sc: sc, taxonomy: taxonomy}
+}
+
+func (nr *ndjsonImportReader) Read() (importRow, error) {
+	for nr.sc.Scan() {
+		nr.line++
+
+		line := nr.sc.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var input movieCreateBody
+		v := validator.New()
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&input); err != nil {
+			v.AddError("row", "must be a valid JSON movie object")
+		}
+
+		movie := &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+		}
+
+		return newImportRow(nr.line, movie, v, nr.taxonomy), nil
+	}
+
+	if err := nr.sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return importRow{}, errors.New("body contains a line longer than 1048576 bytes")
+		}
+		return importRow{}, err
+	}
+
+	return importRow{}, io.EOF
+}
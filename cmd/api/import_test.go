@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func TestImportMovies(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+	headers := newActivatedUser(t, app, "bob@example.com", data.MoviesRead, data.MoviesWrite)
+
+	cases := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		code        int
+		wantStatus  []string
+		wantRows    []int
+	}{
+		{
+			name:        "csv with invalid row in atomic mode",
+			path:        "/v1/movies/import",
+			contentType: "text/csv",
+			body: "title,year,runtime,genres\n" +
+				"Moana,2016,107,animation|adventure\n" +
+				"Deadpool,year,108,action\n",
+			code:       http.StatusUnprocessableEntity,
+			wantStatus: []string{"skipped", "invalid"},
+			wantRows:   []int{1, 2},
+		},
+		{
+			name:        "csv in atomic mode",
+			path:        "/v1/movies/import",
+			contentType: "text/csv; charset=utf-8",
+			body: "genres,title,runtime,year\n" +
+				"animation|adventure,Moana,107,2016\n" +
+				"action|comedy,Deadpool,108,2016\n",
+			code:       http.StatusCreated,
+			wantStatus: []string{"imported", "imported"},
+			wantRows:   []int{1, 2},
+		},
+		{
+			name:        "ndjson in best effort mode",
+			path:        "/v1/movies/import?mode=best_effort",
+			contentType: "application/x-ndjson",
+			body: `{"title":"Black Panther","year":2018,"runtime":"134 mins","genres":["action"]}` + "\n" +
+				`{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation"]}` + "\n" +
+				"\n" +
+				`{"title":"Up","year":2009,"runtime":96}` + "\n" +
+				`{"title":"Heat","year":1995,"runtime":"170 mins","genres":["crime"],"extra":1}` + "\n",
+			code:       http.StatusOK,
+			wantStatus: []string{"imported", "failed", "invalid", "invalid"},
+			wantRows:   []int{1, 2, 4, 5},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, c.path, strings.NewReader(c.body))
+			assertions.AssertNoError(t, err)
+
+			setRequestHeaders(t, req, headers)
+			req.Header.Set("Content-Type", c.contentType)
+
+			server.ServeHTTP(rw, req)
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+
+			var resp map[string]importReport
+			assertions.AssertNoError(t, json.NewDecoder(rw.Body).Decode(&resp))
+
+			report, ok := resp["report"]
+			if !ok {
+				report = resp["error"]
+			}
+
+			gotStatus := make([]string, len(report.Rows))
+			gotRows := make([]int, len(report.Rows))
+			for i, row := range report.Rows {
+				gotStatus[i] = row.Status
+				gotRows[i] = row.Row
+			}
+			assertions.AssertStrings(t, strings.Join(gotStatus, ","), strings.Join(c.wantStatus, ","))
+			if !slices.Equal(gotRows, c.wantRows) {
+				t.Errorf("got rows %v, want %v", gotRows, c.wantRows)
+			}
+		})
+	}
+
+	movies, _, err := app.models.Movies.GetAll(data.MovieFilters{}, data.Filters{
+		Page: 1, PageSize: 10, Sort: "id", SortSafelist: []string{"id"},
+	})
+	assertions.AssertNoError(t, err)
+	if len(movies) != 3 {
+		t.Errorf("expected 3 imported movies, got %d", len(movies))
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+// Maximal number of Accept-Language entries taken into account
+const maxAcceptLanguages = 10
+
+type localizationBody struct {
+	Titles       map[string]string `json:"titles"`
+	ReleaseDates map[string]string `json:"release_dates"`
+}
+
+// readLanguages returns languages the client prefers for movie titles, the lang
+// query parameter taking precedence over Accept-Language header. Responses
+// always vary by the header, so it's added to Vary.
+func (app *application) readLanguages(w http.ResponseWriter, r *http.Request, v *validator.Validator) []string {
+	w.Header().Add("Vary", "Accept-Language")
+
+	qs := r.URL.Query()
+	if qs.Has("lang") {
+		lang := qs.Get("lang")
+		v.Check(validator.Matches(lang, data.LocaleRX), "lang", "must be a valid locale, e.g. pt-BR")
+		return []string{lang}
+	}
+
+	return parseAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// parseAcceptLanguage returns language tags of the header ordered by their
+// quality. Wildcards and malformed entries are skipped.
+func parseAcceptLanguage(header string) []string {
+	type entry struct {
+		tag string
+		q   float64
+	}
+
+	var entries []entry
+	for part := range strings.SplitSeq(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		entries = append(entries, entry{tag: tag, q: q})
+		if len(entries) == maxAcceptLanguages {
+			break
+		}
+	}
+
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	langs := make([]string, len(entries))
+	for i, e := range entries {
+		langs[i] = e.tag
+	}
+	return langs
+}
+
+// matchLocale picks the locale of titles best matching the preferred languages.
+// A language matches its exact locale first, then the locale of its base
+// language and then any locale of the same base language, e.g. "pt-PT" matches
+// "pt-PT", "pt" and "pt-BR" in that order.
+func matchLocale(titles map[string]string, langs []string) (string, bool) {
+	locales := slices.Sorted(maps.Keys(titles))
+	base := func(tag string) string {
+		b, _, _ := strings.Cut(tag, "-")
+		return b
+	}
+
+	for _, lang := range langs {
+		if i := slices.IndexFunc(locales, func(l string) bool { return strings.EqualFold(l, lang) }); i != -1 {
+			return locales[i], true
+		}
+		if i := slices.IndexFunc(locales, func(l string) bool { return strings.EqualFold(l, base(lang)) }); i != -1 {
+			return locales[i], true
+		}
+		if i := slices.IndexFunc(locales, func(l string) bool { return strings.EqualFold(base(l), base(lang)) }); i != -1 {
+			return locales[i], true
+		}
+	}
+
+	return "", false
+}
+
+// localizeMovies replaces titles of the movies with alternate ones matching the
+// preferred languages. The original title is kept in OriginalTitle.
+func (app *application) localizeMovies(langs []string, movies ...*data.Movie) error {
+	if len(langs) == 0 || len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	localizations, err := app.models.Localizations.GetForMovies(ids...)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		l, ok := localizations[movie.ID]
+		if !ok {
+			continue
+		}
+		if locale, ok := matchLocale(l.Titles, langs); ok && l.Titles[locale] != movie.Title {
+			movie.OriginalTitle = movie.Title
+			movie.Title = l.Titles[locale]
+		}
+	}
+	return nil
+}
+
+func (app *application) getMovieLocalizationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err = app.models.Movies.GetByID(id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeMovieLocalization(w, r, id)
+}
+
+// setMovieLocalizationHandler replaces alternate titles and release dates of
+// the movie
+func (app *application) setMovieLocalizationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err = app.models.Movies.GetByID(id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input localizationBody
+
+	if err = app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	localization := &data.Localization{Titles: input.Titles, ReleaseDates: input.ReleaseDates}
+	if localization.Titles == nil {
+		localization.Titles = map[string]string{}
+	}
+	if localization.ReleaseDates == nil {
+		localization.ReleaseDates = map[string]string{}
+	}
+
+	v := validator.New()
+	if data.ValidateLocalization(v, localization); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = app.models.Localizations.SetForMovie(id, localization); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeMovieLocalization(w, r, id)
+}
+
+func (app *application) writeMovieLocalization(w http.ResponseWriter, r *http.Request, movieID int64) {
+	localizations, err := app.models.Localizations.GetForMovies(movieID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	localization, ok := localizations[movieID]
+	if !ok {
+		localization = &data.Localization{Titles: map[string]string{}, ReleaseDates: map[string]string{}}
+	}
+
+	if err = app.writeJSON(w, envelope{"localization": localization}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
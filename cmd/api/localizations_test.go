@@ -0,0 +1,233 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestMovieLocalization(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	editor := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+
+	godfather := &data.Movie{Title: "The Godfather", Year: 1972, Runtime: 175, Genres: data.Genres{"crime"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(godfather, 0))
+	heat := &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(heat, 0))
+
+	localization := data.Localization{
+		Titles:       map[string]string{"de": "Der Pate", "pt-BR": "O Poderoso Chefão"},
+		ReleaseDates: map[string]string{"US": "1972-03-24", "DE": "1972-08-24"},
+	}
+
+	localized := func(title string) data.Movie {
+		movie := *godfather
+		movie.Title = title
+		movie.OriginalTitle = godfather.Title
+		return movie
+	}
+
+	included := struct {
+		data.Movie
+		Localization data.Localization `json:"localization"`
+	}{*godfather, localization}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		body    any
+		want    envelope
+		code    int
+	}{
+		{
+			name:   "set localization",
+			method: http.MethodPut,
+			path:   "/v1/movies/1/localization",
+			body:   localizationBody{Titles: localization.Titles, ReleaseDates: localization.ReleaseDates},
+			want:   envelope{"localization": localization},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "set invalid localization",
+			method: http.MethodPut,
+			path:   "/v1/movies/2/localization",
+			body: localizationBody{
+				Titles:       map[string]string{"german": "Heat"},
+				ReleaseDates: map[string]string{"US": "15.12.1995"},
+			},
+			want: envelope{"error": map[string]string{
+				"titles.german":    "must be keyed by a valid locale, e.g. pt-BR",
+				"release_dates.US": "must be a date in YYYY-MM-DD format",
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "set localization of unknown movie",
+			method: http.MethodPut,
+			path:   "/v1/movies/99/localization",
+			body:   localizationBody{},
+			want:   envelope{"error": "the requested resource could not be found"},
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "get localization",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/localization",
+			want:   envelope{"localization": localization},
+			code:   http.StatusOK,
+		},
+		{
+			name:    "get movie in regional variant of available language",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1",
+			headers: map[string][]string{"Accept-Language": {"fr;q=0.5, pt-PT"}},
+			want:    envelope{"movie": localized("O Poderoso Chefão")},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "get movie with lang overriding header",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1?lang=de",
+			headers: map[string][]string{"Accept-Language": {"pt-BR"}},
+			want:    envelope{"movie": localized("Der Pate")},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "get movie in unavailable language",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1",
+			headers: map[string][]string{"Accept-Language": {"fr, *;q=0.1"}},
+			want:    envelope{"movie": godfather},
+			code:    http.StatusOK,
+		},
+		{
+			name:   "get movie with invalid lang",
+			method: http.MethodGet,
+			path:   "/v1/movies/1?lang=German",
+			want:   envelope{"error": map[string]string{"lang": "must be a valid locale, e.g. pt-BR"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "get movie with localization included",
+			method: http.MethodGet,
+			path:   "/v1/movies/1?include=localization",
+			want:   envelope{"movie": included},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "search alternate titles",
+			method: http.MethodGet,
+			path:   "/v1/movies?title=pate",
+			want: envelope{
+				"movies":   []*data.Movie{godfather},
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "search alternate titles in requested language",
+			method: http.MethodGet,
+			path:   "/v1/movies?title=poderoso&lang=pt-BR",
+			want: envelope{
+				"movies":   []data.Movie{localized("O Poderoso Chefão")},
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			code: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, editor)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			if c.method == http.MethodGet && c.path == "/v1/movies/1" && !slices.Contains(rw.Header().Values("Vary"), "Accept-Language") {
+				t.Errorf("got Vary %q, want it to contain Accept-Language", rw.Header().Values("Vary"))
+			}
+		})
+	}
+
+	t.Run("localized movie is cached", func(t *testing.T) {
+		get := func(t *testing.T, match string) *httptest.ResponseRecorder {
+			t.Helper()
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+			setRequestHeaders(t, req, editor)
+			req.Header.Set("Accept-Language", "de-DE, en;q=0.5")
+			if match != "" {
+				req.Header.Set("If-None-Match", match)
+			}
+			server.ServeHTTP(rw, req)
+			return rw
+		}
+
+		rw := get(t, "")
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+		etag := rw.Header().Get("ETag")
+		if !strings.HasPrefix(etag, `W/"1-1-`) {
+			t.Fatalf("got ETag %q, want weak tag of the localized movie", etag)
+		}
+
+		rw = get(t, etag)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusNotModified)
+		assertions.AssertStrings(t, rw.Header().Get("ETag"), etag)
+		if !slices.Contains(rw.Header().Values("Vary"), "Accept-Language") {
+			t.Errorf("got Vary %q, want it to contain Accept-Language", rw.Header().Values("Vary"))
+		}
+
+		// Alternate titles don't bump the movie version, but change the tag
+		titles := map[string]string{"de": "Der Pate (1972)"}
+		assertions.AssertNoError(t, app.models.Localizations.SetForMovie(1, &data.Localization{Titles: titles}))
+
+		rw = get(t, etag)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+	})
+}
+
+func TestMatchLocale(t *testing.T) {
+	titles := map[string]string{"de": "Der Pate", "pt-BR": "O Poderoso Chefão", "zh-Hant-TW": "教父"}
+
+	cases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "exact locale", header: "pt-BR", want: "pt-BR"},
+		{name: "case insensitive", header: "PT-br", want: "pt-BR"},
+		{name: "base language", header: "de-AT", want: "de"},
+		{name: "other region of the language", header: "pt-PT", want: "pt-BR"},
+		{name: "quality order", header: "de;q=0.4, fr, pt;q=0.8", want: "pt-BR"},
+		{name: "zero quality", header: "de;q=0, fr", want: ""},
+		{name: "wildcard", header: "*", want: ""},
+		{name: "script and region", header: "zh-Hant-TW", want: "zh-Hant-TW"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, _ := matchLocale(titles, parseAcceptLanguage(c.header))
+			assertions.AssertStrings(t, got, c.want)
+		})
+	}
+}
@@ -36,6 +36,12 @@ func main() {
 		cfg.smtp.sender,
 	)
 
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	db, err := openPostgresDB(cfg)
 	if err != nil {
 		logger.Error(err.Error())
@@ -56,6 +62,8 @@ func main() {
 		withRateLimiter(rateLimiter),
 		withMailer(mailer),
 		withModels(data.NewModels(db)),
+		withBlobStore(blobs),
+		withWebhookClient(newWebhookClient(cfg.webhooks.timeout)),
 	)
 
 	app.initBasicMetrics(db)
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
 
 	"github.com/shrtyk/greenlight/internal/data"
 	"github.com/shrtyk/greenlight/internal/validator"
@@ -29,10 +31,74 @@ type movieGetAllBody struct {
 	data.Filters
 }
 
+// maxBatchIDs is the maximal number of movies fetched at once by their ids
+const maxBatchIDs = 100
+
+// movieFields are fields movie responses can be narrowed down to
+var movieFields = []string{
+	"id", "title", "original_title", "year", "runtime", "genres", "version",
+	"rating", "rating_count", "poster", "external_ids", "highlight",
+}
+
+// movieIncludes returns loaders of related resources which can be embedded into
+// movie responses
+func (app *application) movieIncludes() map[string]includeLoader {
+	return map[string]includeLoader{
+		"credits": func(ids []int64) (map[int64]any, error) {
+			credits, err := app.models.Credits.GetForMovies(ids...)
+			return anyValues(credits), err
+		},
+		"localization": func(ids []int64) (map[int64]any, error) {
+			localizations, err := app.models.Localizations.GetForMovies(ids...)
+			return anyValues(localizations), err
+		},
+	}
+}
+
+// readMovieFilters reads filters shared by movie listings and exports
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) data.MovieFilters {
+	var f data.MovieFilters
+
+	f.Title = app.readString(qs, "title", "")
+	f.Genres = app.readCSV(qs, "genres", data.Genres{})
+	f.PersonID = int64(app.readInt(qs, "person_id", 0, v))
+	f.MinRating = app.readInt(qs, "min_rating", 0, v)
+	f.GenresAny = app.readCSV(qs, "genres_any", data.Genres{})
+	f.GenresExclude = app.readCSV(qs, "genres_exclude", data.Genres{})
+	f.YearMin = app.readInt(qs, "year_min", 0, v)
+	f.YearMax = app.readInt(qs, "year_max", 0, v)
+	f.RuntimeMin = app.readInt(qs, "runtime_min", 0, v)
+	f.RuntimeMax = app.readInt(qs, "runtime_max", 0, v)
+	f.CreatedAfter = app.readTime(qs, "created_after", v)
+	f.CreatedBefore = app.readTime(qs, "created_before", v)
+	f.CollectionID = int64(app.readInt(qs, "collection_id", 0, v))
+
+	v.Check(f.PersonID >= 0, "person_id", "must be a positive integer")
+	v.Check(f.CollectionID >= 0, "collection_id", "must be a positive integer")
+	v.Check(!qs.Has("min_rating") || f.MinRating >= 1 && f.MinRating <= 10, "min_rating", "must be between 1 and 10")
+
+	v.Check(f.YearMin >= 0, "year_min", "must be a positive integer")
+	v.Check(f.YearMax >= 0, "year_max", "must be a positive integer")
+	v.Check(f.YearMax == 0 || f.YearMin <= f.YearMax, "year_max", "must not be less than year_min")
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must be a positive integer")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must be a positive integer")
+	v.Check(f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+	v.Check(f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_before", "must be later than created_after")
+
+	v.Check(len(f.GenresAny) <= 20, "genres_any", "must not contain more than 20 genres")
+	v.Check(len(f.GenresExclude) <= 20, "genres_exclude", "must not contain more than 20 genres")
+
+	return f
+}
+
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("ids") {
+		app.getMoviesByIDs(w, r)
+		return
+	}
+
 	var input struct {
-		Title  string
-		Genres data.Genres
+		data.MovieFilters
 		data.Filters
 	}
 
@@ -40,16 +106,38 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", data.Genres{})
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.Highlight = app.readBool(qs, "highlight", false, v)
+	includes := app.movieIncludes()
+	include := app.readInclude(qs, v, includes)
+	fields := app.readFields(qs, v, movieFields...)
+	langs := app.readLanguages(w, r, v)
+	facets := app.readPermittedCSV(qs, "facets", v, data.MovieFacets...)
 
 	input.Page = app.readInt(qs, "page", 1, v)
 	input.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Sort = app.readString(qs, "sort", "id")
+	input.Cursor = app.readCursor(qs, "cursor", v)
+
+	defaultSort := "id"
+	if input.Cursor != nil && input.Cursor.Sort != "" {
+		defaultSort = input.Cursor.Sort
+	}
+	input.Sort = app.readString(qs, "sort", defaultSort)
 
 	input.SortSafelist = []string{
-		"id", "title", "year", "runtime",
-		"-id", "-title", "-year", "-runtime",
+		"id", "title", "year", "runtime", "rating", "relevance",
+		"-id", "-title", "-year", "-runtime", "-rating",
+	}
+
+	// Relevance isn't a column, so it can't be used as a keyset
+	if input.Sort == "relevance" {
+		v.Check(input.Title != "", "title", "must be provided to sort by relevance")
+		v.Check(input.Cursor == nil, "cursor", "must not be used with relevance sort")
+	}
+
+	if err := app.checkCollectionFilter(r, input.CollectionID, v); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	if input.Validate(v); !v.Valid() {
@@ -57,18 +145,106 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieFilters, input.Filters, fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrCloseRows):
 			app.logError(r, err)
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+			return
 		default:
 			app.serverErrorResponse(w, r, err)
 			return
 		}
 	}
 
-	if err = app.writeJSON(w, envelope{"movies": movies, "metadata": metadata}, http.StatusOK, nil); err != nil {
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	embedded, err := loadIncludes(includes, include, ids...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.localizeMovies(langs, movies...); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"movies": sparse(movies, fields, embedded), "metadata": metadata}
+
+	if len(facets) > 0 {
+		env["facets"], err = app.models.Movies.Facets(input.MovieFilters, facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if err = app.writeJSON(w, env, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getMoviesByIDs responds with movies listed in the ids query parameter in the
+// requested order, along with ids of the missing ones. Filters and pagination
+// don't apply to it.
+func (app *application) getMoviesByIDs(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	ids := app.readIDs(qs, "ids", v)
+	includes := app.movieIncludes()
+	include := app.readInclude(qs, v, includes)
+	fields := app.readFields(qs, v, movieFields...)
+	langs := app.readLanguages(w, r, v)
+
+	v.Check(len(ids) > 0, "ids", "must be provided")
+	v.Check(len(ids) <= maxBatchIDs, "ids", fmt.Sprintf("must not contain more than %d ids", maxBatchIDs))
+	v.Check(validator.Unique(ids), "ids", "must not contain duplicate ids")
+	for key := range qs {
+		v.Check(validator.PermittedValue(key, "ids", "include", "fields", "lang"), key, "must not be used along with ids")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.models.Movies.GetByIDs(ids, fields...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	found := make([]int64, len(movies))
+	for i, movie := range movies {
+		found[i] = movie.ID
+	}
+
+	missing := make([]int64, 0, len(ids)-len(movies))
+	for _, id := range ids {
+		if !slices.Contains(found, id) {
+			missing = append(missing, id)
+		}
+	}
+
+	embedded, err := loadIncludes(includes, include, found...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.localizeMovies(langs, movies...); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"movies": sparse(movies, fields, embedded), "missing": missing}
+	if err = app.writeJSON(w, env, http.StatusOK, nil); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -93,20 +269,33 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Genres:  input.Genres,
 	}
 
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
-	data.ValidateMovie(v, movie)
+	data.ValidateMovie(v, movie, taxonomy)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	if err := app.models.Movies.Insert(movie); err != nil {
-		app.serverErrorResponse(w, r, err)
+	if err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrMovieAlreadyExists):
+			v.AddError("title", "a movie with this title and year already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie))
 
 	if err := app.writeJSON(w, envelope{"movie": movie}, http.StatusCreated, headers); err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -120,18 +309,59 @@ func (app *application) getMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.GetByID(id)
+	v := validator.New()
+
+	qs := r.URL.Query()
+	includes := app.movieIncludes()
+	include := app.readInclude(qs, v, includes)
+	fields := app.readFields(qs, v, movieFields...)
+	langs := app.readLanguages(w, r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByID(id, fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.redirectMergedMovie(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	if err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, nil); err != nil {
+	if err = app.localizeMovies(langs, movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// ETag only covers movie's own fields, so it's not sent along with embedded
+	// resources, which may change without bumping the movie version
+	if len(include) > 0 {
+		embedded, err := loadIncludes(includes, include, movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if err = app.writeJSON(w, envelope{"movie": sparse(movie, fields, embedded)}, http.StatusOK, nil); err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	etag := localizedMovieETag(movie, fields)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	if err = app.writeJSON(w, envelope{"movie": sparse(movie, fields, nil)}, http.StatusOK, headers); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -154,35 +384,60 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var input movieUpdateBody
-
-	if err = app.readJSON(w, r, &input); err != nil {
-		app.badRequestResponse(w, r, err)
+	if !app.checkIfMatch(w, r, movie) {
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+	switch requestMediaType(r) {
+	case mergePatchType, jsonPatchType:
+		if !app.patchMovie(w, r, movie) {
+			return
+		}
+	case "", "application/json":
+		var input movieUpdateBody
+
+		if err = app.readJSON(w, r, &input); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, taxonomy); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	if err = app.models.Movies.Update(movie); err != nil {
+	if err = app.models.Movies.Update(movie, app.contextGetUser(r).ID); err != nil {
 		switch {
+		case errors.Is(err, data.ErrMovieAlreadyExists):
+			v.AddError("title", "a movie with this title and year already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -191,7 +446,10 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, envelope{"movie": movie}, http.StatusCreated, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, envelope{"movie": movie}, http.StatusCreated, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -204,7 +462,8 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err = app.models.Movies.Delete(id); err != nil {
+	movie, err := app.models.Movies.GetByID(id)
+	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
@@ -214,6 +473,24 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !app.checkIfMatch(w, r, movie) {
+		return
+	}
+
+	if err = app.models.Movies.Delete(movie, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	// Following response is user friendly. Change response body to nil and status code to No Content if needed
 	err = app.writeJSON(w, envelope{"message:": "movie successfully deleted"}, http.StatusOK, nil)
 	if err != nil {
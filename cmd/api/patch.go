@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/patch"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// movieDocument is the part of a movie patches are applied to. Version can't be
+// changed, but JSON Patch can test it and merge patches may repeat it.
+type movieDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+	Version int32        `json:"version"`
+}
+
+// requestMediaType returns the media type of the request body without parameters
+func requestMediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return r.Header.Get("Content-Type")
+	}
+	return mediaType
+}
+
+// patchMovie applies the merge patch or the JSON patch of the request body to
+// the movie. It returns false if a response was written.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	b, err := json.Marshal(movieDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+		Version: movie.Version,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	var doc any
+	if err = json.Unmarshal(b, &doc); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	switch requestMediaType(r) {
+	case mergePatchType:
+		var mergePatch map[string]any
+		if err = app.readJSON(w, r, &mergePatch); err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+		doc = patch.MergePatch(doc, mergePatch)
+	default:
+		var ops []patch.Operation
+		if err = app.readJSON(w, r, &ops); err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+
+		if doc, err = patch.Apply(doc, ops); err != nil {
+			switch {
+			case errors.Is(err, patch.ErrTestFailed):
+				app.errorResponse(w, r, http.StatusConflict, err.Error())
+			default:
+				app.failedValidationResponse(w, r, map[string]string{"patch": err.Error()})
+			}
+			return false
+		}
+	}
+
+	if b, err = json.Marshal(doc); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	var patched movieDocument
+	if err = dec.Decode(&patched); err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			app.failedValidationResponse(w, r, map[string]string{unmarshalTypeError.Field: "has incorrect JSON type"})
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			app.failedValidationResponse(w, r, map[string]string{"runtime": `must be in "<minutes> mins" format`})
+		default:
+			app.failedValidationResponse(w, r, map[string]string{"patch": "must only change title, year, runtime and genres"})
+		}
+		return false
+	}
+
+	if patched.Version != movie.Version {
+		app.editConflictResponse(w, r)
+		return false
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+	return true
+}
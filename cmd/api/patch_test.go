@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestPatchMovie(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	editor := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation", "adventure"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(moana, 0))
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		want        envelope
+		code        int
+	}{
+		{
+			name:        "merge patch",
+			contentType: "application/merge-patch+json",
+			body:        `{"runtime": "110 mins", "version": 1}`,
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "Moana", Year: 2016, Runtime: 110, Genres: data.Genres{"animation", "adventure"}, Version: 2,
+			}},
+			code: http.StatusCreated,
+		},
+		{
+			name:        "merge patch removing genres",
+			contentType: "application/merge-patch+json",
+			body:        `{"genres": null}`,
+			want:        envelope{"error": map[string]string{"genres": "must be provided"}},
+			code:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "merge patch with stale version",
+			contentType: "application/merge-patch+json",
+			body:        `{"title": "Vaiana", "version": 1}`,
+			want:        envelope{"error": "unable to update the record due to an edit conflict, please try again"},
+			code:        http.StatusConflict,
+		},
+		{
+			name:        "merge patch which isn't an object",
+			contentType: "application/merge-patch+json; charset=utf-8",
+			body:        `["title"]`,
+			want:        envelope{"error": "body contains incorrect JSON type (at character 1)"},
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "json patch",
+			contentType: "application/json-patch+json",
+			body: `[
+				{"op": "test", "path": "/version", "value": 2},
+				{"op": "add", "path": "/genres/-", "value": "comedy"},
+				{"op": "remove", "path": "/genres/0"}
+			]`,
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "Moana", Year: 2016, Runtime: 110, Genres: data.Genres{"adventure", "comedy"}, Version: 3,
+			}},
+			code: http.StatusCreated,
+		},
+		{
+			name:        "json patch testing stale version",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/version", "value": 2}, {"op": "replace", "path": "/title", "value": "Vaiana"}]`,
+			want:        envelope{"error": "operation 0 (test /version): test failed"},
+			code:        http.StatusConflict,
+		},
+		{
+			name:        "json patch changing version",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "/version", "value": 10}]`,
+			want:        envelope{"error": "unable to update the record due to an edit conflict, please try again"},
+			code:        http.StatusConflict,
+		},
+		{
+			name:        "json patch with missing path",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "remove", "path": "/genres/5"}]`,
+			want:        envelope{"error": map[string]string{"patch": "operation 0 (remove /genres/5): path not found"}},
+			code:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "json patch adding unknown field",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "add", "path": "/budget", "value": 150000000}]`,
+			want:        envelope{"error": map[string]string{"patch": "must only change title, year, runtime and genres"}},
+			code:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "json patch with incorrect type",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "/year", "value": "2016"}]`,
+			want:        envelope{"error": map[string]string{"year": "has incorrect JSON type"}},
+			code:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "json patch with invalid runtime",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "/runtime", "value": 110}]`,
+			want:        envelope{"error": map[string]string{"runtime": `must be in "<minutes> mins" format`}},
+			code:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        `title=Vaiana`,
+			want:        envelope{"error": "the request body must be application/json, application/merge-patch+json or application/json-patch+json"},
+			code:        http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPatch, "/v1/movies/1", strings.NewReader(c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, editor)
+			req.Header.Set("Content-Type", c.contentType)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
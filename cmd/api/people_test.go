@@ -0,0 +1,251 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+// movieWithCredits and personWithCredits are the resources with credits
+// embedded into them
+type movieWithCredits struct {
+	data.Movie
+	Credits []*data.Credit `json:"credits"`
+}
+
+type personWithCredits struct {
+	data.Person
+	Credits []*data.Credit `json:"credits"`
+}
+
+func TestPeopleAndCredits(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	reader := newActivatedUser(t, app, "alice@example.com", data.MoviesRead)
+	editor := newActivatedUser(t, app, "bob@example.com", data.MoviesRead, data.MoviesWrite)
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(moana, 0))
+	cars := &data.Movie{Title: "Cars", Year: 2006, Runtime: 117, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(cars, 0))
+
+	musker := data.Person{ID: 1, Name: "John Musker", BirthYear: 1953, Version: 1}
+	cravalho := data.Person{ID: 2, Name: "Auli'i Cravalho", Version: 1}
+
+	moanaCredits := []*data.Credit{
+		{MovieID: 1, PersonID: 1, Name: "John Musker", Role: "director", BillingOrder: 0},
+		{MovieID: 1, PersonID: 2, Name: "Auli'i Cravalho", Role: "actor", Character: "Moana", BillingOrder: 1},
+	}
+
+	notPermitted := envelope{"error": "your user account doesn't have the necessary permissions to access this resource"}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		body    any
+		want    envelope
+		code    int
+	}{
+		{
+			name:    "create person without permission",
+			method:  http.MethodPost,
+			path:    "/v1/people",
+			headers: reader,
+			body:    personCreateBody{Name: "John Musker", BirthYear: 1953},
+			want:    notPermitted,
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "create person",
+			method:  http.MethodPost,
+			path:    "/v1/people",
+			headers: editor,
+			body:    personCreateBody{Name: "John Musker", BirthYear: 1953},
+			want:    envelope{"person": musker},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "create invalid person",
+			method:  http.MethodPost,
+			path:    "/v1/people",
+			headers: editor,
+			body:    personCreateBody{BirthYear: 1700},
+			want: envelope{"error": map[string]string{
+				"name":       "must be provided",
+				"birth_year": "must be greater than 1800",
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "create second person",
+			method:  http.MethodPost,
+			path:    "/v1/people",
+			headers: editor,
+			body:    personCreateBody{Name: "Auli'i Cravalho"},
+			want:    envelope{"person": cravalho},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "list people",
+			method:  http.MethodGet,
+			path:    "/v1/people?sort=name",
+			headers: reader,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+				"people":   []data.Person{cravalho, musker},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "set credits with unknown person",
+			method:  http.MethodPut,
+			path:    "/v1/movies/1/credits",
+			headers: editor,
+			body: envelope{"credits": []creditBody{
+				{PersonID: 7, Role: "director"},
+			}},
+			want: envelope{"error": map[string]string{"credits": "must only reference existing people"}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "set invalid credits",
+			method:  http.MethodPut,
+			path:    "/v1/movies/1/credits",
+			headers: editor,
+			body: envelope{"credits": []creditBody{
+				{PersonID: 1, Role: "director"},
+				{PersonID: 1, Role: "grip"},
+				{PersonID: 1, Role: "director"},
+			}},
+			want: envelope{"error": map[string]string{
+				"credits[1].role": "must be one of director, actor, writer, producer, composer, cinematographer, editor",
+				"credits[2]":      "must not repeat the same person in the same role",
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "set credits",
+			method:  http.MethodPut,
+			path:    "/v1/movies/1/credits",
+			headers: editor,
+			body: envelope{"credits": []creditBody{
+				{PersonID: 2, Role: "actor", Character: "Moana", BillingOrder: 1},
+				{PersonID: 1, Role: "director"},
+			}},
+			want: envelope{"credits": moanaCredits},
+			code: http.StatusOK,
+		},
+		{
+			name:    "get movie with credits",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1?include=credits",
+			headers: reader,
+			want: envelope{"movie": movieWithCredits{
+				Movie:   data.Movie{ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 1},
+				Credits: moanaCredits,
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:    "get movie with unknown include",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1?include=reviews",
+			headers: reader,
+			want:    envelope{"error": map[string]string{"include": "must only contain credits, localization"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "list movies by person",
+			method:  http.MethodGet,
+			path:    "/v1/movies?person_id=2&include=credits",
+			headers: reader,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+				"movies": []movieWithCredits{{
+					Movie:   data.Movie{ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 1},
+					Credits: moanaCredits,
+				}},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "get person with credits",
+			method:  http.MethodGet,
+			path:    "/v1/people/2?include=credits",
+			headers: reader,
+			want: envelope{"person": personWithCredits{
+				Person:  data.Person{ID: 2, Name: "Auli'i Cravalho", Version: 1},
+				Credits: moanaCredits[1:],
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:    "update person",
+			method:  http.MethodPatch,
+			path:    "/v1/people/2",
+			headers: editor,
+			body:    envelope{"birth_year": 2000},
+			want:    envelope{"person": data.Person{ID: 2, Name: "Auli'i Cravalho", BirthYear: 2000, Version: 2}},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "delete person",
+			method:  http.MethodDelete,
+			path:    "/v1/people/1",
+			headers: editor,
+			want:    envelope{"message": "person successfully deleted"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "credits of deleted person are gone",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1/credits",
+			headers: reader,
+			want: envelope{"credits": []*data.Credit{
+				{MovieID: 1, PersonID: 2, Name: "Auli'i Cravalho", Role: "actor", Character: "Moana", BillingOrder: 1},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:    "credits of movie without credits",
+			method:  http.MethodGet,
+			path:    "/v1/movies/2/credits",
+			headers: reader,
+			want:    envelope{"credits": []*data.Credit{}},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "get deleted person",
+			method:  http.MethodGet,
+			path:    "/v1/people/1",
+			headers: reader,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
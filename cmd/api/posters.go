@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/blob"
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+const (
+	maxPosterBytes  = 10 << 20
+	maxPosterPixels = 40_000_000
+	// Room for multipart boundaries and part headers on top of the image itself
+	multipartOverhead = 64 << 10
+)
+
+var posterContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// readImageUpload reads image either from the file field of multipart form or
+// from the raw request body.
+func readImageUpload(w http.ResponseWriter, r *http.Request, field string) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPosterBytes+multipartOverhead)
+
+	var src io.Reader = r.Body
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("body must contain %q file field", field)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if part.FormName() == field {
+				src = part
+				break
+			}
+		}
+	}
+
+	img, err := io.ReadAll(io.LimitReader(src, maxPosterBytes+1))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("image must not be larger than %d bytes", maxPosterBytes)
+		}
+		return nil, err
+	}
+
+	switch {
+	case len(img) == 0:
+		return nil, errors.New("body must not be empty")
+	case len(img) > maxPosterBytes:
+		return nil, fmt.Errorf("image must not be larger than %d bytes", maxPosterBytes)
+	}
+
+	return img, nil
+}
+
+// artworkImages returns uploaded poster or still image along with generated
+// thumbnails keyed by their blob names. Problems with the image are reported
+// to v under the field.
+func artworkImages(upload []byte, field string, v *validator.Validator) (map[string][]byte, string, error) {
+	contentType := http.DetectContentType(upload)
+	if v.Check(validator.PermittedValue(contentType, posterContentTypes...), field, "must be a JPEG, PNG or GIF image"); !v.Valid() {
+		return nil, "", nil
+	}
+
+	// Dimensions are checked before decoding, so huge images aren't loaded into memory
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(upload))
+	if err != nil {
+		v.AddError(field, "must be a valid image")
+		return nil, "", nil
+	}
+	if v.Check(cfg.Width*cfg.Height <= maxPosterPixels, field, "must not be larger than 40 megapixels"); !v.Valid() {
+		return nil, "", nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(upload))
+	if err != nil {
+		v.AddError(field, "must be a valid image")
+		return nil, "", nil
+	}
+
+	images := map[string][]byte{data.PosterOriginal: upload}
+	for _, size := range data.PosterSizes {
+		var buf bytes.Buffer
+		if err = jpeg.Encode(&buf, thumbnail(img, size.Width), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		images[size.Name] = buf.Bytes()
+	}
+
+	return images, contentType, nil
+}
+
+// thumbnail scales the image down to the width keeping its aspect ratio. Every
+// pixel of the thumbnail is an average of the source pixels it covers. Source
+// rows are converted to RGBA one at a time, so that only a row is held on top
+// of the decoded image. Images which are already narrow enough are returned as
+// is.
+func thumbnail(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	if b.Dx() <= width {
+		return src
+	}
+	height := max(1, b.Dy()*width/b.Dx())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	row := image.NewRGBA(image.Rect(0, 0, b.Dx(), 1))
+	sums := make([][4]int, width)
+
+	// columns returns range of source columns covered by the thumbnail column
+	columns := func(x int) (int, int) {
+		x0 := x * b.Dx() / width
+		return x0, max(x0+1, (x+1)*b.Dx()/width)
+	}
+
+	for y := range height {
+		y0 := y * b.Dy() / height
+		y1 := max(y0+1, (y+1)*b.Dy()/height)
+
+		clear(sums)
+		for sy := y0; sy < y1; sy++ {
+			draw.Draw(row, row.Bounds(), src, image.Pt(b.Min.X, b.Min.Y+sy), draw.Src)
+			for x := range width {
+				x0, x1 := columns(x)
+				for p := range slices.Chunk(row.Pix[x0*4:x1*4], 4) {
+					for c := range sums[x] {
+						sums[x][c] += int(p[c])
+					}
+				}
+			}
+		}
+
+		for x := range width {
+			x0, x1 := columns(x)
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := range sums[x] {
+				dst.Pix[i+c] = uint8(sums[x][c] / n) // #nosec G115 -- average of bytes fits a byte
+			}
+		}
+	}
+
+	return dst
+}
+
+// newArtworkKey returns unique key for new images of the movie stored under
+// the prefix, e.g. "posters". Keys are never reused, so served images can be
+// cached forever.
+func newArtworkKey(prefix string, movieID int64) (string, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%d/%s", prefix, movieID, hex.EncodeToString(token)), nil
+}
+
+// putArtworkImages stores images returned by artworkImages under the key. Images
+// stored before a failure are deleted.
+func (app *application) putArtworkImages(ctx context.Context, key string, images map[string][]byte, contentType string) error {
+	for name, img := range images {
+		imgType := "image/jpeg"
+		if name == data.PosterOriginal {
+			imgType = contentType
+		}
+
+		if err := app.blobs.Put(ctx, key+"/"+name, img, imgType); err != nil {
+			app.deleteBlobs(data.NewPoster(key).BlobKeys()...)
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePosterBlobs removes images of the poster in background logging failures
+func (app *application) deletePosterBlobs(poster *data.Poster) {
+	if poster == nil {
+		return
+	}
+	app.deleteBlobs(poster.BlobKeys()...)
+}
+
+// deleteBlobs removes the blobs in background logging failures
+func (app *application) deleteBlobs(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		for _, key := range keys {
+			if err := app.blobs.Delete(ctx, key); err != nil {
+				app.logger.Error("couldn't delete image", "key", key, "err", err)
+			}
+		}
+	})
+}
+
+func (app *application) putMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, movie) {
+		return
+	}
+
+	upload, err := readImageUpload(w, r, "poster")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	images, contentType, err := artworkImages(upload, "poster", v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key, err := newArtworkKey("posters", movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	poster := data.NewPoster(key)
+
+	if err = app.putArtworkImages(r.Context(), key, images, contentType); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	previous := movie.Poster
+
+	if err = app.models.Movies.SetPoster(movie, poster, app.contextGetUser(r).ID); err != nil {
+		app.deletePosterBlobs(poster)
+
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deletePosterBlobs(previous)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	if err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if movie.Poster == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.checkIfMatch(w, r, movie) {
+		return
+	}
+
+	previous := movie.Poster
+
+	if err = app.models.Movies.SetPoster(movie, nil, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deletePosterBlobs(previous)
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	if err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPosterImageHandler serves poster images. Their keys are unique, so clients
+// may cache them forever.
+func (app *application) getPosterImageHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveArtworkImage(w, r, "posters/"+r.PathValue("path"))
+}
+
+// getStillImageHandler serves still images the same way as the poster ones
+func (app *application) getStillImageHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveArtworkImage(w, r, "stills/"+r.PathValue("path"))
+}
+
+func (app *application) serveArtworkImage(w http.ResponseWriter, r *http.Request, key string) {
+	rc, contentType, err := app.blobs.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound), errors.Is(err, blob.ErrInvalidKey):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			app.logError(r, err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err = io.Copy(w, rc); err != nil {
+		app.logError(r, err)
+	}
+}
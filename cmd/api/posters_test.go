@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func TestMoviePoster(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	editor := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite)
+	reader := newActivatedUser(t, app, "bob@example.com", data.MoviesRead)
+
+	heat := &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(heat, 0))
+
+	pngPoster := encodePNG(t, 1000, 1500)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, err := mw.CreateFormFile("poster", "heat.png")
+	assertions.AssertNoError(t, err)
+	_, err = part.Write(pngPoster)
+	assertions.AssertNoError(t, err)
+	assertions.AssertNoError(t, mw.Close())
+
+	cases := []struct {
+		name        string
+		headers     map[string][]string
+		contentType string
+		body        []byte
+		code        int
+		wantErr     string
+	}{
+		{
+			name:    "upload without permission",
+			headers: reader,
+			body:    pngPoster,
+			code:    http.StatusForbidden,
+			wantErr: `{"error":"your user account doesn't have the necessary permissions to access this resource"}`,
+		},
+		{
+			name:    "upload empty body",
+			headers: editor,
+			code:    http.StatusBadRequest,
+			wantErr: `{"error":"body must not be empty"}`,
+		},
+		{
+			name:    "upload unsupported image",
+			headers: editor,
+			body:    []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"),
+			code:    http.StatusUnprocessableEntity,
+			wantErr: `{"error":{"poster":"must be a JPEG, PNG or GIF image"}}`,
+		},
+		{
+			name:    "upload raw image",
+			headers: editor,
+			body:    pngPoster,
+			code:    http.StatusOK,
+		},
+		{
+			name:        "upload multipart form",
+			headers:     editor,
+			contentType: mw.FormDataContentType(),
+			body:        form.Bytes(),
+			code:        http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPut, "/v1/movies/1/poster", bytes.NewReader(c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			if c.wantErr != "" {
+				assertions.AssertStrings(t, rw.Body.String(), c.wantErr)
+			}
+		})
+	}
+
+	movie, err := app.models.Movies.GetByID(heat.ID)
+	assertions.AssertNoError(t, err)
+	if movie.Poster == nil {
+		t.Fatal("expected movie to have a poster")
+	}
+
+	t.Run("poster is in movie json", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+		setRequestHeaders(t, req, reader)
+
+		server.ServeHTTP(rw, req)
+
+		var got struct {
+			Movie struct {
+				Poster data.Poster `json:"poster"`
+			} `json:"movie"`
+		}
+		assertions.AssertNoError(t, json.Unmarshal(rw.Body.Bytes(), &got))
+		assertions.AssertStrings(t, got.Movie.Poster.Small, movie.Poster.Small)
+	})
+
+	t.Run("serve thumbnails", func(t *testing.T) {
+		for _, size := range data.PosterSizes {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/v1/"+movie.Poster.Key+"/"+size.Name, nil)
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+			assertions.AssertStrings(t, rw.Header().Get("Content-Type"), "image/jpeg")
+
+			img, err := jpeg.Decode(rw.Body)
+			assertions.AssertNoError(t, err)
+			if img.Bounds().Dx() != size.Width || img.Bounds().Dy() != size.Width*3/2 {
+				t.Errorf("got %s thumbnail of %v, want width %d", size.Name, img.Bounds(), size.Width)
+			}
+		}
+	})
+
+	t.Run("serve original", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, movie.Poster.Original, nil)
+
+		server.ServeHTTP(rw, req)
+
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+		assertions.AssertStrings(t, rw.Header().Get("Content-Type"), "image/png")
+		assertions.AssertStrings(t, rw.Header().Get("Cache-Control"), "public, max-age=31536000, immutable")
+	})
+
+	t.Run("serve missing image", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/posters/1/missing/small", nil)
+
+		server.ServeHTTP(rw, req)
+
+		assertions.AssertStatusCode(t, rw.Code, http.StatusNotFound)
+	})
+
+	t.Run("delete poster", func(t *testing.T) {
+		for _, code := range []int{http.StatusOK, http.StatusNotFound} {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, "/v1/movies/1/poster", nil)
+			setRequestHeaders(t, req, editor)
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, code)
+		}
+	})
+}
+
+func TestThumbnail(t *testing.T) {
+	cases := []struct {
+		name          string
+		width, height int
+		thumbWidth    int
+		wantWidth     int
+		wantHeight    int
+	}{
+		{name: "downscale", width: 400, height: 600, thumbWidth: 100, wantWidth: 100, wantHeight: 150},
+		{name: "downscale wide", width: 1000, height: 10, thumbWidth: 92, wantWidth: 92, wantHeight: 1},
+		{name: "don't upscale", width: 50, height: 75, thumbWidth: 92, wantWidth: 50, wantHeight: 75},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+			for i := range src.Pix {
+				src.Pix[i] = 200
+			}
+
+			got := thumbnail(src, c.thumbWidth)
+			if got.Bounds().Dx() != c.wantWidth || got.Bounds().Dy() != c.wantHeight {
+				t.Fatalf("got %v, want %dx%d", got.Bounds(), c.wantWidth, c.wantHeight)
+			}
+			if r, _, _, _ := got.At(0, 0).RGBA(); r>>8 != 200 {
+				t.Errorf("got red %d, want 200", r>>8)
+			}
+		})
+	}
+}
+
+func TestThumbnailMemory(t *testing.T) {
+	// 12 megapixels take 48 MB decoded, thumbnails must not copy all of it
+	src := image.NewNRGBA(image.Rect(0, 0, 4000, 3000))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for _, size := range data.PosterSizes {
+		thumbnail(src, size.Width)
+	}
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+		t.Errorf("thumbnails allocated %d bytes, want at most %d", allocated, 4<<20)
+	}
+}
+
+// encodePNG returns PNG image of the given size filled with gradient
+func encodePNG(t testing.TB, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{R: uint8(x % 256), G: uint8(y % 256), B: 128, A: 255}) // #nosec G115
+		}
+	}
+
+	var buf bytes.Buffer
+	assertions.AssertNoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
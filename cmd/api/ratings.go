@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type ratingBody struct {
+	Rating int32  `json:"rating"`
+	Review string `json:"review"`
+}
+
+func (app *application) listMovieRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-created_at")
+	input.SortSafelist = []string{"created_at", "rating", "-created_at", "-rating"}
+
+	if input.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, err = app.models.Movies.GetByID(id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ratings, metadata, err := app.models.Ratings.GetAllForMovie(id, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"ratings": ratings, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRating reads rating of the movie from path by the current user from request body.
+// It reports false if the error response was already sent.
+func (app *application) readRating(w http.ResponseWriter, r *http.Request) (*data.Rating, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	var input ratingBody
+
+	if err = app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	rating := &data.Rating{
+		MovieID: id,
+		UserID:  app.contextGetUser(r).ID,
+		Rating:  input.Rating,
+		Review:  input.Review,
+	}
+
+	v := validator.New()
+	if data.ValidateRating(v, rating); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	if _, err = app.models.Movies.GetByID(id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return rating, true
+}
+
+func (app *application) createRatingHandler(w http.ResponseWriter, r *http.Request) {
+	rating, ok := app.readRating(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.models.Ratings.Insert(rating); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateRating):
+			app.errorResponse(w, r, http.StatusConflict, "you have already rated this movie, update the existing rating instead")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, envelope{"rating": rating}, http.StatusCreated, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateRatingHandler(w http.ResponseWriter, r *http.Request) {
+	rating, ok := app.readRating(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.models.Ratings.Update(rating); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, envelope{"rating": rating}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteRatingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err = app.models.Ratings.Delete(id, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"message": "rating successfully deleted"}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
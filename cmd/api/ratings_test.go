@@ -0,0 +1,223 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestMovieRatings(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	alice := newActivatedUser(t, app, "alice@example.com", data.MoviesRead)
+	bob := newActivatedUser(t, app, "bob@example.com")
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(moana, 0))
+	cars := &data.Movie{Title: "Cars", Year: 2006, Runtime: 117, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(cars, 0))
+
+	ts := data.MockTimeStamp
+	aliceRating := data.Rating{MovieID: 1, UserID: 1, Rating: 8, Review: "Great songs", CreatedAt: ts, UpdatedAt: ts}
+	bobRating := data.Rating{MovieID: 1, UserID: 2, Rating: 5, CreatedAt: ts, UpdatedAt: ts}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		body    any
+		want    envelope
+		code    int
+	}{
+		{
+			name:   "rate without authentication",
+			method: http.MethodPost,
+			path:   "/v1/movies/1/ratings",
+			body:   ratingBody{Rating: 8},
+			want:   envelope{"error": "you must be authenticated to access this resource"},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:    "rate out of range",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/ratings",
+			headers: alice,
+			body:    ratingBody{Rating: 11},
+			want:    envelope{"error": map[string]string{"rating": "must be between 1 and 10"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "rate unknown movie",
+			method:  http.MethodPost,
+			path:    "/v1/movies/7/ratings",
+			headers: alice,
+			body:    ratingBody{Rating: 8},
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "rate movie",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/ratings",
+			headers: alice,
+			body:    ratingBody{Rating: 8, Review: "Great songs"},
+			want:    envelope{"rating": aliceRating},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "rate movie twice",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/ratings",
+			headers: alice,
+			body:    ratingBody{Rating: 9},
+			want:    envelope{"error": "you have already rated this movie, update the existing rating instead"},
+			code:    http.StatusConflict,
+		},
+		{
+			name:    "update missing rating",
+			method:  http.MethodPut,
+			path:    "/v1/movies/1/ratings",
+			headers: bob,
+			body:    ratingBody{Rating: 4},
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "rate movie by another user",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/ratings",
+			headers: bob,
+			body:    ratingBody{Rating: 4},
+			want: envelope{"rating": data.Rating{
+				MovieID: 1, UserID: 2, Rating: 4, CreatedAt: ts, UpdatedAt: ts,
+			}},
+			code: http.StatusCreated,
+		},
+		{
+			name:    "update rating",
+			method:  http.MethodPut,
+			path:    "/v1/movies/1/ratings",
+			headers: bob,
+			body:    ratingBody{Rating: 5},
+			want:    envelope{"rating": bobRating},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "get rated movie",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1",
+			headers: alice,
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 1,
+				Rating: 6.5, RatingCount: 2,
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:    "list ratings",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1/ratings?sort=-rating",
+			headers: alice,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+				"ratings":  []data.Rating{aliceRating, bobRating},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "list movies by rating",
+			method:  http.MethodGet,
+			path:    "/v1/movies?sort=-rating",
+			headers: alice,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+				"movies": []data.Movie{
+					{
+						ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 1,
+						Rating: 6.5, RatingCount: 2,
+					},
+					{ID: 2, Title: "Cars", Year: 2006, Runtime: 117, Genres: data.Genres{"animation"}, Version: 1},
+				},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "list movies with min rating",
+			method:  http.MethodGet,
+			path:    "/v1/movies?min_rating=7",
+			headers: alice,
+			want:    envelope{"metadata": data.Metadata{}, "movies": []data.Movie{}},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "list movies with invalid min rating",
+			method:  http.MethodGet,
+			path:    "/v1/movies?min_rating=11",
+			headers: alice,
+			want:    envelope{"error": map[string]string{"min_rating": "must be between 1 and 10"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "list movies with zero min rating",
+			method:  http.MethodGet,
+			path:    "/v1/movies?min_rating=0",
+			headers: alice,
+			want:    envelope{"error": map[string]string{"min_rating": "must be between 1 and 10"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "delete rating",
+			method:  http.MethodDelete,
+			path:    "/v1/movies/1/ratings",
+			headers: bob,
+			want:    envelope{"message": "rating successfully deleted"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "list movies with min rating after delete",
+			method:  http.MethodGet,
+			path:    "/v1/movies?min_rating=7",
+			headers: alice,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+				"movies": []data.Movie{{
+					ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 1,
+					Rating: 8, RatingCount: 1,
+				}},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "delete missing rating",
+			method:  http.MethodDelete,
+			path:    "/v1/movies/1/ratings",
+			headers: bob,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	version, err := strconv.ParseInt(r.PathValue("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+	return int32(version), nil
+}
+
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-version")
+	input.SortSafelist = []string{"version", "-version"}
+
+	if input.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.MovieRevisions.GetAllForMovie(id, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if metadata.TotalRecords == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"revisions": revisions, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.MovieRevisions.Get(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"revision": revision}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffMovieRevisionsHandler compares revision from query parameter 'from' with the
+// one from 'to' (the latest revision by default).
+func (app *application) diffMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	from := app.readInt(qs, "from", 0, v)
+	to := app.readInt(qs, "to", 0, v)
+
+	v.Check(from > 0, "from", "must be a positive integer")
+	v.Check(to >= 0, "to", "must be a positive integer")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if to == 0 {
+		latest, _, err := app.models.MovieRevisions.GetAllForMovie(id, data.Filters{
+			Page:         1,
+			PageSize:     1,
+			Sort:         "-version",
+			SortSafelist: []string{"-version"},
+		})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(latest) == 0 {
+			app.notFoundResponse(w, r)
+			return
+		}
+		to = int(latest[0].Version)
+	}
+
+	var revisions [2]*data.MovieRevision
+	for i, version := range []int{from, to} {
+		revisions[i], err = app.models.MovieRevisions.Get(id, int32(version))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	env := envelope{
+		"from":    from,
+		"to":      to,
+		"changes": data.DiffRevisions(revisions[0], revisions[1]),
+	}
+
+	if err = app.writeJSON(w, env, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertMovieHandler sets the movie to the state of the given revision. It's an
+// ordinary update, so it's subject to If-Match preconditions and edit conflicts.
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, movie) {
+		return
+	}
+
+	revision, err := app.models.MovieRevisions.Get(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revision.Apply(movie)
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateMovie(v, movie, taxonomy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = app.models.Movies.Revert(movie, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrMovieAlreadyExists):
+			v.AddError("title", "a movie with this title and year already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	if err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
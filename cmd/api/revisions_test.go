@@ -0,0 +1,191 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestMovieRevisions(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+	editor := newActivatedUser(t, app, "bob@example.com", data.MoviesRead, data.MoviesWrite)
+
+	moanaV1 := data.Movie{ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 1}
+	notFound := envelope{"error": "the requested resource could not be found"}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		body    any
+		want    envelope
+		code    int
+	}{
+		{
+			name:   "create movie",
+			method: http.MethodPost,
+			path:   "/v1/movies",
+			body: movieCreateBody{
+				Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"},
+			},
+			want: envelope{"movie": moanaV1},
+			code: http.StatusCreated,
+		},
+		{
+			name:   "update movie",
+			method: http.MethodPatch,
+			path:   "/v1/movies/1",
+			body:   getMovieUpdateBody("Moana 2", 2024, 100, []string{"animation", "adventure"}),
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "Moana 2", Year: 2024, Runtime: 100, Genres: data.Genres{"animation", "adventure"}, Version: 2,
+			}},
+			code: http.StatusCreated,
+		},
+		{
+			name:   "list revisions",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/revisions?sort=version",
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+				"revisions": []data.MovieRevision{
+					{
+						MovieID: 1, Version: 1, Action: data.RevisionInsert, UserID: 1, CreatedAt: data.MockTimeStamp,
+						Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"},
+					},
+					{
+						MovieID: 1, Version: 2, Action: data.RevisionUpdate, UserID: 1, CreatedAt: data.MockTimeStamp,
+						Title: "Moana 2", Year: 2024, Runtime: 100, Genres: data.Genres{"animation", "adventure"},
+					},
+				},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "get revision",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/revisions/1",
+			want: envelope{"revision": data.MovieRevision{
+				MovieID: 1, Version: 1, Action: data.RevisionInsert, UserID: 1, CreatedAt: data.MockTimeStamp,
+				Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:   "get unknown revision",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/revisions/5",
+			want:   notFound,
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "diff with the latest revision",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/diff?from=1",
+			want: envelope{
+				"from": 1,
+				"to":   2,
+				"changes": map[string]data.FieldDiff{
+					"title":   {From: "Moana", To: "Moana 2"},
+					"year":    {From: 2016, To: 2024},
+					"runtime": {From: data.Runtime(107), To: data.Runtime(100)},
+					"genres": {
+						From:  data.Genres{"animation"},
+						To:    data.Genres{"animation", "adventure"},
+						Added: []string{"adventure"},
+					},
+				},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:   "diff without from",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/diff",
+			want:   envelope{"error": map[string]string{"from": "must be a positive integer"}},
+			code:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "revert with stale etag",
+			method: http.MethodPost,
+			path:   "/v1/movies/1/revisions/1/revert",
+			headers: map[string][]string{
+				"If-Match": {`"1-1"`},
+			},
+			want: envelope{
+				"error": "the resource has been modified since it was last fetched, fetch it again and retry",
+			},
+			code: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "revert",
+			method: http.MethodPost,
+			path:   "/v1/movies/1/revisions/1/revert",
+			headers: map[string][]string{
+				"If-Match": {`"1-2"`},
+			},
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 3,
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:   "revert revision",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/revisions/3",
+			want: envelope{"revision": data.MovieRevision{
+				MovieID: 1, Version: 3, Action: data.RevisionRevert, UserID: 1, CreatedAt: data.MockTimeStamp,
+				Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:   "delete movie",
+			method: http.MethodDelete,
+			path:   "/v1/movies/1",
+			want:   envelope{"message:": "movie successfully deleted"},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "delete revision",
+			method: http.MethodGet,
+			path:   "/v1/movies/1/revisions/4",
+			want: envelope{"revision": data.MovieRevision{
+				MovieID: 1, Version: 4, Action: data.RevisionDelete, UserID: 1, CreatedAt: data.MockTimeStamp,
+				Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"},
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:   "revisions of unknown movie",
+			method: http.MethodGet,
+			path:   "/v1/movies/7/revisions",
+			want:   notFound,
+			code:   http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, editor)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
@@ -3,32 +3,102 @@ package main
 import (
 	"expvar"
 	"net/http"
-
-	"github.com/julienschmidt/httprouter"
 )
 
+// routes uses http.ServeMux rather than httprouter, as static segments like
+// /v1/movies/export conflict with wildcards registered at the same position,
+// e.g. /v1/movies/:id, in httprouter.
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v1/healthcheck", app.healthcheckHandler)
+
+	mux.HandleFunc("GET /v1/movies", app.requirePermission(app.listMoviesHandler, "movies:read"))
+	mux.HandleFunc("POST /v1/movies", app.requirePermission(app.idempotent(app.createMovieHandler), "movies:write"))
+	mux.HandleFunc("POST /v1/movies/import", app.requirePermission(app.importMoviesHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/export", app.requirePermission(app.exportMoviesHandler, "movies:read"))
+	mux.HandleFunc("GET /v1/movies/changes", app.requirePermission(app.movieChangesHandler, "movies:read"))
+	mux.HandleFunc("GET /v1/movies/lookup", app.requirePermission(app.lookupMovieHandler, "movies:read"))
+	mux.HandleFunc("PUT /v1/movies/by-external/{provider}/{id}", app.requirePermission(app.upsertMovieByExternalIDHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/duplicates", app.requirePermission(app.listDuplicatesHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/trash", app.requirePermission(app.listTrashHandler, "movies:write"))
+	mux.HandleFunc("POST /v1/movies/{id}/restore", app.requirePermission(app.restoreMovieHandler, "movies:write"))
+	mux.HandleFunc("POST /v1/movies/{id}/purge", app.requirePermission(app.purgeMovieHandler, "admin"))
+	mux.HandleFunc("POST /v1/movies/{id}/merge", app.requirePermission(app.mergeMovieHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/{id}/revisions", app.requirePermission(app.listMovieRevisionsHandler, "movies:read"))
+	mux.HandleFunc("GET /v1/movies/{id}/revisions/{version}", app.requirePermission(app.getMovieRevisionHandler, "movies:read"))
+	mux.HandleFunc("POST /v1/movies/{id}/revisions/{version}/revert", app.requirePermission(app.revertMovieHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/{id}/diff", app.requirePermission(app.diffMovieRevisionsHandler, "movies:read"))
+	mux.HandleFunc("GET /v1/movies/{id}/credits", app.requirePermission(app.listMovieCreditsHandler, "movies:read"))
+	mux.HandleFunc("PUT /v1/movies/{id}/credits", app.requirePermission(app.setMovieCreditsHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/{id}/localization", app.requirePermission(app.getMovieLocalizationHandler, "movies:read"))
+	mux.HandleFunc("PUT /v1/movies/{id}/localization", app.requirePermission(app.setMovieLocalizationHandler, "movies:write"))
+	mux.HandleFunc("PUT /v1/movies/{id}/poster", app.requirePermission(app.putMoviePosterHandler, "movies:write"))
+	mux.HandleFunc("DELETE /v1/movies/{id}/poster", app.requirePermission(app.deleteMoviePosterHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/{id}/stills", app.requirePermission(app.listMovieStillsHandler, "movies:read"))
+	mux.HandleFunc("POST /v1/movies/{id}/stills", app.requirePermission(app.addMovieStillHandler, "movies:write"))
+	mux.HandleFunc("DELETE /v1/movies/{id}/stills/{still_id}", app.requirePermission(app.deleteMovieStillHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/movies/{id}/ratings", app.requirePermission(app.listMovieRatingsHandler, "movies:read"))
+	mux.HandleFunc("POST /v1/movies/{id}/ratings", app.requireActivatedUser(app.createRatingHandler))
+	mux.HandleFunc("PUT /v1/movies/{id}/ratings", app.requireActivatedUser(app.updateRatingHandler))
+	mux.HandleFunc("DELETE /v1/movies/{id}/ratings", app.requireActivatedUser(app.deleteRatingHandler))
+	mux.HandleFunc("GET /v1/movies/{id}", app.requirePermission(app.getMovieHandler, "movies:read"))
+	mux.HandleFunc("PATCH /v1/movies/{id}", app.requirePermission(app.updateMovieHandler, "movies:write"))
+	mux.HandleFunc("DELETE /v1/movies/{id}", app.requirePermission(app.deleteMovieHandler, "movies:write"))
 
-	router.NotFound = http.HandlerFunc(app.notFoundResponse)
-	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+	mux.HandleFunc("GET /v1/posters/{path...}", app.getPosterImageHandler)
+	mux.HandleFunc("GET /v1/stills/{path...}", app.getStillImageHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	mux.HandleFunc("GET /v1/genres", app.requirePermission(app.listGenresHandler, "movies:read"))
+	mux.HandleFunc("POST /v1/genres", app.requirePermission(app.createGenreHandler, "admin"))
+	mux.HandleFunc("GET /v1/genres/{slug}", app.requirePermission(app.getGenreHandler, "movies:read"))
+	mux.HandleFunc("PATCH /v1/genres/{slug}", app.requirePermission(app.updateGenreHandler, "admin"))
+	mux.HandleFunc("POST /v1/genres/{slug}/merge", app.requirePermission(app.mergeGenreHandler, "admin"))
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission(app.listMoviesHandler, "movies:read"))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission(app.createMovieHandler, "movies:write"))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission(app.getMovieHandler, "movies:read"))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission(app.updateMovieHandler, "movies:write"))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission(app.deleteMovieHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/people", app.requirePermission(app.listPeopleHandler, "movies:read"))
+	mux.HandleFunc("POST /v1/people", app.requirePermission(app.createPersonHandler, "movies:write"))
+	mux.HandleFunc("GET /v1/people/{id}", app.requirePermission(app.getPersonHandler, "movies:read"))
+	mux.HandleFunc("PATCH /v1/people/{id}", app.requirePermission(app.updatePersonHandler, "movies:write"))
+	mux.HandleFunc("DELETE /v1/people/{id}", app.requirePermission(app.deletePersonHandler, "movies:write"))
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	mux.HandleFunc("GET /v1/collections", app.requirePermission(app.listCollectionsHandler, "movies:read"))
+	mux.HandleFunc("POST /v1/collections", app.requireActivatedUser(app.createCollectionHandler))
+	mux.HandleFunc("GET /v1/collections/{id}", app.requirePermission(app.getCollectionHandler, "movies:read"))
+	mux.HandleFunc("PATCH /v1/collections/{id}", app.requireActivatedUser(app.updateCollectionHandler))
+	mux.HandleFunc("DELETE /v1/collections/{id}", app.requireActivatedUser(app.deleteCollectionHandler))
+	mux.HandleFunc("PUT /v1/collections/{id}/movies", app.requireActivatedUser(app.setCollectionMoviesHandler))
+	mux.HandleFunc("POST /v1/collections/{id}/movies", app.requireActivatedUser(app.addCollectionMovieHandler))
+	mux.HandleFunc("PATCH /v1/collections/{id}/movies/{movie_id}", app.requireActivatedUser(app.moveCollectionMovieHandler))
+	mux.HandleFunc("DELETE /v1/collections/{id}/movies/{movie_id}", app.requireActivatedUser(app.removeCollectionMovieHandler))
+
+	mux.HandleFunc("GET /v1/webhooks", app.requirePermission(app.listWebhooksHandler, "admin"))
+	mux.HandleFunc("POST /v1/webhooks", app.requirePermission(app.createWebhookHandler, "admin"))
+	mux.HandleFunc("GET /v1/webhooks/{id}", app.requirePermission(app.getWebhookHandler, "admin"))
+	mux.HandleFunc("PATCH /v1/webhooks/{id}", app.requirePermission(app.updateWebhookHandler, "admin"))
+	mux.HandleFunc("DELETE /v1/webhooks/{id}", app.requirePermission(app.deleteWebhookHandler, "admin"))
+	mux.HandleFunc("POST /v1/webhooks/{id}/test", app.requirePermission(app.testWebhookHandler, "admin"))
+	mux.HandleFunc("GET /v1/webhooks/{id}/deliveries", app.requirePermission(app.listWebhookDeliveriesHandler, "admin"))
+	mux.HandleFunc(
+		"POST /v1/webhooks/{id}/deliveries/{delivery_id}/retry",
+		app.requirePermission(app.retryWebhookDeliveryHandler, "admin"),
+	)
 
-	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
+	mux.HandleFunc("POST /v1/users", app.idempotent(app.registerUserHandler))
+	mux.HandleFunc("PUT /v1/users/activated", app.activateUserHandler)
+	mux.HandleFunc("PUT /v1/users/password", app.updateUserPasswordHandler)
+	mux.HandleFunc("GET /v1/users/me/watchlist", app.requireActivatedUser(app.listWatchlistHandler))
+	mux.HandleFunc("POST /v1/users/me/watchlist", app.requireActivatedUser(app.addToWatchlistHandler))
+	mux.HandleFunc("DELETE /v1/users/me/watchlist/{id}", app.requireActivatedUser(app.removeFromWatchlistHandler))
+	mux.HandleFunc("GET /v1/users/me/watched", app.requireActivatedUser(app.listWatchedHandler))
+	mux.HandleFunc("POST /v1/users/me/watched", app.requireActivatedUser(app.addWatchedHandler))
+	mux.HandleFunc("DELETE /v1/users/me/watched/{id}", app.requireActivatedUser(app.deleteWatchedHandler))
+	mux.HandleFunc("POST /v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	mux.HandleFunc("POST /v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	mux.Handle("GET /debug/vars", expvar.Handler())
 
 	return app.applyMiddlewares(
-		router,
+		app.unmatchedRoutes(mux),
 		app.metrics,
 		app.recoverPanic,
 		app.enableCORS,
@@ -36,3 +106,56 @@ func (app *application) routes() http.Handler {
 		app.authenticate,
 	)
 }
+
+// unmatchedRoutes answers requests without a matching route with JSON error
+// responses instead of the plain text ones written by http.ServeMux. Methods
+// allowed for the path are taken from the Allow header set by the mux itself.
+func (app *application) unmatchedRoutes(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		var res unmatchedResponse
+		h.ServeHTTP(&res, r)
+		allow := res.header.Get("Allow")
+
+		switch {
+		case res.status != http.StatusMethodNotAllowed:
+			app.notFoundResponse(w, r)
+		case r.Method == http.MethodOptions:
+			w.Header().Set("Allow", allow+", "+http.MethodOptions)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Allow", allow)
+			app.methodNotAllowedResponse(w, r)
+		}
+	})
+}
+
+// unmatchedResponse keeps status and headers of the mux response to unmatched
+// request discarding its plain text body
+type unmatchedResponse struct {
+	header http.Header
+	status int
+}
+
+func (u *unmatchedResponse) Header() http.Header {
+	if u.header == nil {
+		u.header = make(http.Header)
+	}
+	return u.header
+}
+
+func (u *unmatchedResponse) WriteHeader(status int) {
+	if u.status == 0 {
+		u.status = status
+	}
+}
+
+func (u *unmatchedResponse) Write(b []byte) (int, error) {
+	u.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func TestUnmatchedRoutes(t *testing.T) {
+	server := newTestApplication(t).routes()
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		allow  string
+		want   string
+		code   int
+	}{
+		{
+			name:   "unknown path",
+			method: http.MethodGet,
+			path:   "/v1/unknown",
+			want:   `{"error":"the requested resource could not be found"}`,
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "unsupported method",
+			method: http.MethodPut,
+			path:   "/v1/movies/1",
+			allow:  "DELETE, GET, HEAD, PATCH",
+			want:   `{"error":"the PUT method is not supported for this resource"}`,
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "options",
+			method: http.MethodOptions,
+			path:   "/v1/movies",
+			allow:  "GET, HEAD, POST, OPTIONS",
+			code:   http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, nil)
+			assertions.AssertNoError(t, err)
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			assertions.AssertStrings(t, rw.Header().Get("Allow"), c.allow)
+			assertions.AssertStrings(t, rw.Body.String(), c.want)
+		})
+	}
+}
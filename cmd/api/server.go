@@ -20,13 +20,18 @@ func (app *application) server() error {
 		WriteTimeout: 10 * time.Second,
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
+	srv.RegisterOnShutdown(func() { close(app.shutdown) })
 
-	cancelCtx, stopLimiter := context.WithCancel(context.Background())
+	cancelCtx, stopTickers := context.WithCancel(context.Background())
 	go app.limiter.RunCleanup(cancelCtx)
+	go app.runTrashPurge(cancelCtx)
+	go app.runIdempotencyCleanup(cancelCtx)
+	go app.listenMovieChanges(cancelCtx)
+	app.background(app.runWebhookDeliveries)
 
 	shutDownError := make(chan error)
 	go func() {
-		defer stopLimiter()
+		defer stopTickers()
 
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+func (app *application) listMovieStillsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if _, err = app.models.Movies.GetByID(id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	stills, err := app.models.Stills.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"stills": stills}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addMovieStillHandler stores the uploaded still along with its thumbnails.
+// Stills don't change the movie, so its version stays the same.
+func (app *application) addMovieStillHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	upload, err := readImageUpload(w, r, "still")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	images, contentType, err := artworkImages(upload, "still", v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key, err := newArtworkKey("stills", id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	still := &data.Still{MovieID: id, Images: data.NewPoster(key)}
+
+	if err = app.putArtworkImages(r.Context(), key, images, contentType); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.models.Stills.Insert(still); err != nil {
+		app.deleteBlobs(still.Images.BlobKeys()...)
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTooManyStills):
+			v.AddError("still", "movie must not have more than "+strconv.Itoa(data.MaxMovieStills)+" stills")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"still": still}, http.StatusCreated, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieStillHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	stillID, err := strconv.ParseInt(r.PathValue("still_id"), 10, 64)
+	if err != nil || stillID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	still, err := app.models.Stills.Delete(id, stillID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deleteBlobs(still.Images.BlobKeys()...)
+
+	if err = app.writeJSON(w, envelope{"message": "still successfully deleted"}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/blob"
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func TestMovieStills(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	admin := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite, data.Admin)
+	reader := newActivatedUser(t, app, "bob@example.com", data.MoviesRead)
+
+	heat := &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(heat, 0))
+
+	pngStill := encodePNG(t, 640, 360)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, err := mw.CreateFormFile("still", "heat.png")
+	assertions.AssertNoError(t, err)
+	_, err = part.Write(pngStill)
+	assertions.AssertNoError(t, err)
+	assertions.AssertNoError(t, mw.Close())
+
+	cases := []struct {
+		name        string
+		url         string
+		headers     map[string][]string
+		contentType string
+		body        []byte
+		code        int
+		wantErr     string
+	}{
+		{
+			name:    "upload without permission",
+			url:     "/v1/movies/1/stills",
+			headers: reader,
+			body:    pngStill,
+			code:    http.StatusForbidden,
+			wantErr: `{"error":"your user account doesn't have the necessary permissions to access this resource"}`,
+		},
+		{
+			name:    "upload to missing movie",
+			url:     "/v1/movies/2/stills",
+			headers: admin,
+			body:    pngStill,
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "upload unsupported image",
+			url:     "/v1/movies/1/stills",
+			headers: admin,
+			body:    []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"),
+			code:    http.StatusUnprocessableEntity,
+			wantErr: `{"error":{"still":"must be a JPEG, PNG or GIF image"}}`,
+		},
+		{
+			name:    "upload raw image",
+			url:     "/v1/movies/1/stills",
+			headers: admin,
+			body:    pngStill,
+			code:    http.StatusCreated,
+		},
+		{
+			name:        "upload multipart form",
+			url:         "/v1/movies/1/stills",
+			headers:     admin,
+			contentType: mw.FormDataContentType(),
+			body:        form.Bytes(),
+			code:        http.StatusCreated,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, c.url, bytes.NewReader(c.body))
+			setRequestHeaders(t, req, c.headers)
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			if c.wantErr != "" {
+				assertions.AssertStrings(t, rw.Body.String(), c.wantErr)
+			}
+		})
+	}
+
+	stills, err := app.models.Stills.GetAllForMovie(heat.ID)
+	assertions.AssertNoError(t, err)
+
+	t.Run("list stills", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/movies/1/stills", nil)
+		setRequestHeaders(t, req, reader)
+
+		server.ServeHTTP(rw, req)
+
+		var got struct {
+			Stills []data.Still `json:"stills"`
+		}
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+		assertions.AssertNoError(t, json.Unmarshal(rw.Body.Bytes(), &got))
+		if len(got.Stills) != 2 || got.Stills[0].Images.Small != stills[0].Images.Small {
+			t.Fatalf("got stills %+v, want 2 stills", got.Stills)
+		}
+	})
+
+	t.Run("serve thumbnail", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, stills[0].Images.Small, nil)
+
+		server.ServeHTTP(rw, req)
+
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+		assertions.AssertStrings(t, rw.Header().Get("Content-Type"), "image/jpeg")
+	})
+
+	t.Run("delete still", func(t *testing.T) {
+		url := fmt.Sprintf("/v1/movies/1/stills/%d", stills[0].ID)
+		for _, code := range []int{http.StatusOK, http.StatusNotFound} {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, url, nil)
+			setRequestHeaders(t, req, admin)
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, code)
+		}
+
+		app.wg.Wait()
+		assertBlobsDeleted(t, app, stills[0].Images.BlobKeys())
+	})
+
+	t.Run("purge deletes images", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/v1/movies/1/poster", bytes.NewReader(encodePNG(t, 100, 150)))
+		setRequestHeaders(t, req, admin)
+		server.ServeHTTP(rw, req)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+
+		movie, err := app.models.Movies.GetByID(heat.ID)
+		assertions.AssertNoError(t, err)
+		keys := append(movie.Poster.BlobKeys(), stills[1].Images.BlobKeys()...)
+
+		// The movie is moved to the trash first and then purged
+		for _, route := range []struct{ method, url string }{
+			{http.MethodDelete, "/v1/movies/1"},
+			{http.MethodPost, "/v1/movies/1/purge"},
+		} {
+			rw = httptest.NewRecorder()
+			req = httptest.NewRequest(route.method, route.url, nil)
+			setRequestHeaders(t, req, admin)
+			server.ServeHTTP(rw, req)
+			assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+		}
+
+		app.wg.Wait()
+		assertBlobsDeleted(t, app, keys)
+	})
+}
+
+func assertBlobsDeleted(t testing.TB, app *application, keys []string) {
+	t.Helper()
+
+	for _, key := range keys {
+		_, _, err := app.blobs.Get(context.Background(), key)
+		if !errors.Is(err, blob.ErrNotFound) {
+			t.Errorf("got %v getting %q, want blob.ErrNotFound", err, key)
+		}
+	}
+}
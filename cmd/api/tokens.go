@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/mailer"
 	"github.com/shrtyk/greenlight/internal/validator"
 )
 
@@ -14,6 +15,10 @@ type userAuthenticationBody struct {
 	Password string `json:"password"`
 }
 
+type passwordResetTokenBody struct {
+	Email string `json:"email"`
+}
+
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input userAuthenticationBody
 
@@ -64,3 +69,52 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// createPasswordResetTokenHandler mails a password reset token to the user with
+// the email address. The token is created and mailed in background, so that
+// the response is the same, both in content and in timing, whether such a user
+// exists or not, and it can't be used to find out registered emails.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input passwordResetTokenBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.Error("couldn't get user", "err", err)
+			}
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.logger.Error("couldn't create password reset token", "err", err)
+			return
+		}
+
+		data := mailer.MailData{
+			UserName:           user.Name,
+			PasswordResetToken: token.Plaintext,
+		}
+		if err = app.mailer.Send(user.Email, "token_password_reset.tmpl", data); err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+	if err := app.writeJSON(w, env, http.StatusAccepted, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
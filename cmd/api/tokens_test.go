@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/mailer"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	mails := &[]mailer.MailData{}
+	app.mailer = mailer.NewMockMailer(mails)
+	server := app.routes()
+
+	alice := newActivatedUser(t, app, "alice@example.com", data.MoviesRead)
+	bob := newActivatedUser(t, app, "bob@example.com", data.MoviesRead)
+
+	resetRequested := envelope{"message": "an email will be sent to you containing password reset instructions"}
+
+	// resetToken returns plaintext of the latest mailed password reset token
+	resetToken := func(t *testing.T) string {
+		t.Helper()
+
+		app.wg.Wait()
+		if len(*mails) == 0 {
+			t.Fatal("no emails were sent")
+		}
+		return (*mails)[len(*mails)-1].PasswordResetToken
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   func(t *testing.T) any
+		want   envelope
+		code   int
+		mails  int
+	}{
+		{
+			name:   "request reset",
+			method: http.MethodPost,
+			path:   "/v1/tokens/password-reset",
+			body:   func(t *testing.T) any { return envelope{"email": "alice@example.com"} },
+			want:   resetRequested,
+			code:   http.StatusAccepted,
+			mails:  1,
+		},
+		{
+			name:   "request reset of unknown email",
+			method: http.MethodPost,
+			path:   "/v1/tokens/password-reset",
+			body:   func(t *testing.T) any { return envelope{"email": "tom@example.com"} },
+			want:   resetRequested,
+			code:   http.StatusAccepted,
+			mails:  1,
+		},
+		{
+			name:   "request reset with invalid email",
+			method: http.MethodPost,
+			path:   "/v1/tokens/password-reset",
+			body:   func(t *testing.T) any { return envelope{"email": "alice"} },
+			want:   envelope{"error": map[string]string{"email": "must be a valid email address"}},
+			code:   http.StatusUnprocessableEntity,
+			mails:  1,
+		},
+		{
+			name:   "reset with short password",
+			method: http.MethodPut,
+			path:   "/v1/users/password",
+			body: func(t *testing.T) any {
+				return userPasswordBody{Password: "pass", TokenPlainText: resetToken(t)}
+			},
+			want:  envelope{"error": map[string]string{"password": "must be at least 8 bytes long"}},
+			code:  http.StatusUnprocessableEntity,
+			mails: 1,
+		},
+		{
+			name:   "reset with authentication token",
+			method: http.MethodPut,
+			path:   "/v1/users/password",
+			body: func(t *testing.T) any {
+				return userPasswordBody{Password: "n3wpa55word", TokenPlainText: alice["Authorization"][0][len("Bearer "):]}
+			},
+			want:  envelope{"error": map[string]string{"token": "invalid or expired password reset token"}},
+			code:  http.StatusUnprocessableEntity,
+			mails: 1,
+		},
+		{
+			name:   "reset password",
+			method: http.MethodPut,
+			path:   "/v1/users/password",
+			body: func(t *testing.T) any {
+				return userPasswordBody{Password: "n3wpa55word", TokenPlainText: resetToken(t)}
+			},
+			want:  envelope{"message": "your password was successfully reset"},
+			code:  http.StatusOK,
+			mails: 1,
+		},
+		{
+			name:   "reuse reset token",
+			method: http.MethodPut,
+			path:   "/v1/users/password",
+			body: func(t *testing.T) any {
+				return userPasswordBody{Password: "an0therpa55word", TokenPlainText: resetToken(t)}
+			},
+			want:  envelope{"error": map[string]string{"token": "invalid or expired password reset token"}},
+			code:  http.StatusUnprocessableEntity,
+			mails: 1,
+		},
+		{
+			name:   "authenticate with old password",
+			method: http.MethodPost,
+			path:   "/v1/tokens/authentication",
+			body: func(t *testing.T) any {
+				return userAuthenticationBody{Email: "alice@example.com", Password: "pa55word"}
+			},
+			want:  envelope{"error": "invalid authentication credentials"},
+			code:  http.StatusUnauthorized,
+			mails: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body(t)))
+			assertions.AssertNoError(t, err)
+
+			server.ServeHTTP(rw, req)
+			app.wg.Wait()
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+			if len(*mails) != c.mails {
+				t.Errorf("got %d emails, want %d", len(*mails), c.mails)
+			}
+		})
+	}
+
+	t.Run("revokes authentication tokens", func(t *testing.T) {
+		for _, c := range []struct {
+			headers map[string][]string
+			code    int
+		}{
+			{headers: alice, code: http.StatusUnauthorized},
+			{headers: bob, code: http.StatusOK},
+		} {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/v1/movies", nil)
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		}
+
+		user, err := app.models.Users.GetByEmail("alice@example.com")
+		assertions.AssertNoError(t, err)
+		match, err := user.Password.Matches("n3wpa55word")
+		assertions.AssertNoError(t, err)
+		if !match {
+			t.Error("new password doesn't match")
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type trashCfg struct {
+	retention time.Duration
+	purgeFreq time.Duration
+}
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.SortSafelist = []string{
+		"id", "title", "deleted_at",
+		"-id", "-title", "-deleted_at",
+	}
+
+	if input.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"movies": movies, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrMovieAlreadyExists):
+			app.errorResponse(w, r, http.StatusConflict, "a movie with the same title and year already exists")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	if err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) purgeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	keys, err := app.models.Movies.Purge(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.deleteBlobs(keys...)
+
+	err = app.writeJSON(w, envelope{"message": "movie permanently deleted"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runTrashPurge periodically purges movies kept in the trash longer than the
+// retention period. Zero retention keeps trashed movies until purged manually.
+func (app *application) runTrashPurge(ctx context.Context) {
+	if app.config.trash.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.trash.purgeFreq)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			purged, keys, err := app.models.Movies.PurgeDeletedBefore(time.Now().Add(-app.config.trash.retention))
+			if err != nil {
+				app.logger.Error("couldn't purge trash", "err", err)
+				continue
+			}
+			app.deleteBlobs(keys...)
+			if purged > 0 {
+				app.logger.Info("purged trash", "movies", purged)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestMoviesTrash(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	editor := newActivatedUser(t, app, "bob@example.com", data.MoviesRead, data.MoviesWrite)
+	admin := newActivatedUser(t, app, "alice@example.com", data.MoviesRead, data.MoviesWrite, data.Admin)
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(moana, 0))
+
+	deletedAt := data.MockTimeStamp
+	notPermitted := envelope{"error": "your user account doesn't have the necessary permissions to access this resource"}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		want    envelope
+		code    int
+	}{
+		{
+			name:    "delete movie",
+			method:  http.MethodDelete,
+			path:    "/v1/movies/1",
+			headers: editor,
+			want:    envelope{"message:": "movie successfully deleted"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "get deleted movie",
+			method:  http.MethodGet,
+			path:    "/v1/movies/1",
+			headers: editor,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "list trash",
+			method:  http.MethodGet,
+			path:    "/v1/movies/trash",
+			headers: editor,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+				"movies": []data.Movie{{
+					ID: 1, Title: "Moana", Year: 2016, Runtime: 107,
+					Genres: data.Genres{"animation"}, Version: 2, DeletedAt: &deletedAt,
+				}},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "restore movie",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/restore",
+			headers: editor,
+			want: envelope{"movie": data.Movie{
+				ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 3,
+			}},
+			code: http.StatusOK,
+		},
+		{
+			name:    "restore movie not in trash",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/restore",
+			headers: editor,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "delete movie again",
+			method:  http.MethodDelete,
+			path:    "/v1/movies/1",
+			headers: editor,
+			want:    envelope{"message:": "movie successfully deleted"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "purge movie without admin permission",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/purge",
+			headers: editor,
+			want:    notPermitted,
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "purge movie",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/purge",
+			headers: admin,
+			want:    envelope{"message": "movie permanently deleted"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "restore purged movie",
+			method:  http.MethodPost,
+			path:    "/v1/movies/1/restore",
+			headers: editor,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, nil)
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
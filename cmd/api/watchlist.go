@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type watchlistAddBody struct {
+	MovieID int64 `json:"movie_id"`
+}
+
+type watchedAddBody struct {
+	MovieID   int64     `json:"movie_id"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+// readUserListFilters reads pagination of the current user's lists
+func (app *application) readUserListFilters(r *http.Request, v *validator.Validator, defaultSort string, sortSafelist ...string) data.Filters {
+	qs := r.URL.Query()
+
+	return data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", defaultSort),
+		SortSafelist: sortSafelist,
+	}
+}
+
+// getListedMovie returns the movie to be added to one of the current user's
+// lists. It reports false if the error response was already sent.
+func (app *application) getListedMovie(w http.ResponseWriter, r *http.Request, movieID int64, v *validator.Validator) (*data.Movie, bool) {
+	if v.Check(movieID > 0, "movie_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	movie, err := app.models.Movies.GetByID(movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "must reference an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
+
+func (app *application) listWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	filters := app.readUserListFilters(r, v, "-added_at",
+		"added_at", "title", "year",
+		"-added_at", "-title", "-year",
+	)
+
+	if filters.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Watchlist.GetAll(app.contextGetUser(r).ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"watchlist": entries, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addToWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input watchlistAddBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	movie, ok := app.getListedMovie(w, r, input.MovieID, validator.New())
+	if !ok {
+		return
+	}
+
+	entry, err := app.models.Watchlist.Add(app.contextGetUser(r).ID, movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAlreadyInWatchlist):
+			app.errorResponse(w, r, http.StatusConflict, "the movie is already in your watchlist")
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"entry": entry}, http.StatusCreated, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeFromWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err = app.models.Watchlist.Remove(app.contextGetUser(r).ID, id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"message": "movie removed from watchlist"}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	filters := app.readUserListFilters(r, v, "-watched_at",
+		"watched_at", "title", "year",
+		"-watched_at", "-title", "-year",
+	)
+
+	if filters.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Watched.GetAll(app.contextGetUser(r).ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"watched": entries, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addWatchedHandler logs the movie as watched and takes it off the watchlist
+func (app *application) addWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	var input watchedAddBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	movie, ok := app.getListedMovie(w, r, input.MovieID, v)
+	if !ok {
+		return
+	}
+
+	entry := &data.WatchedEntry{Movie: movie, WatchedAt: input.WatchedAt}
+	if data.ValidateWatchedEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if err := app.models.Watched.Insert(user.ID, entry); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.models.Watchlist.Remove(user.ID, movie.ID); err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logError(r, err)
+	}
+
+	if err := app.writeJSON(w, envelope{"entry": entry}, http.StatusCreated, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err = app.models.Watched.Delete(app.contextGetUser(r).ID, id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"message": "watched entry successfully deleted"}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestWatchlist(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	alice := newActivatedUser(t, app, "alice@example.com")
+	bob := newActivatedUser(t, app, "bob@example.com")
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(moana, 0))
+	cars := &data.Movie{Title: "Cars", Year: 2006, Runtime: 117, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(cars, 0))
+	deadpool := &data.Movie{Title: "Deadpool", Year: 2016, Runtime: 108, Genres: data.Genres{"action"}}
+	assertions.AssertNoError(t, app.models.Movies.Insert(deadpool, 0))
+
+	moanaV1 := &data.Movie{ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}, Version: 1}
+	carsV1 := &data.Movie{ID: 2, Title: "Cars", Year: 2006, Runtime: 117, Genres: data.Genres{"animation"}, Version: 1}
+	deadpoolV1 := &data.Movie{ID: 3, Title: "Deadpool", Year: 2016, Runtime: 108, Genres: data.Genres{"action"}, Version: 1}
+
+	ts := data.MockTimeStamp
+	watchedAt := time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC)
+	emptyPage := envelope{"metadata": data.Metadata{}, "watchlist": []data.WatchlistEntry{}}
+	notFound := envelope{"error": "the requested resource could not be found"}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		body    any
+		want    envelope
+		code    int
+		setup   func()
+	}{
+		{
+			name:   "watchlist without authentication",
+			method: http.MethodGet,
+			path:   "/v1/users/me/watchlist",
+			want:   envelope{"error": "you must be authenticated to access this resource"},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:    "add unknown movie",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watchlist",
+			headers: alice,
+			body:    watchlistAddBody{MovieID: 7},
+			want:    envelope{"error": map[string]string{"movie_id": "must reference an existing movie"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "add movie",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watchlist",
+			headers: alice,
+			body:    watchlistAddBody{MovieID: 1},
+			want:    envelope{"entry": data.WatchlistEntry{Movie: moanaV1, AddedAt: ts}},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "add movie twice",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watchlist",
+			headers: alice,
+			body:    watchlistAddBody{MovieID: 1},
+			want:    envelope{"error": "the movie is already in your watchlist"},
+			code:    http.StatusConflict,
+		},
+		{
+			name:    "add another movie",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watchlist",
+			headers: alice,
+			body:    watchlistAddBody{MovieID: 2},
+			want:    envelope{"entry": data.WatchlistEntry{Movie: carsV1, AddedAt: ts}},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "add trashed movie",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watchlist",
+			headers: alice,
+			body:    watchlistAddBody{MovieID: 3},
+			want:    envelope{"entry": data.WatchlistEntry{Movie: deadpoolV1, AddedAt: ts}},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "list watchlist",
+			method:  http.MethodGet,
+			path:    "/v1/users/me/watchlist?sort=title",
+			headers: alice,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+				"watchlist": []data.WatchlistEntry{
+					{Movie: carsV1, AddedAt: ts},
+					{Movie: moanaV1, AddedAt: ts},
+				},
+			},
+			code: http.StatusOK,
+			setup: func() {
+				assertions.AssertNoError(t, app.models.Movies.Delete(deadpool, 0))
+			},
+		},
+		{
+			name:    "list watchlist of another user",
+			method:  http.MethodGet,
+			path:    "/v1/users/me/watchlist",
+			headers: bob,
+			want:    emptyPage,
+			code:    http.StatusOK,
+		},
+		{
+			name:    "log watched movie",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watched",
+			headers: alice,
+			body:    watchedAddBody{MovieID: 1, WatchedAt: watchedAt},
+			want:    envelope{"entry": data.WatchedEntry{ID: 1, Movie: moanaV1, WatchedAt: watchedAt}},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "log watched movie in the future",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watched",
+			headers: alice,
+			body:    watchedAddBody{MovieID: 1, WatchedAt: time.Now().Add(24 * time.Hour)},
+			want:    envelope{"error": map[string]string{"watched_at": "must not be in the future"}},
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "log rewatch",
+			method:  http.MethodPost,
+			path:    "/v1/users/me/watched",
+			headers: alice,
+			body:    watchedAddBody{MovieID: 1},
+			want:    envelope{"entry": data.WatchedEntry{ID: 2, Movie: moanaV1, WatchedAt: ts}},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "watched movie is taken off watchlist",
+			method:  http.MethodGet,
+			path:    "/v1/users/me/watchlist",
+			headers: alice,
+			want: envelope{
+				"metadata":  data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+				"watchlist": []data.WatchlistEntry{{Movie: carsV1, AddedAt: ts}},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "list watched",
+			method:  http.MethodGet,
+			path:    "/v1/users/me/watched",
+			headers: alice,
+			want: envelope{
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+				"watched": []data.WatchedEntry{
+					{ID: 2, Movie: moanaV1, WatchedAt: ts},
+					{ID: 1, Movie: moanaV1, WatchedAt: watchedAt},
+				},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "delete watched entry of another user",
+			method:  http.MethodDelete,
+			path:    "/v1/users/me/watched/1",
+			headers: bob,
+			want:    notFound,
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "delete watched entry",
+			method:  http.MethodDelete,
+			path:    "/v1/users/me/watched/1",
+			headers: alice,
+			want:    envelope{"message": "watched entry successfully deleted"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "remove movie from watchlist",
+			method:  http.MethodDelete,
+			path:    "/v1/users/me/watchlist/2",
+			headers: alice,
+			want:    envelope{"message": "movie removed from watchlist"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "remove missing movie from watchlist",
+			method:  http.MethodDelete,
+			path:    "/v1/users/me/watchlist/2",
+			headers: alice,
+			want:    notFound,
+			code:    http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.setup != nil {
+				c.setup()
+			}
+
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, helpers.MustJSON(t, c.body))
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
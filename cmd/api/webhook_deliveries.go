@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+)
+
+const (
+	// webhookDispatchBatch is the number of due deliveries claimed at once
+	webhookDispatchBatch = 50
+	// webhookDeliveryLease is how long a claimed delivery is left to its sender
+	// before it's due again. It must be longer than the client timeout.
+	webhookDeliveryLease = 5 * time.Minute
+	// maxWebhookSenders is the number of deliveries sent at once
+	maxWebhookSenders = 10
+)
+
+type webhookCfg struct {
+	pollFreq time.Duration
+	timeout  time.Duration
+}
+
+// webhookEvent is the payload of webhook deliveries
+type webhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      envelope  `json:"data"`
+}
+
+// newWebhookClient returns client of webhook deliveries. Redirects aren't
+// followed, so they are failed deliveries.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func newWebhookEvent(eventType string, payload envelope) (*webhookEvent, []byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+
+	event := &webhookEvent{
+		ID:        "evt_" + hex.EncodeToString(id),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      payload,
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+	return event, b, nil
+}
+
+// enqueueWebhookDeliveries stores deliveries of the event to the webhooks and
+// wakes up the dispatcher
+func (app *application) enqueueWebhookDeliveries(eventType string, payload envelope, webhooks ...*data.Webhook) ([]*data.WebhookDelivery, error) {
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+
+	event, b, err := newWebhookEvent(eventType, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := newWebhookDeliveries(event, b, webhooks)
+	if err = app.models.WebhookDeliveries.Insert(deliveries...); err != nil {
+		return nil, err
+	}
+
+	app.wakeWebhookDispatcher()
+	return deliveries, nil
+}
+
+// newWebhookDeliveries returns deliveries of the marshalled event to the webhooks
+func newWebhookDeliveries(event *webhookEvent, b []byte, webhooks []*data.Webhook) []*data.WebhookDelivery {
+	deliveries := make([]*data.WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i] = &data.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   b,
+		}
+	}
+	return deliveries
+}
+
+func (app *application) wakeWebhookDispatcher() {
+	select {
+	case app.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// publishWebhookEvent enqueues the event for webhooks subscribed to its type.
+// The change is already saved at this point, so failures are only logged.
+func (app *application) publishWebhookEvent(r *http.Request, eventType string, payload envelope) {
+	webhooks, err := app.models.Webhooks.GetSubscribed(eventType)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	if _, err = app.enqueueWebhookDeliveries(eventType, payload, webhooks...); err != nil {
+		app.logError(r, err)
+	}
+}
+
+// movieEvents maps actions of logged movie changes to webhook event types
+var movieEvents = map[string]string{
+	data.ChangeCreated: data.EventMovieCreated,
+	data.ChangeUpdated: data.EventMovieUpdated,
+	data.ChangeDeleted: data.EventMovieDeleted,
+}
+
+// enqueueMovieEvents enqueues events of the movie changes logged since the
+// previous call. Events are derived from the change log rather than published
+// by handlers, so that every new version of a movie is published whichever
+// request produced it, e.g. renaming a genre or uploading a poster.
+func (app *application) enqueueMovieEvents() {
+	for {
+		cursor, err := app.models.WebhookDeliveries.MovieChangesCursor()
+		if err != nil {
+			app.logger.Error("couldn't get movie changes cursor", "err", err)
+			return
+		}
+
+		changes, err := app.models.MovieChanges.GetAfter(cursor, movieChangesBatch)
+		if err != nil {
+			app.logger.Error("couldn't get movie changes", "err", err)
+			return
+		}
+		if len(changes) == 0 {
+			return
+		}
+
+		deliveries, err := app.movieEventDeliveries(changes)
+		if err != nil {
+			app.logger.Error("couldn't create movie event deliveries", "err", err)
+			return
+		}
+
+		err = app.models.WebhookDeliveries.InsertForMovieChanges(cursor, changes[len(changes)-1].ID, deliveries...)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			// Another process enqueued the changes meanwhile
+			continue
+		case err != nil:
+			app.logger.Error("couldn't enqueue movie events", "err", err)
+			return
+		}
+
+		if len(changes) < movieChangesBatch {
+			return
+		}
+	}
+}
+
+// movieEventDeliveries returns deliveries of the changes to the webhooks
+// subscribed to their events
+func (app *application) movieEventDeliveries(changes []*data.MovieChange) ([]*data.WebhookDelivery, error) {
+	subscribed := make(map[string][]*data.Webhook, len(movieEvents))
+	deliveries := []*data.WebhookDelivery{}
+	for _, change := range changes {
+		eventType := movieEvents[change.Action]
+
+		webhooks, ok := subscribed[eventType]
+		if !ok {
+			var err error
+			if webhooks, err = app.models.Webhooks.GetSubscribed(eventType); err != nil {
+				return nil, err
+			}
+			subscribed[eventType] = webhooks
+		}
+		if len(webhooks) == 0 {
+			continue
+		}
+
+		payload, err := app.movieEventPayload(change)
+		if err != nil {
+			return nil, err
+		}
+
+		event, b, err := newWebhookEvent(eventType, payload)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, newWebhookDeliveries(event, b, webhooks)...)
+	}
+	return deliveries, nil
+}
+
+// movieEventPayload returns the movie as of the change. Revisions of merged
+// and purged movies are deleted along with them, so only their id and version
+// are known. Merged movies also carry id of the movie they were merged into.
+func (app *application) movieEventPayload(change *data.MovieChange) (envelope, error) {
+	movie := &data.Movie{ID: change.MovieID, Version: change.Version}
+
+	rev, err := app.models.MovieRevisions.Get(change.MovieID, change.Version)
+	switch {
+	case err == nil:
+		rev.Apply(movie)
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, err
+	}
+
+	payload := envelope{"movie": movie}
+	if change.Action == data.ChangeDeleted {
+		into, err := app.models.Movies.GetRedirect(change.MovieID)
+		switch {
+		case err == nil:
+			payload["merged_into"] = into
+		case !errors.Is(err, data.ErrRecordNotFound):
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// runWebhookDeliveries enqueues events of movie changes and sends due
+// deliveries until the server shuts down. It's meant to run under app.wg, so
+// that shutdown waits for in-flight deliveries started by it.
+func (app *application) runWebhookDeliveries() {
+	// Subscribe before reading the log, so that no change falls in between
+	changes, unsubscribe := app.models.MovieChanges.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(app.config.webhooks.pollFreq)
+	defer ticker.Stop()
+
+	for {
+		app.enqueueMovieEvents()
+		app.dispatchWebhookDeliveries()
+
+		select {
+		case <-ticker.C:
+		case <-changes:
+		case <-app.webhookWake:
+		case <-app.shutdown:
+			return
+		}
+	}
+}
+
+// dispatchWebhookDeliveries claims due deliveries and sends them in the
+// background, at most maxWebhookSenders at once. Deliveries are only claimed
+// for idle senders, the others stay due until a sender finishes and wakes up
+// the dispatcher.
+func (app *application) dispatchWebhookDeliveries() {
+	for {
+		idle := cap(app.webhookSenders) - len(app.webhookSenders)
+		if idle == 0 {
+			return
+		}
+
+		limit := min(idle, webhookDispatchBatch)
+		deliveries, err := app.models.WebhookDeliveries.ClaimDue(time.Now(), webhookDeliveryLease, limit)
+		if err != nil {
+			app.logger.Error("couldn't claim webhook deliveries", "err", err)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			app.webhookSenders <- struct{}{}
+			app.background(func() {
+				defer func() {
+					<-app.webhookSenders
+					app.wakeWebhookDispatcher()
+				}()
+				app.sendWebhookDelivery(delivery)
+			})
+		}
+
+		if len(deliveries) < limit {
+			return
+		}
+	}
+}
+
+// sendWebhookDelivery makes a delivery attempt and saves its outcome
+func (app *application) sendWebhookDelivery(delivery *data.WebhookDelivery) {
+	webhook, err := app.models.Webhooks.Get(delivery.WebhookID)
+	if err != nil {
+		// Deliveries of deleted webhooks are deleted along with them
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("couldn't get webhook", "id", delivery.WebhookID, "err", err)
+		}
+		return
+	}
+
+	// Deliveries queued before the webhook was disabled aren't sent anymore
+	if webhook.Active {
+		status, err := app.postWebhook(webhook, delivery)
+		delivery.RecordAttempt(time.Now(), status, err)
+	} else {
+		delivery.Abandon("webhook is disabled")
+	}
+
+	if err = app.models.WebhookDeliveries.Update(delivery); err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logger.Error("couldn't save webhook delivery", "id", delivery.ID, "err", err)
+	}
+}
+
+// postWebhook posts the signed payload of the delivery and returns the
+// response status
+func (app *application) postWebhook(webhook *data.Webhook, delivery *data.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Greenlight-Webhooks/"+app.version)
+	req.Header.Set("X-Greenlight-Event", delivery.EventType)
+	req.Header.Set("X-Greenlight-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Greenlight-Signature", data.SignWebhookPayload(webhook.Secret, time.Now(), delivery.Payload))
+
+	res, err := app.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain a bit of the body, so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type webhookCreateBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+type webhookUpdateBody struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// readWebhook fetches the webhook from the id path parameter. Returns false if
+// a response was written.
+func (app *application) readWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	webhook, err := app.models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = "id"
+	input.SortSafelist = []string{"id"}
+
+	if input.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	webhooks, metadata, err := app.models.Webhooks.GetAll(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"webhooks": webhooks, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createWebhookHandler subscribes the URL to events. The response carries the
+// signing secret, which isn't shown afterwards.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input webhookCreateBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	secret, err := data.NewWebhookSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		URL:    input.URL,
+		Secret: secret,
+		Events: input.Events,
+		Active: input.Active == nil || *input.Active,
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = app.models.Webhooks.Insert(webhook); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+	err = app.writeJSON(w, envelope{"webhook": webhook, "secret": secret}, http.StatusCreated, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.writeJSON(w, envelope{"webhook": webhook}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input webhookUpdateBody
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Events != nil {
+		webhook.Events = input.Events
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Webhooks.Update(webhook); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, envelope{"webhook": webhook}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhookHandler unsubscribes the webhook dropping its pending deliveries
+// along with the delivery log
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err = app.models.Webhooks.Delete(id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"message": "webhook successfully deleted"}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// testWebhookHandler queues a ping event for the webhook regardless of the
+// events it's subscribed to
+func (app *application) testWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	payload := envelope{"webhook": webhook}
+	deliveries, err := app.enqueueWebhookDeliveries(data.EventPing, payload, webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"delivery": deliveries[0]}, http.StatusAccepted, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhookDeliveriesHandler returns the delivery log of the webhook, latest
+// deliveries first
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	status := app.readString(qs, "status", "")
+	v.Check(
+		validator.PermittedValue(status, "", data.DeliveryPending, data.DeliverySucceeded, data.DeliveryDead),
+		"status",
+		"must be one of pending, succeeded, dead",
+	)
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = "-id"
+	input.SortSafelist = []string{"-id"}
+
+	if input.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, metadata, err := app.models.WebhookDeliveries.GetAllForWebhook(webhook.ID, status, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, envelope{"deliveries": deliveries, "metadata": metadata}, http.StatusOK, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// retryWebhookDeliveryHandler queues the dead delivery again
+func (app *application) retryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(r.PathValue("delivery_id"), 10, 64)
+	if err != nil || deliveryID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.models.WebhookDeliveries.Get(webhookID, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if delivery.Status != data.DeliveryDead {
+		app.errorResponse(w, r, http.StatusConflict, "only dead deliveries can be retried")
+		return
+	}
+
+	delivery.Retry(time.Now())
+	if err = app.models.WebhookDeliveries.Update(delivery); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	select {
+	case app.webhookWake <- struct{}{}:
+	default:
+	}
+
+	if err = app.writeJSON(w, envelope{"delivery": delivery}, http.StatusAccepted, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
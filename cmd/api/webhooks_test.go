@@ -0,0 +1,409 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+	"github.com/shrtyk/greenlight/internal/testutils/helpers"
+)
+
+func TestWebhooks(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	admin := newActivatedUser(t, app, "alice@example.com", data.Admin)
+	writer := newActivatedUser(t, app, "bob@example.com", data.MoviesWrite)
+
+	t.Run("create webhook", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		body := envelope{"url": "https://example.com/hooks", "events": []string{data.EventMovieCreated}}
+		req, err := http.NewRequest(http.MethodPost, "/v1/webhooks", helpers.MustJSON(t, body))
+		assertions.AssertNoError(t, err)
+		setRequestHeaders(t, req, admin)
+
+		server.ServeHTTP(rw, req)
+
+		assertions.AssertStatusCode(t, rw.Code, http.StatusCreated)
+		assertions.AssertStrings(t, rw.Header().Get("Location"), "/v1/webhooks/1")
+
+		var got struct {
+			Webhook data.Webhook `json:"webhook"`
+			Secret  string       `json:"secret"`
+		}
+		assertions.AssertNoError(t, json.NewDecoder(rw.Body).Decode(&got))
+
+		if !strings.HasPrefix(got.Secret, "whsec_") {
+			t.Errorf("got secret %q, want whsec_ prefix", got.Secret)
+		}
+		if !got.Webhook.Active {
+			t.Error("new webhook isn't active")
+		}
+
+		stored, err := app.models.Webhooks.Get(1)
+		assertions.AssertNoError(t, err)
+		assertions.AssertStrings(t, stored.Secret, got.Secret)
+	})
+
+	webhook := func(events []string, active bool, version int32) data.Webhook {
+		return data.Webhook{
+			ID:        1,
+			CreatedAt: data.MockTimeStamp,
+			URL:       "https://example.com/hooks",
+			Events:    events,
+			Active:    active,
+			Version:   version,
+		}
+	}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string][]string
+		body    any
+		want    envelope
+		code    int
+	}{
+		{
+			name:    "get webhook",
+			method:  http.MethodGet,
+			path:    "/v1/webhooks/1",
+			headers: admin,
+			want:    envelope{"webhook": webhook([]string{data.EventMovieCreated}, true, 1)},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "update webhook",
+			method:  http.MethodPatch,
+			path:    "/v1/webhooks/1",
+			headers: admin,
+			body:    envelope{"events": []string{data.EventMovieCreated, data.EventUserActivated}, "active": false},
+			want:    envelope{"webhook": webhook([]string{data.EventMovieCreated, data.EventUserActivated}, false, 2)},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "list webhooks",
+			method:  http.MethodGet,
+			path:    "/v1/webhooks",
+			headers: admin,
+			want: envelope{
+				"webhooks": []data.Webhook{webhook([]string{data.EventMovieCreated, data.EventUserActivated}, false, 2)},
+				"metadata": data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			},
+			code: http.StatusOK,
+		},
+		{
+			name:    "invalid webhook",
+			method:  http.MethodPost,
+			path:    "/v1/webhooks",
+			headers: admin,
+			body:    envelope{"url": "ftp://example.com", "events": []string{"movie.rated"}},
+			want: envelope{"error": map[string]string{
+				"url":    "must be an absolute http or https URL",
+				"events": "must only contain movie.created, movie.updated, movie.deleted, user.activated",
+			}},
+			code: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "missing webhook",
+			method:  http.MethodGet,
+			path:    "/v1/webhooks/2",
+			headers: admin,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+		{
+			name:    "not admin",
+			method:  http.MethodGet,
+			path:    "/v1/webhooks",
+			headers: writer,
+			want:    envelope{"error": "your user account doesn't have the necessary permissions to access this resource"},
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "delete webhook",
+			method:  http.MethodDelete,
+			path:    "/v1/webhooks/1",
+			headers: admin,
+			want:    envelope{"message": "webhook successfully deleted"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "delete deleted webhook",
+			method:  http.MethodDelete,
+			path:    "/v1/webhooks/1",
+			headers: admin,
+			want:    envelope{"error": "the requested resource could not be found"},
+			code:    http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var body io.Reader
+			if c.body != nil {
+				body = helpers.MustJSON(t, c.body)
+			}
+
+			rw := httptest.NewRecorder()
+			req, err := http.NewRequest(c.method, c.path, body)
+			assertions.AssertNoError(t, err)
+			setRequestHeaders(t, req, c.headers)
+
+			server.ServeHTTP(rw, req)
+
+			want, err := io.ReadAll(helpers.MustJSON(t, c.want))
+			assertions.AssertNoError(t, err)
+
+			assertions.AssertStrings(t, rw.Body.String(), string(want))
+			assertions.AssertStatusCode(t, rw.Code, c.code)
+		})
+	}
+}
+
+// receivedWebhook is a request received by the test webhook receiver
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhookReceiver starts a receiver responding with the given status and
+// returns its URL along with the channel of received requests
+func newWebhookReceiver(t *testing.T, status int) (string, <-chan receivedWebhook) {
+	t.Helper()
+
+	received := make(chan receivedWebhook, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts.URL, received
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	app := newTestApplication(t)
+	server := app.routes()
+
+	admin := newActivatedUser(t, app, "alice@example.com", data.Admin, data.MoviesRead, data.MoviesWrite)
+
+	okURL, received := newWebhookReceiver(t, http.StatusNoContent)
+	failingURL, _ := newWebhookReceiver(t, http.StatusInternalServerError)
+
+	subscriber := &data.Webhook{URL: okURL, Secret: "whsec_test", Events: []string{data.EventMovieCreated}, Active: true}
+	assertions.AssertNoError(t, app.models.Webhooks.Insert(subscriber))
+	failing := &data.Webhook{URL: failingURL, Secret: "whsec_test", Events: []string{data.EventMovieCreated}, Active: true}
+	assertions.AssertNoError(t, app.models.Webhooks.Insert(failing))
+	other := &data.Webhook{URL: okURL, Secret: "whsec_test", Events: []string{data.EventMovieDeleted}, Active: true}
+	assertions.AssertNoError(t, app.models.Webhooks.Insert(other))
+
+	changesURL, changed := newWebhookReceiver(t, http.StatusNoContent)
+	changes := &data.Webhook{
+		URL:    changesURL,
+		Secret: "whsec_test",
+		Events: []string{data.EventMovieUpdated, data.EventMovieDeleted},
+		Active: true,
+	}
+	assertions.AssertNoError(t, app.models.Webhooks.Insert(changes))
+
+	send := func(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+
+		var r io.Reader
+		if body != nil {
+			r = helpers.MustJSON(t, body)
+		}
+
+		rw := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, r)
+		assertions.AssertNoError(t, err)
+		setRequestHeaders(t, req, admin)
+
+		server.ServeHTTP(rw, req)
+		return rw
+	}
+
+	listDeliveries := func(t *testing.T, webhookID int64) []data.WebhookDelivery {
+		t.Helper()
+
+		rw := send(t, http.MethodGet, "/v1/webhooks/"+strconv.FormatInt(webhookID, 10)+"/deliveries", nil)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+
+		var got struct {
+			Deliveries []data.WebhookDelivery `json:"deliveries"`
+		}
+		assertions.AssertNoError(t, json.NewDecoder(rw.Body).Decode(&got))
+		return got.Deliveries
+	}
+
+	t.Run("movie created", func(t *testing.T) {
+		moana := movieCreateBody{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+		rw := send(t, http.MethodPost, "/v1/movies", moana)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusCreated)
+
+		app.enqueueMovieEvents()
+		app.dispatchWebhookDeliveries()
+		app.wg.Wait()
+
+		req := <-received
+		assertions.AssertStrings(t, req.header.Get("X-Greenlight-Event"), data.EventMovieCreated)
+		assertions.AssertStrings(t, req.header.Get("X-Greenlight-Delivery"), "1")
+
+		var event webhookEvent
+		assertions.AssertNoError(t, json.Unmarshal(req.body, &event))
+		assertions.AssertStrings(t, event.Type, data.EventMovieCreated)
+
+		signature := req.header.Get("X-Greenlight-Signature")
+		timestamp, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		assertions.AssertNoError(t, err)
+		assertions.AssertStrings(t, signature, data.SignWebhookPayload("whsec_test", time.Unix(unix, 0), req.body))
+
+		deliveries := listDeliveries(t, subscriber.ID)
+		if len(deliveries) != 1 {
+			t.Fatalf("got %d deliveries, want 1", len(deliveries))
+		}
+		assertions.AssertStrings(t, deliveries[0].Status, data.DeliverySucceeded)
+
+		deliveries = listDeliveries(t, failing.ID)
+		if len(deliveries) != 1 {
+			t.Fatalf("got %d deliveries, want 1", len(deliveries))
+		}
+		assertions.AssertStrings(t, deliveries[0].Status, data.DeliveryPending)
+		assertions.AssertStrings(t, deliveries[0].LastError, "unexpected response status 500")
+		if deliveries[0].Attempts != 1 {
+			t.Errorf("got %d attempts, want 1", deliveries[0].Attempts)
+		}
+
+		if deliveries := listDeliveries(t, other.ID); len(deliveries) != 0 {
+			t.Errorf("got %d deliveries of unsubscribed webhook, want 0", len(deliveries))
+		}
+	})
+
+	t.Run("test event", func(t *testing.T) {
+		rw := send(t, http.MethodPost, "/v1/webhooks/3/test", nil)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusAccepted)
+
+		app.dispatchWebhookDeliveries()
+		app.wg.Wait()
+
+		req := <-received
+		assertions.AssertStrings(t, req.header.Get("X-Greenlight-Event"), data.EventPing)
+	})
+
+	t.Run("retry delivery", func(t *testing.T) {
+		rw := send(t, http.MethodPost, "/v1/webhooks/2/deliveries/2/retry", nil)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusConflict)
+
+		delivery, err := app.models.WebhookDeliveries.Get(failing.ID, 2)
+		assertions.AssertNoError(t, err)
+		delivery.Abandon("gave up")
+		assertions.AssertNoError(t, app.models.WebhookDeliveries.Update(delivery))
+
+		rw = send(t, http.MethodPost, "/v1/webhooks/2/deliveries/2/retry", nil)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusAccepted)
+
+		deliveries := listDeliveries(t, failing.ID)
+		assertions.AssertStrings(t, deliveries[0].Status, data.DeliveryPending)
+		if deliveries[0].Attempts != 0 {
+			t.Errorf("got %d attempts, want 0", deliveries[0].Attempts)
+		}
+
+		rw = send(t, http.MethodPost, "/v1/webhooks/1/deliveries/2/retry", nil)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusNotFound)
+	})
+
+	// movieEvents returns events received by the changes webhook by type
+	movieEvents := func(t *testing.T, n int) map[string]envelope {
+		t.Helper()
+
+		app.enqueueMovieEvents()
+		app.dispatchWebhookDeliveries()
+		app.wg.Wait()
+
+		events := make(map[string]envelope, n)
+		for range n {
+			req := <-changed
+
+			var event struct {
+				Type string   `json:"type"`
+				Data envelope `json:"data"`
+			}
+			assertions.AssertNoError(t, json.Unmarshal(req.body, &event))
+			events[event.Type] = event.Data
+		}
+		return events
+	}
+
+	t.Run("movie updated by genre rename", func(t *testing.T) {
+		rw := send(t, http.MethodPatch, "/v1/genres/animation", envelope{"slug": "animated", "name": "Animated"})
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+
+		got := movieEvents(t, 1)[data.EventMovieUpdated]
+		want := envelope{"movie": map[string]any{
+			"id": float64(1), "title": "Moana", "year": float64(2016), "runtime": "107 mins",
+			"genres": []any{"animated"}, "version": float64(2),
+		}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got event data %v, want %v", got, want)
+		}
+	})
+
+	t.Run("movie merged", func(t *testing.T) {
+		duplicate := movieCreateBody{Title: "Up", Year: 2009, Runtime: 96, Genres: []string{"animated"}}
+		rw := send(t, http.MethodPost, "/v1/movies", duplicate)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusCreated)
+
+		rw = send(t, http.MethodPost, "/v1/movies/2/merge", movieMergeBody{Into: 1})
+		assertions.AssertStatusCode(t, rw.Code, http.StatusOK)
+
+		events := movieEvents(t, 2)
+		if got := events[data.EventMovieUpdated]["movie"].(map[string]any)["version"]; got != float64(3) {
+			t.Errorf("got updated version %v, want 3", got)
+		}
+		deleted := events[data.EventMovieDeleted]
+		if got := deleted["movie"].(map[string]any)["id"]; got != float64(2) {
+			t.Errorf("got deleted movie %v, want 2", got)
+		}
+		if got := deleted["merged_into"]; got != float64(1) {
+			t.Errorf("got merged into %v, want 1", got)
+		}
+	})
+	t.Run("senders busy", func(t *testing.T) {
+		for range maxWebhookSenders {
+			app.webhookSenders <- struct{}{}
+		}
+
+		rw := send(t, http.MethodPost, "/v1/webhooks/4/test", nil)
+		assertions.AssertStatusCode(t, rw.Code, http.StatusAccepted)
+
+		app.dispatchWebhookDeliveries()
+		app.wg.Wait()
+
+		select {
+		case <-changed:
+			t.Fatal("delivery was sent while all senders were busy")
+		default:
+		}
+
+		for range maxWebhookSenders {
+			<-app.webhookSenders
+		}
+		app.dispatchWebhookDeliveries()
+		app.wg.Wait()
+
+		req := <-changed
+		assertions.AssertStrings(t, req.header.Get("X-Greenlight-Event"), data.EventPing)
+	})
+}
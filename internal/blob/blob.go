@@ -0,0 +1,39 @@
+// Package blob stores binary objects such as images by string keys.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore keeps blobs along with their content types. Keys are slash
+// separated paths like "posters/1/original".
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns contents of the blob and its content type. Caller must close
+	// the returned reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	// Delete removes the blob. Deleting missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidKey reports whether key is a relative slash separated path without
+// empty, "." or ".." segments.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 1024 {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, "\\\x00") {
+			return false
+		}
+	}
+	return true
+}
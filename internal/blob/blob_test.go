@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+
+	testBlobStore(t, store)
+
+	if err := store.Put(context.Background(), "../escape", []byte("x"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected invalid key error, got: %v", err)
+	}
+}
+
+// testBlobStore runs the same scenario against any BlobStore implementation
+func testBlobStore(t *testing.T, store BlobStore) {
+	t.Helper()
+
+	ctx := context.Background()
+	key := "posters/1/original"
+
+	if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+
+	if err := store.Put(ctx, key, []byte("image"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, contentType, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rc.Close()
+
+	if string(data) != "image" || contentType != "image/png" {
+		t.Errorf("got: %q (%s), want: %q (%s)", data, contentType, "image", "image/png")
+	}
+
+	if err = store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete(ctx, key); err != nil {
+		t.Errorf("expected deleting missing blob to succeed, got: %v", err)
+	}
+
+	if _, _, err = store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Suffix of files holding content types of the blobs
+const contentTypeSuffix = ".content-type"
+
+// FileStore keeps blobs as files under the root directory
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) *FileStore {
+	return &FileStore{root: root}
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	if !ValidKey(key) || strings.HasSuffix(key, contentTypeSuffix) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	// Blob is written to a temporary file first, so readers never see it half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return errors.Join(err, tmp.Close())
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(path+contentTypeSuffix, []byte(contentType), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// #nosec G304 -- key is validated to stay within the root
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, "", ErrNotFound
+		}
+		return nil, "", err
+	}
+
+	// #nosec G304 -- key is validated to stay within the root
+	contentType, err := os.ReadFile(path + contentTypeSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, "", errors.Join(err, f.Close())
+	}
+
+	return f, string(contentType), nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []string{path, path + contentTypeSuffix} {
+		if err = os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
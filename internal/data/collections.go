@@ -0,0 +1,458 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+var ErrUnknownMovie = errors.New("unknown movie")
+
+// MaxCollectionMovies is the maximal number of movies in a collection
+const MaxCollectionMovies = 1000
+
+type CollectionRepository interface {
+	Insert(collection *Collection) error
+	Get(id int64) (*Collection, error)
+	// GetAllVisible returns public collections along with the private ones of the user
+	GetAllVisible(userID int64, filters Filters) ([]*Collection, Metadata, error)
+	Update(collection *Collection) error
+	Delete(id int64) error
+	// SetMovies replaces movies of the collection keeping their order. It returns
+	// ErrUnknownMovie if any of the movies doesn't exist. Version of the
+	// collection is checked and bumped just like by Update.
+	SetMovies(collection *Collection, movieIDs []int64) error
+}
+
+// Collection is an ordered list of movies, e.g. a franchise or a curated
+// selection. Private collections are only visible to their owners.
+type Collection struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	OwnerID     int64     `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Public      bool      `json:"public"`
+	MovieIDs    []int64   `json:"movie_ids"`
+	Version     int32     `json:"version"`
+}
+
+// VisibleTo reports whether the user may see the collection
+func (c *Collection) VisibleTo(user *User) bool {
+	return c.Public || (!user.IsAnonymous() && c.OwnerID == user.ID)
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(strings.TrimSpace(collection.Name) != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(collection.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+}
+
+func ValidateCollectionMovies(v *validator.Validator, movieIDs []int64) {
+	v.Check(len(movieIDs) <= MaxCollectionMovies, "movie_ids", fmt.Sprintf("must not contain more than %d movies", MaxCollectionMovies))
+	v.Check(validator.Unique(movieIDs), "movie_ids", "must not contain duplicate movies")
+	v.Check(!slices.ContainsFunc(movieIDs, func(id int64) bool { return id < 1 }), "movie_ids", "must only contain positive integers")
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+// collectionColumns selects collection c along with ids of its movies in order
+const collectionColumns = `
+	c.id, c.created_at, c.owner_id, c.name, c.description, c.public, c.version,
+	ARRAY(SELECT movie_id FROM collection_movies WHERE collection_id = c.id ORDER BY position)`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCollection(row rowScanner, collection *Collection, dest ...any) error {
+	var movieIDs pgtype.Int8Array
+
+	dest = append(dest,
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.OwnerID,
+		&collection.Name,
+		&collection.Description,
+		&collection.Public,
+		&collection.Version,
+		&movieIDs,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	collection.MovieIDs = make([]int64, len(movieIDs.Elements))
+	for i, el := range movieIDs.Elements {
+		collection.MovieIDs[i] = el.Int
+	}
+	return nil
+}
+
+func (m CollectionModel) Insert(collection *Collection) error {
+	query := `
+		INSERT INTO collections (owner_id, name, description, public)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	args := []any{collection.OwnerID, collection.Name, collection.Description, collection.Public}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	collection.MovieIDs = []int64{}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+}
+
+func (m CollectionModel) Get(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections c
+		WHERE c.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var collection Collection
+	if err := scanCollection(m.DB.QueryRowContext(ctx, query, id), &collection); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &collection, nil
+}
+
+func (m CollectionModel) GetAllVisible(userID int64, filters Filters) (collections []*Collection, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM collections c
+		WHERE c.public OR c.owner_id = $1
+		ORDER BY c.%s %s, c.id ASC
+		LIMIT $2 OFFSET $3`, collectionColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	totalRecords := 0
+	collections = []*Collection{}
+	for rows.Next() {
+		var collection Collection
+		if err = scanCollection(rows, &collection, &totalRecords); err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, &collection)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return collections, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m CollectionModel) Update(collection *Collection) error {
+	query := `
+		UPDATE collections
+		SET name = $1, description = $2, public = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+
+	args := []any{collection.Name, collection.Description, collection.Public, collection.ID, collection.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.Version); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "DELETE FROM collections WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m CollectionModel) SetMovies(collection *Collection, movieIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		UPDATE collections
+		SET version = version + 1
+		WHERE id = $1 AND version = $2
+		RETURNING version`
+
+	var version int32
+	if err = tx.QueryRowContext(ctx, query, collection.ID, collection.Version).Scan(&version); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM collection_movies WHERE collection_id = $1", collection.ID); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO collection_movies (collection_id, movie_id, position)
+		SELECT $1, t.movie_id, t.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS t(movie_id, position)`
+
+	if _, err = tx.ExecContext(ctx, query, collection.ID, movieIDs); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrUnknownMovie
+		default:
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	collection.Version = version
+	collection.MovieIDs = slices.Clone(movieIDs)
+	return nil
+}
+
+type CollectionInMemRepo struct {
+	mu          sync.RWMutex
+	idCounter   int64
+	collections map[int64]*Collection
+	movies      *MovieInMemRepo
+	clock       Clock
+}
+
+func NewCollectionInMemRepo(movies *MovieInMemRepo) *CollectionInMemRepo {
+	return &CollectionInMemRepo{
+		idCounter:   1,
+		collections: make(map[int64]*Collection),
+		movies:      movies,
+		clock:       MockClock{},
+	}
+}
+
+func (m *CollectionInMemRepo) Insert(collection *Collection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	collection.ID = m.idCounter
+	collection.CreatedAt = m.clock.Now()
+	collection.MovieIDs = []int64{}
+	collection.Version = 1
+
+	c := *collection
+	m.collections[c.ID] = &c
+	m.idCounter++
+
+	return nil
+}
+
+func (m *CollectionInMemRepo) Get(id int64) (*Collection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	collection, ok := m.collections[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	c := *collection
+	c.MovieIDs = slices.Clone(collection.MovieIDs)
+	return &c, nil
+}
+
+func (m *CollectionInMemRepo) GetAllVisible(userID int64, filters Filters) ([]*Collection, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	collections := make([]*Collection, 0, len(m.collections))
+	for _, collection := range m.collections {
+		if collection.Public || collection.OwnerID == userID {
+			c := *collection
+			c.MovieIDs = slices.Clone(collection.MovieIDs)
+			collections = append(collections, &c)
+		}
+	}
+
+	slices.SortFunc(collections, func(a, b *Collection) int {
+		var c int
+		switch filters.sortColumn() {
+		case "name":
+			c = strings.Compare(a.Name, b.Name)
+		case "created_at":
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if filters.sortDirection() == "DESC" {
+			c = -c
+		}
+		if filters.sortColumn() == "id" && filters.sortDirection() == "DESC" {
+			return cmp.Compare(b.ID, a.ID)
+		}
+		return cmp.Or(c, cmp.Compare(a.ID, b.ID))
+	})
+
+	totalRecords := len(collections)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return collections[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *CollectionInMemRepo) Update(collection *Collection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.collections[collection.ID]
+	if !ok || stored.Version != collection.Version {
+		return ErrEditConflict
+	}
+
+	updated := *stored
+	updated.Name = collection.Name
+	updated.Description = collection.Description
+	updated.Public = collection.Public
+	updated.Version++
+	m.collections[collection.ID] = &updated
+
+	collection.Version = updated.Version
+	return nil
+}
+
+func (m *CollectionInMemRepo) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.collections[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.collections, id)
+	return nil
+}
+
+func (m *CollectionInMemRepo) SetMovies(collection *Collection, movieIDs []int64) error {
+	// Movies are looked up without holding the lock, as movies repository calls
+	// back into collections when filtering by collection.
+	for _, id := range movieIDs {
+		if !m.movies.exists(id) {
+			return ErrUnknownMovie
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.collections[collection.ID]
+	if !ok || stored.Version != collection.Version {
+		return ErrEditConflict
+	}
+
+	updated := *stored
+	updated.MovieIDs = slices.Clone(movieIDs)
+	updated.Version++
+	m.collections[collection.ID] = &updated
+
+	collection.MovieIDs = slices.Clone(movieIDs)
+	collection.Version = updated.Version
+	return nil
+}
+
+// movieIDs returns ids of movies in the collection
+func (m *CollectionInMemRepo) movieIDs(collectionID int64) []int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if collection, ok := m.collections[collectionID]; ok {
+		return slices.Clone(collection.MovieIDs)
+	}
+	return nil
+}
+
+// repoint replaces the merged movie with the survivor in collections keeping
+// its position, unless the survivor is already there
+func (m *CollectionInMemRepo) repoint(from, into int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, collection := range m.collections {
+		i := slices.Index(collection.MovieIDs, from)
+		if i == -1 {
+			continue
+		}
+		if slices.Contains(collection.MovieIDs, into) {
+			collection.MovieIDs = slices.Delete(collection.MovieIDs, i, i+1)
+		} else {
+			collection.MovieIDs[i] = into
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+var ErrUnknownPerson = errors.New("unknown person")
+
+var CreditRoles = []string{
+	"director", "actor", "writer", "producer", "composer", "cinematographer", "editor",
+}
+
+type CreditRepository interface {
+	// GetForMovies returns credits of the movies keyed by movie id in billing order
+	GetForMovies(movieIDs ...int64) (map[int64][]*Credit, error)
+	// GetForPerson returns credits of the person in movies outside of the trash
+	GetForPerson(personID int64) ([]*Credit, error)
+	// SetForMovie replaces all credits of the movie. It returns ErrUnknownPerson
+	// if any of the credited people doesn't exist.
+	SetForMovie(movieID int64, credits []*Credit) error
+}
+
+// Credit links a person to a movie in a given role
+type Credit struct {
+	MovieID  int64  `json:"movie_id"`
+	PersonID int64  `json:"person_id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	// Character played by an actor
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+func ValidateCredits(v *validator.Validator, credits []*Credit) {
+	v.Check(len(credits) <= 500, "credits", "must not contain more than 500 credits")
+
+	seen := make(map[string]bool, len(credits))
+	for i, c := range credits {
+		key := fmt.Sprintf("credits[%d]", i)
+
+		v.Check(c.PersonID > 0, key+".person_id", "must be a positive integer")
+		v.Check(validator.PermittedValue(c.Role, CreditRoles...), key+".role", "must be one of "+strings.Join(CreditRoles, ", "))
+		v.Check(len(c.Character) <= 500, key+".character", "must not be more than 500 bytes long")
+		v.Check(c.BillingOrder >= 0, key+".billing_order", "must not be negative")
+
+		pair := fmt.Sprintf("%d/%s", c.PersonID, c.Role)
+		v.Check(!seen[pair], key, "must not repeat the same person in the same role")
+		seen[pair] = true
+	}
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+func (m CreditModel) GetForMovies(movieIDs ...int64) (credits map[int64][]*Credit, err error) {
+	query := `
+		SELECT c.movie_id, c.person_id, p.name, c.role, c.character, c.billing_order
+		FROM movie_credits c
+		INNER JOIN people p ON p.id = c.person_id
+		WHERE c.movie_id = ANY($1)
+		ORDER BY c.movie_id, c.billing_order, p.name, c.role`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	credits = make(map[int64][]*Credit, len(movieIDs))
+	for rows.Next() {
+		var c Credit
+		if err = rows.Scan(&c.MovieID, &c.PersonID, &c.Name, &c.Role, &c.Character, &c.BillingOrder); err != nil {
+			return nil, err
+		}
+		credits[c.MovieID] = append(credits[c.MovieID], &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+func (m CreditModel) GetForPerson(personID int64) (credits []*Credit, err error) {
+	query := `
+		SELECT c.movie_id, c.person_id, p.name, c.role, c.character, c.billing_order
+		FROM movie_credits c
+		INNER JOIN people p ON p.id = c.person_id
+		INNER JOIN movies m ON m.id = c.movie_id
+		WHERE c.person_id = $1 AND m.deleted_at IS NULL
+		ORDER BY m.year DESC, c.movie_id, c.role`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	credits = []*Credit{}
+	for rows.Next() {
+		var c Credit
+		if err = rows.Scan(&c.MovieID, &c.PersonID, &c.Name, &c.Role, &c.Character, &c.BillingOrder); err != nil {
+			return nil, err
+		}
+		credits = append(credits, &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+func (m CreditModel) SetForMovie(movieID int64, credits []*Credit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM movie_credits WHERE movie_id = $1", movieID); err != nil {
+		return err
+	}
+
+	if len(credits) > 0 {
+		values := make([]string, 0, len(credits))
+		args := make([]any, 0, 5*len(credits))
+		for i, c := range credits {
+			n := 5 * i
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+			args = append(args, movieID, c.PersonID, c.Role, c.Character, c.BillingOrder)
+		}
+
+		// #nosec G201 -- only placeholders are formatted into the query
+		query := fmt.Sprintf(`
+			INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+			VALUES %s`, strings.Join(values, ", "))
+
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			var pgErr *pgconn.PgError
+			switch {
+			case errors.As(err, &pgErr) && pgErr.Code == "23503":
+				return ErrUnknownPerson
+			default:
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+type CreditInMemRepo struct {
+	mu      sync.RWMutex
+	credits map[int64][]*Credit
+	people  PersonRepository
+	movies  MovieReader
+}
+
+// NewCreditInMemRepo creates credits repository looking up people and movies in
+// the given repositories. Credits of deleted people are skipped, just like rows
+// removed by cascading deletes.
+func NewCreditInMemRepo(people PersonRepository, movies MovieReader) *CreditInMemRepo {
+	return &CreditInMemRepo{
+		credits: make(map[int64][]*Credit),
+		people:  people,
+		movies:  movies,
+	}
+}
+
+func (m *CreditInMemRepo) GetForMovies(movieIDs ...int64) (map[int64][]*Credit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	credits := make(map[int64][]*Credit, len(movieIDs))
+	for _, id := range movieIDs {
+		for _, c := range m.credits[id] {
+			if credit, ok := m.withName(c); ok {
+				credits[id] = append(credits[id], credit)
+			}
+		}
+		slices.SortStableFunc(credits[id], func(a, b *Credit) int {
+			return cmp.Or(
+				cmp.Compare(a.BillingOrder, b.BillingOrder),
+				strings.Compare(a.Name, b.Name),
+				strings.Compare(a.Role, b.Role),
+			)
+		})
+	}
+
+	return credits, nil
+}
+
+func (m *CreditInMemRepo) GetForPerson(personID int64) ([]*Credit, error) {
+	m.mu.RLock()
+	var credits []*Credit
+	for _, movieCredits := range m.credits {
+		for _, c := range movieCredits {
+			if c.PersonID != personID {
+				continue
+			}
+			if credit, ok := m.withName(c); ok {
+				credits = append(credits, credit)
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	// Movies are looked up without holding the lock, as movies repository
+	// calls back into credits when filtering by person.
+	years := make(map[int64]int32, len(credits))
+	found := make([]*Credit, 0, len(credits))
+	for _, c := range credits {
+		movie, err := m.movies.GetByID(c.MovieID)
+		if err != nil {
+			if errors.Is(err, ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		years[c.MovieID] = movie.Year
+		found = append(found, c)
+	}
+
+	slices.SortFunc(found, func(a, b *Credit) int {
+		return cmp.Or(
+			cmp.Compare(years[b.MovieID], years[a.MovieID]),
+			cmp.Compare(a.MovieID, b.MovieID),
+			strings.Compare(a.Role, b.Role),
+		)
+	})
+
+	return found, nil
+}
+
+func (m *CreditInMemRepo) SetForMovie(movieID int64, credits []*Credit) error {
+	for _, c := range credits {
+		if _, err := m.people.GetByID(c.PersonID); err != nil {
+			if errors.Is(err, ErrRecordNotFound) {
+				return ErrUnknownPerson
+			}
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := make([]*Credit, len(credits))
+	for i, c := range credits {
+		credit := *c
+		credit.MovieID = movieID
+		credit.Name = ""
+		stored[i] = &credit
+	}
+	m.credits[movieID] = stored
+
+	return nil
+}
+
+// movieIDsForPerson returns ids of all movies crediting the person
+func (m *CreditInMemRepo) movieIDsForPerson(personID int64) []int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, err := m.people.GetByID(personID); err != nil {
+		return nil
+	}
+
+	var ids []int64
+	for movieID, credits := range m.credits {
+		if slices.ContainsFunc(credits, func(c *Credit) bool { return c.PersonID == personID }) {
+			ids = append(ids, movieID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// withName returns a copy of the credit with the current name of the person.
+// It reports false if the person was deleted. Caller must hold the lock.
+func (m *CreditInMemRepo) withName(c *Credit) (*Credit, bool) {
+	person, err := m.people.GetByID(c.PersonID)
+	if err != nil {
+		return nil, false
+	}
+
+	credit := *c
+	credit.Name = person.Name
+	return &credit, true
+}
@@ -0,0 +1,452 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Movies are duplicates when their normalized titles and years are the same.
+// Only movies outside of the trash are checked.
+
+// normalizedTitle lowercases the title and replaces runs of anything but
+// letters and digits with a single space, the same as the title_key column.
+func normalizedTitle(title string) string {
+	return strings.Join(searchWords(title), " ")
+}
+
+// isDuplicateMovie reports whether err is a violation of the unique index of
+// normalized titles and years
+func isDuplicateMovie(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "movies_title_key_year_idx"
+}
+
+// DuplicatePair is a pair of movies with similar titles released in the same
+// or adjacent years. Movies only have id, title and year set.
+type DuplicatePair struct {
+	Movie      *Movie  `json:"movie"`
+	Duplicate  *Movie  `json:"duplicate"`
+	Similarity float64 `json:"similarity"`
+}
+
+func (m MovieModel) Duplicates(minSimilarity float64, filters Filters) (pairs []*DuplicatePair, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), a.id, a.title, a.year, b.id, b.title, b.year,
+			round(similarity(a.title, b.title)::numeric, 2)::double precision AS similarity
+		FROM movies a
+		INNER JOIN movies b ON a.id < b.id AND abs(a.year - b.year) <= 1 AND a.title %% b.title
+		WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+		AND similarity(a.title, b.title) >= $1
+		ORDER BY %s %s, a.id ASC, b.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, minSimilarity, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	totalRecords := 0
+	pairs = []*DuplicatePair{}
+	for rows.Next() {
+		pair := DuplicatePair{Movie: new(Movie), Duplicate: new(Movie)}
+		err = rows.Scan(
+			&totalRecords,
+			&pair.Movie.ID,
+			&pair.Movie.Title,
+			&pair.Movie.Year,
+			&pair.Duplicate.ID,
+			&pair.Duplicate.Title,
+			&pair.Duplicate.Year,
+			&pair.Similarity,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		pairs = append(pairs, &pair)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return pairs, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MovieModel) GetRedirect(id int64) (int64, error) {
+	query := `
+		SELECT movie_id
+		FROM movie_redirects
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movieID int64
+	if err := m.DB.QueryRowContext(ctx, query, id).Scan(&movieID); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return movieID, nil
+}
+
+// mergeMovieFields folds fields of the merged movie into the survivor. Genres
+// are united, the poster and external ids are only taken where the survivor
+// has none.
+func mergeMovieFields(from, into *Movie) {
+	genres := slices.Clone(into.Genres)
+	for _, g := range from.Genres {
+		if !slices.Contains(genres, g) {
+			genres = append(genres, g)
+		}
+	}
+	into.Genres = genres
+
+	if into.Poster == nil {
+		into.Poster = from.Poster
+	}
+
+	if len(from.ExternalIDs) > 0 {
+		ids := make(ExternalIDs, len(into.ExternalIDs)+len(from.ExternalIDs))
+		for provider, id := range from.ExternalIDs {
+			ids[provider] = id
+		}
+		for provider, id := range into.ExternalIDs {
+			ids[provider] = id
+		}
+		into.ExternalIDs = ids
+	}
+}
+
+func (m MovieModel) Merge(from, into *Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := beginRevisionTx(ctx, m.DB, userID, RevisionMerge)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// The merged movie is deleted, so it's only locked instead of getting a
+	// new version
+	var locked bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT true
+		FROM movies
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		FOR UPDATE`, from.ID, from.Version).Scan(&locked)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	// Rows of the merged movie conflicting with the survivor ones are left
+	// behind and removed along with the merged movie.
+	repoint := []string{
+		`INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+		SELECT $2, person_id, role, character, billing_order
+		FROM movie_credits WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO movie_ratings (movie_id, user_id, rating, review, created_at, updated_at)
+		SELECT $2, user_id, rating, review, created_at, updated_at
+		FROM movie_ratings WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO watchlist (user_id, movie_id, added_at)
+		SELECT user_id, $2, added_at
+		FROM watchlist WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+		`UPDATE watched SET movie_id = $2 WHERE movie_id = $1`,
+		`UPDATE movie_external_ids SET movie_id = $2
+		WHERE movie_id = $1 AND provider NOT IN (
+			SELECT provider FROM movie_external_ids WHERE movie_id = $2
+		)`,
+		`INSERT INTO movie_titles (movie_id, locale, title)
+		SELECT $2, locale, title
+		FROM movie_titles WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO movie_releases (movie_id, country, released_on)
+		SELECT $2, country, released_on
+		FROM movie_releases WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+		`UPDATE collection_movies SET movie_id = $2
+		WHERE movie_id = $1 AND collection_id NOT IN (
+			SELECT collection_id FROM collection_movies WHERE movie_id = $2
+		)`,
+		`UPDATE movie_stills SET movie_id = $2 WHERE movie_id = $1`,
+		`UPDATE movie_redirects SET movie_id = $2 WHERE movie_id = $1`,
+		`INSERT INTO movie_redirects (id, movie_id) VALUES ($1, $2)`,
+	}
+	for _, query := range repoint {
+		if _, err = tx.ExecContext(ctx, query, from.ID, into.ID); err != nil {
+			return err
+		}
+	}
+
+	mergeMovieFields(from, into)
+
+	var posterKey *string
+	if into.Poster != nil {
+		posterKey = &into.Poster.Key
+	}
+
+	query := `
+		UPDATE movies
+		SET genres = $1, poster_key = $2, version = version + 1,
+			rating_sum = (SELECT COALESCE(SUM(rating), 0) FROM movie_ratings WHERE movie_id = $3),
+			rating_count = (SELECT COUNT(*) FROM movie_ratings WHERE movie_id = $3)
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+		RETURNING version, rating, rating_count`
+
+	err = tx.QueryRowContext(ctx, query, into.Genres, posterKey, into.ID, into.Version).Scan(
+		&into.Version,
+		&into.Rating,
+		&into.RatingCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM movies WHERE id = $1", from.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *MovieInMemRepo) Duplicates(minSimilarity float64, filters Filters) ([]*DuplicatePair, Metadata, error) {
+	m.mu.RLock()
+	movies := make([]*Movie, 0, len(m.movies))
+	for _, movie := range m.movies {
+		if movie.DeletedAt == nil {
+			movies = append(movies, movie)
+		}
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(movies, func(a, b *Movie) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	pairs := []*DuplicatePair{}
+	for i, a := range movies {
+		for _, b := range movies[i+1:] {
+			if a.Year-b.Year > 1 || b.Year-a.Year > 1 {
+				continue
+			}
+
+			similarity := trigramSimilarity(a.Title, b.Title)
+			if similarity < trigramThreshold || similarity < minSimilarity {
+				continue
+			}
+
+			pairs = append(pairs, &DuplicatePair{
+				Movie:      &Movie{ID: a.ID, Title: a.Title, Year: a.Year},
+				Duplicate:  &Movie{ID: b.ID, Title: b.Title, Year: b.Year},
+				Similarity: math.Round(similarity*100) / 100,
+			})
+		}
+	}
+
+	slices.SortStableFunc(pairs, func(a, b *DuplicatePair) int {
+		c := cmp.Compare(a.Similarity, b.Similarity)
+		if filters.sortDirection() == "DESC" {
+			c = -c
+		}
+		return c
+	})
+
+	totalRecords := len(pairs)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return pairs[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *MovieInMemRepo) GetRedirect(id int64) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movieID, ok := m.redirects[id]
+	if _, exists := m.movies[movieID]; !ok || !exists {
+		return 0, ErrRecordNotFound
+	}
+	return movieID, nil
+}
+
+func (m *MovieInMemRepo) Merge(from, into *Movie, userID int64) error {
+	m.mu.Lock()
+
+	storedFrom, ok := m.movies[from.ID]
+	if !ok || storedFrom.DeletedAt != nil || storedFrom.Version != from.Version {
+		m.mu.Unlock()
+		return ErrEditConflict
+	}
+	storedInto, ok := m.movies[into.ID]
+	if !ok || storedInto.DeletedAt != nil || storedInto.Version != into.Version {
+		m.mu.Unlock()
+		return ErrEditConflict
+	}
+
+	mergeMovieFields(storedFrom, into)
+
+	updated := *storedInto
+	updated.Genres = into.Genres
+	updated.Poster = into.Poster
+	updated.ExternalIDs = cloneExternalIDs(into.ExternalIDs)
+	updated.Version++
+	m.movies[into.ID] = &updated
+
+	delete(m.movies, from.ID)
+	for old, id := range m.redirects {
+		if id == from.ID {
+			m.redirects[old] = into.ID
+		}
+	}
+	m.redirects[from.ID] = into.ID
+
+	m.logChange(ChangeDeleted, storedFrom)
+	m.logChange(ChangeUpdated, &updated)
+	m.recordRevision(&updated, RevisionMerge, userID)
+
+	m.mu.Unlock()
+
+	// Related repositories are updated without holding the lock, as they call
+	// back into movies, e.g. to aggregate ratings.
+	if m.credits != nil {
+		m.credits.repoint(from.ID, into.ID)
+	}
+	if m.ratings != nil {
+		m.ratings.repoint(from.ID, into.ID)
+	}
+	if m.watchlist != nil {
+		m.watchlist.repoint(from.ID, into.ID)
+	}
+	if m.watched != nil {
+		m.watched.repoint(from.ID, into.ID)
+	}
+	if m.collections != nil {
+		m.collections.repoint(from.ID, into.ID)
+	}
+	if m.localizations != nil {
+		m.localizations.repoint(from.ID, into.ID)
+	}
+	if m.stills != nil {
+		m.stills.repoint(from.ID, into.ID)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored := m.movies[into.ID]
+	into.Version = stored.Version
+	into.Rating = stored.Rating
+	into.RatingCount = stored.RatingCount
+	return nil
+}
+
+// repoint moves credits of the merged movie to the survivor skipping people
+// already credited there in the same role
+func (m *CreditInMemRepo) repoint(from, into int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.credits[from] {
+		if slices.ContainsFunc(m.credits[into], func(s *Credit) bool {
+			return s.PersonID == c.PersonID && s.Role == c.Role
+		}) {
+			continue
+		}
+		c.MovieID = into
+		m.credits[into] = append(m.credits[into], c)
+	}
+	delete(m.credits, from)
+}
+
+// repoint moves ratings of the merged movie to the survivor. Ratings of users
+// who rated both movies are kept from the survivor.
+func (m *RatingInMemRepo) repoint(from, into int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.ratings[from] {
+		if m.find(into, r.UserID) != -1 {
+			continue
+		}
+		r.MovieID = into
+		m.ratings[into] = append(m.ratings[into], r)
+	}
+	delete(m.ratings, from)
+
+	m.aggregate(into)
+}
+
+// repoint replaces the merged movie with the survivor in watchlists unless it's
+// already there
+func (m *WatchlistInMemRepo) repoint(from, into int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for userID, items := range m.watchlist {
+		hasInto := slices.ContainsFunc(items, func(item watchlistItem) bool {
+			return item.movieID == into
+		})
+
+		kept := items[:0]
+		for _, item := range items {
+			if item.movieID == from {
+				if hasInto {
+					continue
+				}
+				item.movieID = into
+			}
+			kept = append(kept, item)
+		}
+		m.watchlist[userID] = kept
+	}
+}
+
+// repoint moves watched log entries of the merged movie to the survivor
+func (m *WatchedInMemRepo) repoint(from, into int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, items := range m.watched {
+		for i := range items {
+			if items[i].movieID == from {
+				items[i].movieID = into
+			}
+		}
+	}
+}
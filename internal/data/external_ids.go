@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// ExternalProviders are known sources of external movie identifiers along with
+// the format of their identifiers
+var ExternalProviders = map[string]*regexp.Regexp{
+	"imdb":     regexp.MustCompile(`^tt\d{7,10}$`),
+	"tmdb":     regexp.MustCompile(`^[1-9]\d{0,9}$`),
+	"wikidata": regexp.MustCompile(`^Q[1-9]\d{0,11}$`),
+}
+
+// ExternalIDs maps providers to identifiers the movie has there, e.g.
+// {"imdb": "tt0111161"}. Every identifier belongs to a single movie.
+type ExternalIDs map[string]string
+
+func (e *ExternalIDs) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into external ids", src)
+	}
+
+	return json.Unmarshal(raw, e)
+}
+
+// jsonb returns external ids as a JSON object accepted by jsonb_each_text
+func (e ExternalIDs) jsonb() (string, error) {
+	if e == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(e)
+	return string(b), err
+}
+
+func ValidateExternalIDs(v *validator.Validator, ids ExternalIDs) {
+	for provider, id := range ids {
+		key := "external_ids." + provider
+
+		rx, ok := ExternalProviders[provider]
+		if !ok {
+			v.AddError(key, "must be one of known providers: imdb, tmdb, wikidata")
+			continue
+		}
+		v.Check(validator.Matches(id, rx), key, "must be a valid "+provider+" identifier")
+	}
+}
+
+// externalIDsColumn selects external ids of the movie table aliased as table
+func externalIDsColumn(table string) string {
+	return fmt.Sprintf(`(
+			SELECT jsonb_object_agg(e.provider, e.external_id)
+			FROM movie_external_ids e
+			WHERE e.movie_id = %s.id
+		)`, table)
+}
+
+// isDuplicateExternalID reports whether err is a violation of the unique
+// constraint of external ids
+func isDuplicateExternalID(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" &&
+		strings.HasPrefix(pgErr.ConstraintName, "movie_external_ids")
+}
+
+func (m MovieModel) GetByExternalID(provider, externalID string) (*Movie, error) {
+	query := `
+		SELECT movie_id
+		FROM movie_external_ids
+		WHERE provider = $1 AND external_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	if err := m.DB.QueryRowContext(ctx, query, provider, externalID).Scan(&id); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m.GetByID(id)
+}
+
+func (m *MovieInMemRepo) GetByExternalID(provider, externalID string) (*Movie, error) {
+	m.mu.RLock()
+	var id int64
+	for _, movie := range m.movies {
+		if externalID != "" && movie.ExternalIDs[provider] == externalID {
+			id = movie.ID
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	return m.GetByID(id)
+}
+
+// externalIDsTaken reports whether any of the ids belongs to another movie,
+// including the trashed ones. Caller must hold the lock.
+func (m *MovieInMemRepo) externalIDsTaken(movieID int64, ids ExternalIDs) bool {
+	for _, movie := range m.movies {
+		if movie.ID == movieID {
+			continue
+		}
+		for provider, id := range ids {
+			if movie.ExternalIDs[provider] == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cloneExternalIDs keeps stored ids from being changed through maps of the
+// callers. Nil ids are kept nil.
+func cloneExternalIDs(ids ExternalIDs) ExternalIDs {
+	if ids == nil {
+		return nil
+	}
+	return maps.Clone(ids)
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MovieFacets are names of facets which can be counted for movie listings
+var MovieFacets = []string{"genres", "decade", "runtime_bucket"}
+
+// Facets holds counts of movies per value of every requested facet
+type Facets map[string][]FacetCount
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// runtimeBucket is a range of runtimes. Upper bound is exclusive, zero means unbounded.
+type runtimeBucket struct {
+	label    string
+	from, to Runtime
+}
+
+var runtimeBuckets = []runtimeBucket{
+	{label: "0-89", from: 0, to: 90},
+	{label: "90-119", from: 90, to: 120},
+	{label: "120-149", from: 120, to: 150},
+	{label: "150+", from: 150},
+}
+
+// facetQuery returns query counting movies matching where conditions per value
+// of the facet. Genres are ordered by count, other facets by their value.
+func facetQuery(facet, where string) string {
+	switch facet {
+	case "genres":
+		return fmt.Sprintf(`
+			SELECT g, COUNT(*)
+			FROM movies, unnest(genres) AS g
+			WHERE %s
+			GROUP BY g
+			ORDER BY COUNT(*) DESC, g ASC`, where)
+	case "decade":
+		return fmt.Sprintf(`
+			SELECT ((year / 10) * 10)::text || 's', COUNT(*)
+			FROM movies
+			WHERE %s
+			GROUP BY year / 10
+			ORDER BY year / 10 ASC`, where)
+	case "runtime_bucket":
+		bucket := "CASE"
+		for _, b := range runtimeBuckets {
+			if b.to == 0 {
+				bucket += fmt.Sprintf(" ELSE '%s'", b.label)
+				continue
+			}
+			bucket += fmt.Sprintf(" WHEN runtime < %d THEN '%s'", b.to, b.label)
+		}
+		bucket += " END"
+
+		return fmt.Sprintf(`
+			SELECT %s, COUNT(*)
+			FROM movies
+			WHERE %s
+			GROUP BY 1
+			ORDER BY MIN(runtime) ASC`, bucket, where)
+	}
+	panic("unknown facet: " + facet)
+}
+
+func (m MovieModel) Facets(movieFilters MovieFilters, facets []string) (Facets, error) {
+	where, args := movieFilters.where()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result := make(Facets, len(facets))
+	for _, facet := range facets {
+		counts, err := queryFacet(ctx, m.DB, facetQuery(facet, where), args)
+		if err != nil {
+			return nil, err
+		}
+		result[facet] = counts
+	}
+
+	return result, nil
+}
+
+func queryFacet(ctx context.Context, db *sql.DB, query string, args []any) (counts []FacetCount, err error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	counts = []FacetCount{}
+	for rows.Next() {
+		var c FacetCount
+		if err = rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+func (m *MovieInMemRepo) Facets(movieFilters MovieFilters, facets []string) (Facets, error) {
+	m.mu.RLock()
+	movies := m.filter(movieFilters)
+	m.mu.RUnlock()
+
+	result := make(Facets, len(facets))
+	for _, facet := range facets {
+		counts := make(map[string]int)
+		// Sort keys of the values, so the facets are ordered like in SQL
+		keys := make(map[string]int)
+
+		for _, mov := range movies {
+			switch facet {
+			case "genres":
+				for _, g := range mov.Genres {
+					counts[g]++
+				}
+			case "decade":
+				decade := int(mov.Year) / 10 * 10
+				value := strconv.Itoa(decade) + "s"
+				counts[value]++
+				keys[value] = decade
+			case "runtime_bucket":
+				i := slices.IndexFunc(runtimeBuckets, func(b runtimeBucket) bool {
+					return b.to == 0 || mov.Runtime < b.to
+				})
+				counts[runtimeBuckets[i].label]++
+				keys[runtimeBuckets[i].label] = i
+			default:
+				panic("unknown facet: " + facet)
+			}
+		}
+
+		list := make([]FacetCount, 0, len(counts))
+		for value, count := range counts {
+			list = append(list, FacetCount{Value: value, Count: count})
+		}
+		slices.SortFunc(list, func(a, b FacetCount) int {
+			if facet == "genres" {
+				return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+			}
+			return cmp.Compare(keys[a.Value], keys[b.Value])
+		})
+		result[facet] = list
+	}
+
+	return result, nil
+}
@@ -1,17 +1,25 @@
 package data
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"slices"
 	"strings"
 
 	"github.com/shrtyk/greenlight/internal/validator"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// Cursor switches pagination to keyset mode. Nil means LIMIT/OFFSET pagination.
+	Cursor *Cursor
 }
 
 func (f Filters) Validate(v *validator.Validator) {
@@ -21,6 +29,10 @@ func (f Filters) Validate(v *validator.Validator) {
 	v.Check(f.PageSize <= 100, "page_size", "must be maximum of 100")
 
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.Cursor != nil && !f.Cursor.isStart() {
+		v.Check(f.Cursor.Sort == f.Sort, "cursor", "doesn't match sort value")
+	}
 }
 
 func (f Filters) sortColumn() string {
@@ -46,11 +58,13 @@ func (f Filters) offset() int {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -66,3 +80,79 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// Cursor is a position in a keyset paginated listing. It holds the value of the
+// sort column and the id of the row it points to.
+//
+// Backward cursors select rows placed before the position instead of after it.
+type Cursor struct {
+	Sort     string `json:"s"`
+	Value    any    `json:"v"`
+	ID       int64  `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// DecodeCursor parses opaque cursor string. Empty string is a cursor to the first page.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return &Cursor{}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&c); err != nil || c.Sort == "" || c.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+func (c Cursor) Encode() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		// Cursor values are strings, integers or ratings, which are finite
+		// float64 averages, so they always marshal
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (c Cursor) isStart() bool {
+	return c.ID == 0
+}
+
+// keysetCondition returns SQL condition selecting rows after (or before) the cursor
+// position for the given sort column and direction. $col and $id are placeholders
+// for the cursor value and id.
+func (f Filters) keysetCondition(col, id string) string {
+	colOp, idOp := ">", ">"
+	if (f.sortDirection() == "DESC") != f.Cursor.Backward {
+		colOp = "<"
+	}
+	if f.Cursor.Backward {
+		idOp = "<"
+	}
+	return "(" + f.sortColumn() + " " + colOp + " " + col +
+		" OR (" + f.sortColumn() + " = " + col + " AND id " + idOp + " " + id + "))"
+}
+
+// keysetOrder returns ORDER BY clause for keyset pagination. Backward cursors
+// are read in reverse order and flipped back by the caller.
+func (f Filters) keysetOrder() string {
+	colDir, idDir := f.sortDirection(), "ASC"
+	if f.Cursor.Backward {
+		idDir = "DESC"
+		if colDir == "ASC" {
+			colDir = "DESC"
+		} else {
+			colDir = "ASC"
+		}
+	}
+	return f.sortColumn() + " " + colDir + ", id " + idDir
+}
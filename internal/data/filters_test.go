@@ -48,3 +48,67 @@ func TestFilters(t *testing.T) {
 		t.Errorf("got: %+v, want: %+v", gotMeta, wantMeta)
 	}
 }
+
+func TestCursor(t *testing.T) {
+	c := Cursor{Sort: "-title", Value: "Moana", ID: 7}
+
+	got, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("didn't expect error but got: %v", err)
+	}
+	if !reflect.DeepEqual(*got, c) {
+		t.Errorf("got: %+v, want: %+v", *got, c)
+	}
+
+	start, err := DecodeCursor("")
+	if err != nil || !start.isStart() {
+		t.Errorf("expected start cursor, got: %+v (%v)", start, err)
+	}
+
+	for _, s := range []string{"%%%", Cursor{Sort: "id"}.Encode(), "bm90IGpzb24"} {
+		if _, err = DecodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("expected invalid cursor error for %q but got: %v", s, err)
+		}
+	}
+
+	filters := Filters{
+		Sort:         "-title",
+		SortSafelist: []string{"title", "-title"},
+		Cursor:       got,
+	}
+
+	wantCond := "(title < $4 OR (title = $4 AND id > $5))"
+	if gotCond := filters.keysetCondition("$4", "$5"); gotCond != wantCond {
+		t.Errorf("got: %s, want: %s", gotCond, wantCond)
+	}
+	if gotOrder := filters.keysetOrder(); gotOrder != "title DESC, id ASC" {
+		t.Errorf("got: %s, want: %s", gotOrder, "title DESC, id ASC")
+	}
+
+	filters.Cursor.Backward = true
+	wantCond = "(title > $4 OR (title = $4 AND id < $5))"
+	if gotCond := filters.keysetCondition("$4", "$5"); gotCond != wantCond {
+		t.Errorf("got: %s, want: %s", gotCond, wantCond)
+	}
+	if gotOrder := filters.keysetOrder(); gotOrder != "title ASC, id DESC" {
+		t.Errorf("got: %s, want: %s", gotOrder, "title ASC, id DESC")
+	}
+}
+
+func TestRatingCursor(t *testing.T) {
+	for _, rating := range []float64{0, 4.5, 10.0 / 3} {
+		movie := &Movie{ID: 7, Rating: rating}
+
+		c, err := DecodeCursor(movieCursor(movie, "-rating", false))
+		if err != nil {
+			t.Fatalf("didn't expect error but got: %v", err)
+		}
+		got, err := movieFromCursor(c, "rating")
+		if err != nil {
+			t.Fatalf("didn't expect error but got: %v", err)
+		}
+		if got.ID != movie.ID || got.Rating != rating {
+			t.Errorf("got movie %d rated %v, want movie %d rated %v", got.ID, got.Rating, movie.ID, rating)
+		}
+	}
+}
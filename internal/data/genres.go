@@ -0,0 +1,564 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+var ErrDuplicateGenre = errors.New("duplicate genre")
+
+var genreSlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type GenreRepository interface {
+	// GetAll returns genres ordered by slug along with counts of movies outside of the trash
+	GetAll() ([]*Genre, error)
+	Get(slug string) (*Genre, error)
+	// Taxonomy returns all genres without counting their movies
+	Taxonomy() (*Taxonomy, error)
+	// Insert returns ErrDuplicateGenre if the slug is already taken
+	Insert(genre *Genre) error
+	// Update saves the genre stored under slug. Changed slug is rewritten in all
+	// movies including the ones in the trash, recording their new revisions on
+	// behalf of the user.
+	Update(slug string, genre *Genre, userID int64) error
+	// Merge moves all movies of the genre from to the genre into and deletes
+	// from. Slug, name and aliases of from become aliases of into.
+	Merge(from, into string, userID int64) (*Genre, error)
+}
+
+// Genre is an entry of the managed taxonomy. Movies refer to genres by slug.
+type Genre struct {
+	Slug    string   `json:"slug"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	// MovieCount is the number of movies outside of the trash having the genre
+	MovieCount int   `json:"movie_count"`
+	Version    int32 `json:"version"`
+}
+
+// ValidateGenre checks the genre along with uniqueness of its slug, name and
+// aliases among the others genres.
+func ValidateGenre(v *validator.Validator, genre *Genre, others *Taxonomy) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 50, "slug", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(genre.Slug, genreSlugRX), "slug", "must only contain lowercase letters, digits and single hyphens")
+
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+	for _, alias := range genre.Aliases {
+		v.Check(alias != "", "aliases", "must not contain empty values")
+		v.Check(len(alias) <= 100, "aliases", "must not contain values more than 100 bytes long")
+	}
+
+	lowerAliases := make([]string, len(genre.Aliases))
+	for i, alias := range genre.Aliases {
+		lowerAliases[i] = strings.ToLower(alias)
+	}
+	v.Check(validator.Unique(lowerAliases), "aliases", "must not contain duplicate values")
+
+	if owner, ok := others.Resolve(genre.Slug); ok {
+		v.AddError("slug", fmt.Sprintf("is already used by genre %q", owner))
+	}
+	if owner, ok := others.Resolve(genre.Name); ok {
+		v.AddError("name", fmt.Sprintf("is already used by genre %q", owner))
+	}
+	for _, alias := range genre.Aliases {
+		if owner, ok := others.Resolve(alias); ok {
+			v.AddError("aliases", fmt.Sprintf("%q is already used by genre %q", alias, owner))
+		}
+	}
+}
+
+// Taxonomy is a set of genres known to the application
+type Taxonomy struct {
+	genres []*Genre
+}
+
+func NewTaxonomy(genres []*Genre) *Taxonomy {
+	return &Taxonomy{genres: genres}
+}
+
+// Has reports whether slug belongs to a known genre
+func (t *Taxonomy) Has(slug string) bool {
+	return slices.ContainsFunc(t.genres, func(g *Genre) bool {
+		return g.Slug == slug
+	})
+}
+
+// Resolve returns slug of the genre having the given slug, name or alias
+// ignoring case.
+func (t *Taxonomy) Resolve(name string) (string, bool) {
+	for _, g := range t.genres {
+		if strings.EqualFold(g.Slug, name) || strings.EqualFold(g.Name, name) {
+			return g.Slug, true
+		}
+		for _, alias := range g.Aliases {
+			if strings.EqualFold(alias, name) {
+				return g.Slug, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Suggest returns slug of the genre closest to name or empty string if no
+// genre is close enough.
+func (t *Taxonomy) Suggest(name string) string {
+	if slug, ok := t.Resolve(name); ok {
+		return slug
+	}
+
+	best, bestSimilarity := "", trigramThreshold
+	for _, g := range t.genres {
+		for _, candidate := range append([]string{g.Slug, g.Name}, g.Aliases...) {
+			if s := trigramSimilarity(name, candidate); s >= bestSimilarity {
+				best, bestSimilarity = g.Slug, s
+			}
+		}
+	}
+	return best
+}
+
+// Without returns taxonomy without the genre, so the genre can be validated
+// against the other ones.
+func (t *Taxonomy) Without(slug string) *Taxonomy {
+	return &Taxonomy{genres: slices.DeleteFunc(slices.Clone(t.genres), func(g *Genre) bool {
+		return g.Slug == slug
+	})}
+}
+
+// mergedAliases returns aliases of into extended with slug, name and aliases of from
+func mergedAliases(into, from *Genre) []string {
+	aliases := slices.Clone(into.Aliases)
+	for _, alias := range append([]string{from.Slug, from.Name}, from.Aliases...) {
+		if strings.EqualFold(alias, into.Slug) || strings.EqualFold(alias, into.Name) {
+			continue
+		}
+		if slices.ContainsFunc(aliases, func(a string) bool { return strings.EqualFold(a, alias) }) {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+func (m GenreModel) GetAll() (genres []*Genre, err error) {
+	query := `
+		SELECT g.slug, g.name, g.aliases, g.version,
+			(SELECT COUNT(*) FROM movies m WHERE m.genres @> ARRAY[g.slug] AND m.deleted_at IS NULL)
+		FROM genres g
+		ORDER BY g.slug ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	genres = []*Genre{}
+	for rows.Next() {
+		var genre Genre
+
+		err = rows.Scan(
+			&genre.Slug,
+			&genre.Name,
+			(*Genres)(&genre.Aliases),
+			&genre.Version,
+			&genre.MovieCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+func (m GenreModel) Get(slug string) (*Genre, error) {
+	query := `
+		SELECT g.slug, g.name, g.aliases, g.version,
+			(SELECT COUNT(*) FROM movies m WHERE m.genres @> ARRAY[g.slug] AND m.deleted_at IS NULL)
+		FROM genres g
+		WHERE g.slug = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var genre Genre
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&genre.Slug,
+		&genre.Name,
+		(*Genres)(&genre.Aliases),
+		&genre.Version,
+		&genre.MovieCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+func (m GenreModel) Taxonomy() (taxonomy *Taxonomy, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, "SELECT slug, name, aliases, version FROM genres")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+		if err = rows.Scan(&genre.Slug, &genre.Name, (*Genres)(&genre.Aliases), &genre.Version); err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewTaxonomy(genres), nil
+}
+
+func (m GenreModel) Insert(genre *Genre) error {
+	query := `
+		INSERT INTO genres (slug, name, aliases)
+		VALUES ($1, $2, $3)
+		RETURNING version`
+
+	args := []any{genre.Slug, genre.Name, Genres(genre.Aliases)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&genre.Version); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m GenreModel) Update(slug string, genre *Genre, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginRevisionTx(ctx, m.DB, userID, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		UPDATE genres
+		SET slug = $1, name = $2, aliases = $3, version = version + 1
+		WHERE slug = $4 AND version = $5
+		RETURNING version`
+
+	args := []any{genre.Slug, genre.Name, Genres(genre.Aliases), slug, genre.Version}
+
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&genre.Version); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	if genre.Slug != slug {
+		query = `
+			UPDATE movies
+			SET genres = array_replace(genres, $1::text, $2::text), version = version + 1
+			WHERE genres @> ARRAY[$1::text]`
+
+		if _, err = tx.ExecContext(ctx, query, slug, genre.Slug); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m GenreModel) Merge(from, into string, userID int64) (*Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginRevisionTx(ctx, m.DB, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var src, dst Genre
+	query := `
+		SELECT slug, name, aliases, version
+		FROM genres
+		WHERE slug = $1
+		FOR UPDATE`
+
+	for _, g := range []struct {
+		slug  string
+		genre *Genre
+	}{{from, &src}, {into, &dst}} {
+		err = tx.QueryRowContext(ctx, query, g.slug).Scan(&g.genre.Slug, &g.genre.Name, (*Genres)(&g.genre.Aliases), &g.genre.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, ErrRecordNotFound
+			default:
+				return nil, err
+			}
+		}
+	}
+
+	// Movies already having both genres just lose the merged one
+	queries := []string{
+		`UPDATE movies
+		SET genres = array_remove(genres, $1::text), version = version + 1
+		WHERE genres @> ARRAY[$1::text, $2::text]`,
+		`UPDATE movies
+		SET genres = array_replace(genres, $1::text, $2::text), version = version + 1
+		WHERE genres @> ARRAY[$1::text]`,
+	}
+	for _, q := range queries {
+		if _, err = tx.ExecContext(ctx, q, from, into); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM genres WHERE slug = $1", from); err != nil {
+		return nil, err
+	}
+
+	dst.Aliases = mergedAliases(&dst, &src)
+
+	query = `
+		UPDATE genres
+		SET aliases = $1, version = version + 1
+		WHERE slug = $2
+		RETURNING version,
+			(SELECT COUNT(*) FROM movies m WHERE m.genres @> ARRAY[$2::text] AND m.deleted_at IS NULL)`
+
+	if err = tx.QueryRowContext(ctx, query, Genres(dst.Aliases), into).Scan(&dst.Version, &dst.MovieCount); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &dst, nil
+}
+
+// defaultGenres are the genres the taxonomy starts with
+var defaultGenres = []*Genre{
+	{Slug: "action", Name: "Action"},
+	{Slug: "adventure", Name: "Adventure"},
+	{Slug: "animation", Name: "Animation", Aliases: []string{"animated"}},
+	{Slug: "biography", Name: "Biography", Aliases: []string{"biopic"}},
+	{Slug: "comedy", Name: "Comedy"},
+	{Slug: "crime", Name: "Crime"},
+	{Slug: "documentary", Name: "Documentary"},
+	{Slug: "drama", Name: "Drama"},
+	{Slug: "family", Name: "Family"},
+	{Slug: "fantasy", Name: "Fantasy"},
+	{Slug: "history", Name: "History", Aliases: []string{"historical"}},
+	{Slug: "horror", Name: "Horror"},
+	{Slug: "music", Name: "Music"},
+	{Slug: "musical", Name: "Musical"},
+	{Slug: "mystery", Name: "Mystery"},
+	{Slug: "romance", Name: "Romance", Aliases: []string{"romantic"}},
+	{Slug: "sci-fi", Name: "Science Fiction", Aliases: []string{"science fiction", "scifi", "sf"}},
+	{Slug: "sport", Name: "Sport", Aliases: []string{"sports"}},
+	{Slug: "thriller", Name: "Thriller"},
+	{Slug: "war", Name: "War"},
+	{Slug: "western", Name: "Western"},
+}
+
+type GenreInMemRepo struct {
+	mu     sync.RWMutex
+	genres map[string]*Genre
+	movies *MovieInMemRepo
+}
+
+// NewGenreInMemRepo returns repository holding the default genres
+func NewGenreInMemRepo(movies *MovieInMemRepo) *GenreInMemRepo {
+	genres := make(map[string]*Genre, len(defaultGenres))
+	for _, g := range defaultGenres {
+		genre := *g
+		genre.Aliases = slices.Clone(g.Aliases)
+		if genre.Aliases == nil {
+			genre.Aliases = []string{}
+		}
+		genre.Version = 1
+		genres[g.Slug] = &genre
+	}
+
+	return &GenreInMemRepo{
+		genres: genres,
+		movies: movies,
+	}
+}
+
+func (m *GenreInMemRepo) GetAll() ([]*Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := m.movies.genreCounts()
+
+	genres := make([]*Genre, 0, len(m.genres))
+	for _, g := range m.genres {
+		genre := *g
+		genre.MovieCount = counts[g.Slug]
+		genres = append(genres, &genre)
+	}
+
+	slices.SortFunc(genres, func(a, b *Genre) int {
+		return strings.Compare(a.Slug, b.Slug)
+	})
+
+	return genres, nil
+}
+
+func (m *GenreInMemRepo) Get(slug string) (*Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	g, ok := m.genres[slug]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	genre := *g
+	genre.Aliases = slices.Clone(g.Aliases)
+	genre.MovieCount = m.movies.genreCounts()[slug]
+	return &genre, nil
+}
+
+func (m *GenreInMemRepo) Taxonomy() (*Taxonomy, error) {
+	genres, err := m.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return NewTaxonomy(genres), nil
+}
+
+func (m *GenreInMemRepo) Insert(genre *Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.genres[genre.Slug]; ok {
+		return ErrDuplicateGenre
+	}
+
+	genre.Version = 1
+
+	g := *genre
+	g.Aliases = slices.Clone(genre.Aliases)
+	g.MovieCount = 0
+	m.genres[genre.Slug] = &g
+	return nil
+}
+
+func (m *GenreInMemRepo) Update(slug string, genre *Genre, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.genres[slug]
+	if !ok || stored.Version != genre.Version {
+		return ErrEditConflict
+	}
+	if _, ok = m.genres[genre.Slug]; ok && genre.Slug != slug {
+		return ErrDuplicateGenre
+	}
+
+	genre.Version++
+
+	g := *genre
+	g.Aliases = slices.Clone(genre.Aliases)
+	g.MovieCount = 0
+	delete(m.genres, slug)
+	m.genres[genre.Slug] = &g
+
+	if genre.Slug != slug {
+		m.movies.replaceGenre(slug, genre.Slug, userID)
+	}
+	return nil
+}
+
+func (m *GenreInMemRepo) Merge(from, into string, userID int64) (*Genre, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src, ok := m.genres[from]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	dst, ok := m.genres[into]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	m.movies.replaceGenre(from, into, userID)
+
+	dst.Aliases = mergedAliases(dst, src)
+	dst.Version++
+	delete(m.genres, from)
+
+	genre := *dst
+	genre.Aliases = slices.Clone(dst.Aliases)
+	genre.MovieCount = m.movies.genreCounts()[into]
+	return &genre, nil
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	// Reserve stores the record of a request in progress. If an unexpired record
+	// with the same key already exists, it's returned instead and nothing is stored.
+	Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Complete stores the response of the reserved record
+	Complete(record *IdempotencyRecord) error
+	// Delete releases the key so the request can be retried
+	Delete(userID int64, key string) error
+	// DeleteExpired deletes records which expired before the given time
+	DeleteExpired(t time.Time) (int64, error)
+}
+
+// IdempotencyRecord is the response recorded for an Idempotency-Key of the user.
+// Anonymous users share the keys of user 0.
+type IdempotencyRecord struct {
+	UserID int64
+	Key    string
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint []byte
+	// Status is zero while the request is in progress
+	Status    int
+	Header    map[string][]string
+	Body      []byte
+	ExpiresAt time.Time
+}
+
+// InProgress reports whether the response of the request isn't recorded yet
+func (r *IdempotencyRecord) InProgress() bool {
+	return r.Status == 0
+}
+
+// Matches reports whether the record was made for the request with the fingerprint
+func (r *IdempotencyRecord) Matches(fingerprint []byte) bool {
+	return bytes.Equal(r.Fingerprint, fingerprint)
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+func (m IdempotencyModel) Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, expires_at = EXCLUDED.expires_at,
+			status = 0, header = NULL, body = NULL
+		WHERE idempotency_keys.expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, record.UserID, record.Key, record.Fingerprint, record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected > 0 {
+		return nil, nil
+	}
+
+	query = `
+		SELECT fingerprint, status, header, body, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2`
+
+	existing := &IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var header []byte
+
+	err = m.DB.QueryRowContext(ctx, query, record.UserID, record.Key).Scan(
+		&existing.Fingerprint,
+		&existing.Status,
+		&header,
+		&existing.Body,
+		&existing.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if header != nil {
+		if err = json.Unmarshal(header, &existing.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return existing, nil
+}
+
+func (m IdempotencyModel) Complete(record *IdempotencyRecord) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = $3, header = $4, body = $5
+		WHERE user_id = $1 AND key = $2`
+
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, record.UserID, record.Key, record.Status, header, record.Body)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m IdempotencyModel) Delete(userID int64, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2", userID, key)
+	return err
+}
+
+func (m IdempotencyModel) DeleteExpired(t time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < $1", t)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+type IdempotencyInMemRepo struct {
+	mu      sync.Mutex
+	records map[idempotencyKey]*IdempotencyRecord
+}
+
+func NewIdempotencyInMemRepo() *IdempotencyInMemRepo {
+	return &IdempotencyInMemRepo{
+		records: make(map[idempotencyKey]*IdempotencyRecord),
+	}
+}
+
+func (m *IdempotencyInMemRepo) Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	if existing, ok := m.records[k]; ok && existing.ExpiresAt.After(time.Now()) {
+		c := *existing
+		c.Header = maps.Clone(existing.Header)
+		return &c, nil
+	}
+
+	m.records[k] = &IdempotencyRecord{
+		UserID:      record.UserID,
+		Key:         record.Key,
+		Fingerprint: record.Fingerprint,
+		ExpiresAt:   record.ExpiresAt,
+	}
+	return nil, nil
+}
+
+func (m *IdempotencyInMemRepo) Complete(record *IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.records[idempotencyKey{userID: record.UserID, key: record.Key}]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	existing.Status = record.Status
+	existing.Header = maps.Clone(record.Header)
+	existing.Body = bytes.Clone(record.Body)
+	return nil
+}
+
+func (m *IdempotencyInMemRepo) Delete(userID int64, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, idempotencyKey{userID: userID, key: key})
+	return nil
+}
+
+func (m *IdempotencyInMemRepo) DeleteExpired(t time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for k, record := range m.records {
+		if record.ExpiresAt.Before(t) {
+			delete(m.records, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,261 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+var (
+	// LocaleRX matches language tags made of a language, an optional script and
+	// an optional region, e.g. "de", "pt-BR" or "zh-Hant-TW"
+	LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-[A-Z]{2})?$`)
+	// CountryRX matches ISO 3166-1 alpha-2 country codes
+	CountryRX = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+type LocalizationRepository interface {
+	// GetForMovies returns localizations of the movies keyed by movie id. Movies
+	// without alternate titles and release dates are left out.
+	GetForMovies(movieIDs ...int64) (map[int64]*Localization, error)
+	// SetForMovie replaces alternate titles and release dates of the movie
+	SetForMovie(movieID int64, localization *Localization) error
+}
+
+// Localization holds titles a movie is known under in other languages and the
+// dates it was released in different countries
+type Localization struct {
+	// Titles are keyed by locale, e.g. "de" or "pt-BR"
+	Titles map[string]string `json:"titles"`
+	// ReleaseDates are dates in YYYY-MM-DD format keyed by country code
+	ReleaseDates map[string]string `json:"release_dates"`
+}
+
+func newLocalization() *Localization {
+	return &Localization{Titles: map[string]string{}, ReleaseDates: map[string]string{}}
+}
+
+func ValidateLocalization(v *validator.Validator, localization *Localization) {
+	v.Check(len(localization.Titles) <= 200, "titles", "must not contain more than 200 titles")
+	v.Check(len(localization.ReleaseDates) <= 300, "release_dates", "must not contain more than 300 dates")
+
+	for _, locale := range slices.Sorted(maps.Keys(localization.Titles)) {
+		title := localization.Titles[locale]
+		key := "titles." + locale
+
+		v.Check(validator.Matches(locale, LocaleRX), key, "must be keyed by a valid locale, e.g. pt-BR")
+		v.Check(title != "", key, "must be provided")
+		v.Check(len(title) <= 500, key, "must not be more than 500 bytes long")
+	}
+
+	for _, country := range slices.Sorted(maps.Keys(localization.ReleaseDates)) {
+		key := "release_dates." + country
+
+		v.Check(validator.Matches(country, CountryRX), key, "must be keyed by a valid country code, e.g. US")
+		_, err := time.Parse(time.DateOnly, localization.ReleaseDates[country])
+		v.Check(err == nil, key, "must be a date in YYYY-MM-DD format")
+	}
+}
+
+type LocalizationModel struct {
+	DB *sql.DB
+}
+
+func (m LocalizationModel) GetForMovies(movieIDs ...int64) (localizations map[int64]*Localization, err error) {
+	query := `
+		SELECT movie_id, 'title', locale, title
+		FROM movie_titles
+		WHERE movie_id = ANY($1)
+		UNION ALL
+		SELECT movie_id, 'release', country, to_char(released_on, 'YYYY-MM-DD')
+		FROM movie_releases
+		WHERE movie_id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	localizations = make(map[int64]*Localization, len(movieIDs))
+	for rows.Next() {
+		var (
+			movieID         int64
+			kind, key, text string
+		)
+		if err = rows.Scan(&movieID, &kind, &key, &text); err != nil {
+			return nil, err
+		}
+
+		l, ok := localizations[movieID]
+		if !ok {
+			l = newLocalization()
+			localizations[movieID] = l
+		}
+
+		switch kind {
+		case "title":
+			l.Titles[key] = text
+		default:
+			l.ReleaseDates[key] = text
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return localizations, nil
+}
+
+func (m LocalizationModel) SetForMovie(movieID int64, localization *Localization) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, table := range []string{"movie_titles", "movie_releases"} {
+		// #nosec G201 -- table names are constants
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE movie_id = $1", table), movieID); err != nil {
+			return err
+		}
+	}
+
+	locales := slices.Sorted(maps.Keys(localization.Titles))
+	titles := make([]string, len(locales))
+	for i, locale := range locales {
+		titles[i] = localization.Titles[locale]
+	}
+
+	countries := slices.Sorted(maps.Keys(localization.ReleaseDates))
+	dates := make([]string, len(countries))
+	for i, country := range countries {
+		dates[i] = localization.ReleaseDates[country]
+	}
+
+	query := `
+		INSERT INTO movie_titles (movie_id, locale, title)
+		SELECT $1, t.locale, t.title
+		FROM unnest($2::text[], $3::text[]) AS t(locale, title)`
+
+	if _, err = tx.ExecContext(ctx, query, movieID, locales, titles); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO movie_releases (movie_id, country, released_on)
+		SELECT $1, t.country, t.released_on
+		FROM unnest($2::text[], $3::date[]) AS t(country, released_on)`
+
+	if _, err = tx.ExecContext(ctx, query, movieID, countries, dates); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type LocalizationInMemRepo struct {
+	mu            sync.RWMutex
+	localizations map[int64]*Localization
+}
+
+func NewLocalizationInMemRepo() *LocalizationInMemRepo {
+	return &LocalizationInMemRepo{
+		localizations: make(map[int64]*Localization),
+	}
+}
+
+func (m *LocalizationInMemRepo) GetForMovies(movieIDs ...int64) (map[int64]*Localization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	localizations := make(map[int64]*Localization, len(movieIDs))
+	for _, id := range movieIDs {
+		if l, ok := m.localizations[id]; ok {
+			localizations[id] = cloneLocalization(l)
+		}
+	}
+
+	return localizations, nil
+}
+
+func (m *LocalizationInMemRepo) SetForMovie(movieID int64, localization *Localization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(localization.Titles) == 0 && len(localization.ReleaseDates) == 0 {
+		delete(m.localizations, movieID)
+		return nil
+	}
+
+	m.localizations[movieID] = cloneLocalization(localization)
+	return nil
+}
+
+// titles returns alternate titles of the movie
+func (m *LocalizationInMemRepo) titles(movieID int64) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if l, ok := m.localizations[movieID]; ok {
+		return slices.Collect(maps.Values(l.Titles))
+	}
+	return nil
+}
+
+// repoint adds localizations of the merged movie to the survivor, unless the
+// survivor already has a title in the same locale or a release date in the
+// same country
+func (m *LocalizationInMemRepo) repoint(from, into int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	merged, ok := m.localizations[from]
+	if !ok {
+		return
+	}
+	delete(m.localizations, from)
+
+	survivor, ok := m.localizations[into]
+	if !ok {
+		m.localizations[into] = merged
+		return
+	}
+
+	for locale, title := range merged.Titles {
+		if _, ok := survivor.Titles[locale]; !ok {
+			survivor.Titles[locale] = title
+		}
+	}
+	for country, date := range merged.ReleaseDates {
+		if _, ok := survivor.ReleaseDates[country]; !ok {
+			survivor.ReleaseDates[country] = date
+		}
+	}
+}
+
+func cloneLocalization(l *Localization) *Localization {
+	c := newLocalization()
+	maps.Copy(c.Titles, l.Titles)
+	maps.Copy(c.ReleaseDates, l.ReleaseDates)
+	return c
+}
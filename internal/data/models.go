@@ -13,18 +13,46 @@ var (
 
 // Models is a wrapper for all API models.
 type Models struct {
-	Movies      MovieRepository
-	Users       UserRepository
-	Tokens      TokenRepository
-	Permissions PermissionRepository
+	Movies            MovieRepository
+	MovieRevisions    MovieRevisionRepository
+	Genres            GenreRepository
+	People            PersonRepository
+	Credits           CreditRepository
+	Ratings           RatingRepository
+	Watchlist         WatchlistRepository
+	Watched           WatchedRepository
+	Collections       CollectionRepository
+	Localizations     LocalizationRepository
+	Stills            StillRepository
+	MovieChanges      MovieChangeRepository
+	Idempotency       IdempotencyRepository
+	Webhooks          WebhookRepository
+	WebhookDeliveries WebhookDeliveryRepository
+	Users             UserRepository
+	Tokens            TokenRepository
+	Permissions       PermissionRepository
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:            MovieModel{DB: db},
+		MovieRevisions:    MovieRevisionModel{DB: db},
+		Genres:            GenreModel{DB: db},
+		People:            PersonModel{DB: db},
+		Credits:           CreditModel{DB: db},
+		Ratings:           RatingModel{DB: db},
+		Watchlist:         WatchlistModel{DB: db},
+		Watched:           WatchedModel{DB: db},
+		Collections:       CollectionModel{DB: db},
+		Localizations:     LocalizationModel{DB: db},
+		Stills:            StillModel{DB: db},
+		MovieChanges:      MovieChangeModel{DB: db, Broker: NewChangeBroker()},
+		Idempotency:       IdempotencyModel{DB: db},
+		Webhooks:          WebhookModel{DB: db},
+		WebhookDeliveries: WebhookDeliveryModel{DB: db},
+		Users:             UserModel{DB: db},
+		Tokens:            TokenModel{DB: db},
+		Permissions:       PermissionModel{DB: db},
 	}
 }
 
@@ -41,10 +69,48 @@ func NewMockModels() Models {
 	userRepo.tokens = tokenRepo
 	userRepo.permissions = permRepo
 
+	movieRepo := NewMovieInMemRepo()
+	personRepo := NewPersonInMemRepo()
+	creditRepo := NewCreditInMemRepo(personRepo, movieRepo)
+
+	ratingRepo := NewRatingInMemRepo(movieRepo)
+	watchlistRepo := NewWatchlistInMemRepo(movieRepo)
+	watchedRepo := NewWatchedInMemRepo(movieRepo)
+	collectionRepo := NewCollectionInMemRepo(movieRepo)
+	localizationRepo := NewLocalizationInMemRepo()
+	stillRepo := NewStillInMemRepo(movieRepo)
+	movieChangeRepo := NewMovieChangeInMemRepo()
+	movieRevisionRepo := NewMovieRevisionInMemRepo()
+	webhookDeliveryRepo := NewWebhookDeliveryInMemRepo()
+
+	movieRepo.credits = creditRepo
+	movieRepo.ratings = ratingRepo
+	movieRepo.watchlist = watchlistRepo
+	movieRepo.watched = watchedRepo
+	movieRepo.collections = collectionRepo
+	movieRepo.localizations = localizationRepo
+	movieRepo.stills = stillRepo
+	movieRepo.changes = movieChangeRepo
+	movieRepo.revisions = movieRevisionRepo
+
 	return Models{
-		Movies:      NewMovieInMemRepo(),
-		Users:       userRepo,
-		Tokens:      tokenRepo,
-		Permissions: permRepo,
+		Movies:            movieRepo,
+		MovieRevisions:    movieRevisionRepo,
+		Genres:            NewGenreInMemRepo(movieRepo),
+		People:            personRepo,
+		Credits:           creditRepo,
+		Ratings:           ratingRepo,
+		Watchlist:         watchlistRepo,
+		Watched:           watchedRepo,
+		Collections:       collectionRepo,
+		Localizations:     localizationRepo,
+		Stills:            stillRepo,
+		MovieChanges:      movieChangeRepo,
+		Idempotency:       NewIdempotencyInMemRepo(),
+		Webhooks:          NewWebhookInMemRepo(webhookDeliveryRepo),
+		WebhookDeliveries: webhookDeliveryRepo,
+		Users:             userRepo,
+		Tokens:            tokenRepo,
+		Permissions:       permRepo,
 	}
 }
@@ -0,0 +1,256 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+type MovieChangeRepository interface {
+	// GetAfter returns up to limit changes logged after the change with the
+	// given id in the order they were committed. Changes committed after the
+	// returned ones are never ordered before them, so readers may resume from
+	// the id of the last returned change without missing any.
+	GetAfter(id int64, limit int) ([]*MovieChange, error)
+	// LastID returns id of the change GetAfter would return last or 0 if there
+	// are none
+	LastID() (int64, error)
+	// Subscribe returns a channel receiving a value whenever new changes may be
+	// logged. Unsubscribe must be called once the channel isn't read anymore.
+	Subscribe() (ch <-chan struct{}, unsubscribe func())
+	// Listen wakes up subscribers on changes logged by other processes until
+	// the context is done
+	Listen(ctx context.Context) error
+}
+
+// MovieChange records a movie being created, updated or deleted. Restored
+// movies are logged as created and purged ones aren't logged at all, as they
+// were already deleted when moved to the trash.
+type MovieChange struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	Action    string    `json:"action"`
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChangeBroker wakes up subscribers waiting for new changes. Notifications are
+// coalesced, so subscribers are expected to read all changes they missed.
+type ChangeBroker struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+func NewChangeBroker() *ChangeBroker {
+	return &ChangeBroker{subs: make(map[chan struct{}]struct{})}
+}
+
+func (b *ChangeBroker) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *ChangeBroker) Publish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// MovieChangeModel reads the change log filled by the movies table trigger.
+// Ids of changes committed by concurrent transactions may become visible out
+// of order, so changes are read in the order of the transactions which logged
+// them instead, and only up to the oldest transaction still in progress. Any
+// change committed later belongs to a transaction ordered after them. As a
+// result a long-running transaction, even one not touching movies, holds back
+// all changes of transactions started after it until it ends.
+type MovieChangeModel struct {
+	DB     *sql.DB
+	Broker *ChangeBroker
+}
+
+func (m MovieChangeModel) GetAfter(id int64, limit int) (changes []*MovieChange, err error) {
+	// Changes after an unknown id, e.g. the one the log starts after, are
+	// found by id alone
+	query := `
+		SELECT c.id, c.movie_id, c.action, c.version, c.created_at
+		FROM movie_changes c
+		LEFT JOIN movie_changes prev ON prev.id = $1
+		WHERE c.xid < pg_snapshot_xmin(pg_current_snapshot())
+		AND ((prev.id IS NULL AND c.id > $1) OR (c.xid, c.id) > (prev.xid, prev.id))
+		ORDER BY c.xid, c.id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	changes = make([]*MovieChange, 0)
+	for rows.Next() {
+		var change MovieChange
+		err = rows.Scan(&change.ID, &change.MovieID, &change.Action, &change.Version, &change.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func (m MovieChangeModel) LastID() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id
+		FROM movie_changes
+		WHERE xid < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY xid DESC, id DESC
+		LIMIT 1`
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (m MovieChangeModel) Subscribe() (<-chan struct{}, func()) {
+	return m.Broker.Subscribe()
+}
+
+// Listen holds a connection listening on the movie_changes channel. The
+// connection is discarded afterwards instead of being returned to the pool.
+func (m MovieChangeModel) Listen(ctx context.Context) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("unexpected database driver")
+		}
+		pgConn := c.Conn()
+
+		if _, err := pgConn.Exec(ctx, "LISTEN movie_changes"); err != nil {
+			return errors.Join(driver.ErrBadConn, err)
+		}
+		// Changes may have been logged while nobody was listening
+		m.Broker.Publish()
+
+		for {
+			if _, err := pgConn.WaitForNotification(ctx); err != nil {
+				return errors.Join(driver.ErrBadConn, err)
+			}
+			m.Broker.Publish()
+		}
+	})
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+type MovieChangeInMemRepo struct {
+	mu      sync.RWMutex
+	changes []*MovieChange
+	clock   Clock
+	broker  *ChangeBroker
+}
+
+func NewMovieChangeInMemRepo() *MovieChangeInMemRepo {
+	return &MovieChangeInMemRepo{
+		changes: make([]*MovieChange, 0),
+		clock:   MockClock{},
+		broker:  NewChangeBroker(),
+	}
+}
+
+// log records the change of the movie and wakes up subscribers
+func (m *MovieChangeInMemRepo) log(action string, movie *Movie) {
+	m.mu.Lock()
+	m.changes = append(m.changes, &MovieChange{
+		ID:        int64(len(m.changes) + 1),
+		MovieID:   movie.ID,
+		Action:    action,
+		Version:   movie.Version,
+		CreatedAt: m.clock.Now(),
+	})
+	m.mu.Unlock()
+
+	m.broker.Publish()
+}
+
+func (m *MovieChangeInMemRepo) GetAfter(id int64, limit int) ([]*MovieChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	changes := make([]*MovieChange, 0)
+	for _, change := range m.changes[min(max(id, 0), int64(len(m.changes))):] {
+		if len(changes) == limit {
+			break
+		}
+		c := *change
+		changes = append(changes, &c)
+	}
+	return changes, nil
+}
+
+func (m *MovieChangeInMemRepo) LastID() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return int64(len(m.changes)), nil
+}
+
+func (m *MovieChangeInMemRepo) Subscribe() (<-chan struct{}, func()) {
+	return m.broker.Subscribe()
+}
+
+// Listen only waits for the context, as all changes are logged in-process
+func (m *MovieChangeInMemRepo) Listen(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,147 @@
+package data_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+// TestMovieChangesInterleavedTransactions runs against a migrated database
+// given by GREENLIGHT_DB_DSN
+func TestMovieChangesInterleavedTransactions(t *testing.T) {
+	dsn := os.Getenv("GREENLIGHT_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_DB_DSN isn't set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	assertions.AssertNoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	changes := data.MovieChangeModel{DB: db, Broker: data.NewChangeBroker()}
+	lastID, err := changes.LastID()
+	assertions.AssertNoError(t, err)
+
+	ctx := context.Background()
+	suffix := time.Now().Format(time.RFC3339Nano)
+	insert := func(tx *sql.Tx, title string) int64 {
+		t.Helper()
+
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO movies (title, year, runtime, genres)
+			VALUES ($1, 2016, 107, '{animation}')
+			RETURNING id`, fmt.Sprintf("%s %s", title, suffix)).Scan(&id)
+		assertions.AssertNoError(t, err)
+		return id
+	}
+
+	// The first transaction logs its change before the second one, which
+	// commits first
+	first, err := db.BeginTx(ctx, nil)
+	assertions.AssertNoError(t, err)
+	defer func() { _ = first.Rollback() }()
+	second, err := db.BeginTx(ctx, nil)
+	assertions.AssertNoError(t, err)
+	defer func() { _ = second.Rollback() }()
+
+	firstID := insert(first, "Moana")
+	secondID := insert(second, "Deadpool")
+	assertions.AssertNoError(t, second.Commit())
+
+	// readAll reads changes of the movies like a client resuming from the id of
+	// the last change it received
+	var got []int64
+	readAll := func() {
+		t.Helper()
+
+		for {
+			batch, err := changes.GetAfter(lastID, 10)
+			assertions.AssertNoError(t, err)
+			if len(batch) == 0 {
+				return
+			}
+			for _, change := range batch {
+				if change.MovieID == firstID || change.MovieID == secondID {
+					got = append(got, change.MovieID)
+				}
+				lastID = change.ID
+			}
+		}
+	}
+
+	readAll()
+	if len(got) != 0 {
+		t.Fatalf("got changes of movies %v while an older transaction is in progress", got)
+	}
+
+	assertions.AssertNoError(t, first.Commit())
+	readAll()
+	if want := []int64{firstID, secondID}; !slices.Equal(got, want) {
+		t.Errorf("got changes of movies %v, want %v", got, want)
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM movies WHERE id = ANY($1)", []int64{firstID, secondID})
+	assertions.AssertNoError(t, err)
+}
+
+// TestMovieChangesLongTransaction runs against a migrated database given by
+// GREENLIGHT_DB_DSN
+func TestMovieChangesLongTransaction(t *testing.T) {
+	dsn := os.Getenv("GREENLIGHT_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_DB_DSN isn't set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	assertions.AssertNoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	changes := data.MovieChangeModel{DB: db, Broker: data.NewChangeBroker()}
+	lastID, err := changes.LastID()
+	assertions.AssertNoError(t, err)
+
+	ctx := context.Background()
+
+	// A transaction which doesn't touch movies, but has a transaction id
+	long, err := db.BeginTx(ctx, nil)
+	assertions.AssertNoError(t, err)
+	defer func() { _ = long.Rollback() }()
+	_, err = long.ExecContext(ctx, "SELECT pg_current_xact_id()")
+	assertions.AssertNoError(t, err)
+
+	var id int64
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO movies (title, year, runtime, genres)
+		VALUES ($1, 2016, 107, '{animation}')
+		RETURNING id`, "Moana "+time.Now().Format(time.RFC3339Nano)).Scan(&id)
+	assertions.AssertNoError(t, err)
+	t.Cleanup(func() {
+		_, err := db.ExecContext(ctx, "DELETE FROM movies WHERE id = $1", id)
+		assertions.AssertNoError(t, err)
+	})
+
+	changed := func() bool {
+		t.Helper()
+
+		batch, err := changes.GetAfter(lastID, 100)
+		assertions.AssertNoError(t, err)
+		return slices.ContainsFunc(batch, func(c *data.MovieChange) bool { return c.MovieID == id })
+	}
+
+	if changed() {
+		t.Fatalf("got change of movie %d while an older transaction is in progress", id)
+	}
+
+	assertions.AssertNoError(t, long.Rollback())
+	if !changed() {
+		t.Errorf("didn't get change of movie %d once the older transaction ended", id)
+	}
+}
@@ -1,12 +1,15 @@
 package data
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
 	"slices"
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,20 +18,171 @@ import (
 	"github.com/shrtyk/greenlight/internal/validator"
 )
 
+// ErrMovieAlreadyExists is returned when another movie outside of the trash has
+// the same title and year. Titles are compared ignoring case and punctuation.
+var ErrMovieAlreadyExists = errors.New("movie already exists")
+
 type MovieRepository interface {
 	MovieReader
 	MovieWriter
+	MovieTrash
 }
 
 type MovieWriter interface {
-	Insert(movie *Movie) error
-	Delete(id int64) error
-	Update(movie *Movie) error
+	// Insert inserts the movie along with its external ids. It returns
+	// ErrMovieAlreadyExists for duplicates and ErrDuplicateExternalID if any of
+	// the external ids belongs to another movie.
+	Insert(movie *Movie, userID int64) error
+	// BeginImport starts an import of movies written batch by batch within a
+	// single transaction. Each call of the importer has its own time limit, so
+	// imports aren't bounded by the time it takes the client to upload them.
+	BeginImport(atomic bool, userID int64) (MovieImporter, error)
+	// Delete moves the movie to the trash. Version of the movie is checked and
+	// bumped just like by Update.
+	Delete(movie *Movie, userID int64) error
+	// Merge folds movie from into the survivor and deletes it. Genres are united
+	// and rows referencing the merged movie are moved to the survivor, which
+	// gets the merged movie id redirected to it. Versions of both movies are
+	// checked, the survivor one is bumped.
+	Merge(from, into *Movie, userID int64) error
+	// Update saves the movie. Non-nil external ids replace the stored ones, the
+	// same as for Insert, nil external ids are kept intact.
+	Update(movie *Movie, userID int64) error
+	// Revert saves the movie set back to the state of an earlier revision. It
+	// only differs from Update by the action of the recorded revision.
+	Revert(movie *Movie, userID int64) error
+	// SetPoster replaces poster of the movie, nil poster removes it. Version of
+	// the movie is checked and bumped just like by Update.
+	SetPoster(movie *Movie, poster *Poster, userID int64) error
+}
+
+// MovieImporter writes movies of a single import. Nothing is saved unless
+// Commit succeeds.
+type MovieImporter interface {
+	// Insert inserts the movies. In atomic mode the first failure is returned as
+	// the error, otherwise failed movies are skipped and their errors returned at
+	// the matching positions of the errors slice. Inserted movies get their ids
+	// by the time Commit returns.
+	Insert(movies []*Movie) ([]error, error)
+	Commit() error
+	Rollback() error
 }
 
 type MovieReader interface {
-	GetByID(id int64) (*Movie, error)
-	GetAll(title string, genres Genres, filters Filters) ([]*Movie, Metadata, error)
+	// GetByID returns the movie outside of the trash. Only the fields, along
+	// with id and version, are read if any are given.
+	GetByID(id int64, fields ...string) (*Movie, error)
+	// GetByIDs returns movies outside of the trash in the order of ids. Missing
+	// movies are skipped. Fields are read the same way as by GetByID.
+	GetByIDs(ids []int64, fields ...string) ([]*Movie, error)
+	// GetByExternalID returns the movie having identifier externalID at provider
+	GetByExternalID(provider, externalID string) (*Movie, error)
+	// GetRedirect returns id of the movie the merged movie id was folded into
+	GetRedirect(id int64) (int64, error)
+	// Duplicates returns pairs of movies with titles at least minSimilarity
+	// similar released in the same or adjacent years
+	Duplicates(minSimilarity float64, filters Filters) ([]*DuplicatePair, Metadata, error)
+	// GetAll returns a page of movies matching movieFilters. Fields are read the
+	// same way as by GetByID.
+	GetAll(movieFilters MovieFilters, filters Filters, fields ...string) ([]*Movie, Metadata, error)
+	// Export calls fn for every movie matching movieFilters in id order without
+	// loading them all at once. It stops at the first error returned by fn.
+	Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error
+	// Facets counts movies matching movieFilters per value of each of MovieFacets given
+	Facets(movieFilters MovieFilters, facets []string) (Facets, error)
+}
+
+// MovieFilters narrows down movie listings and exports. Zero fields don't filter.
+type MovieFilters struct {
+	// Title matches movies having words starting with every word of the title
+	// or titles similar to it to tolerate misspellings. Alternate titles of the
+	// movies are matched as well.
+	Title string
+	// Genres matches movies having all of the genres
+	Genres Genres
+	// GenresAny matches movies having at least one of the genres
+	GenresAny Genres
+	// GenresExclude matches movies having none of the genres
+	GenresExclude Genres
+	// Year and runtime ranges are inclusive
+	YearMin    int
+	YearMax    int
+	RuntimeMin int
+	RuntimeMax int
+	// CreatedAfter and CreatedBefore match movies added within the time range
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// PersonID matches movies crediting the person in any role
+	PersonID int64
+	// MinRating matches movies with average rating not less than the given one
+	MinRating int
+	// CollectionID matches movies of the collection
+	CollectionID int64
+	// Highlight fills Movie.Highlight of listed movies with words matched by Title
+	Highlight bool
+}
+
+// where returns conditions matching movies outside of the trash along with their
+// arguments. Placeholders are numbered from $1.
+func (f MovieFilters) where() (string, []any) {
+	nonNil := func(g Genres) Genres {
+		if g == nil {
+			return Genres{}
+		}
+		return g
+	}
+	nullTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	conditions := `
+		($1 = '' OR to_tsvector('simple', title) @@ to_tsquery('simple', $5) OR title % $1 OR id IN (
+			SELECT movie_id FROM movie_titles
+			WHERE to_tsvector('simple', title) @@ to_tsquery('simple', $5) OR title % $1
+		))
+		AND (genres @> $2 OR $2 = '{}')
+		AND ($3::bigint = 0 OR id IN (SELECT movie_id FROM movie_credits WHERE person_id = $3))
+		AND ($4::integer = 0 OR rating >= $4)
+		AND (genres && $6 OR $6 = '{}')
+		AND (NOT (genres && $7) OR $7 = '{}')
+		AND ($8::integer = 0 OR year >= $8)
+		AND ($9::integer = 0 OR year <= $9)
+		AND ($10::integer = 0 OR runtime >= $10)
+		AND ($11::integer = 0 OR runtime <= $11)
+		AND ($12::timestamptz IS NULL OR created_at >= $12)
+		AND ($13::timestamptz IS NULL OR created_at < $13)
+		AND ($14::bigint = 0 OR id IN (SELECT movie_id FROM collection_movies WHERE collection_id = $14))
+		AND deleted_at IS NULL`
+
+	return conditions, []any{
+		f.Title, nonNil(f.Genres), f.PersonID, f.MinRating, prefixQuery(f.Title),
+		nonNil(f.GenresAny), nonNil(f.GenresExclude),
+		f.YearMin, f.YearMax, f.RuntimeMin, f.RuntimeMax,
+		nullTime(f.CreatedAfter), nullTime(f.CreatedBefore), f.CollectionID,
+	}
+}
+
+// headline returns select expression of the highlighted title. $1 and $5 are
+// placeholders of where conditions.
+func (f MovieFilters) headline() string {
+	if !f.Highlight || f.Title == "" {
+		return "''"
+	}
+	return fmt.Sprintf(`ts_headline('simple', title, to_tsquery('simple', $5), 'HighlightAll=true, StartSel=%s, StopSel=%s')`,
+		highlightStart, highlightStop)
+}
+
+// movieOrderColumn returns ORDER BY expression of the sort column. Relevance is
+// negated so the best matches come first in ascending order. $1 and $5 are
+// placeholders of where conditions.
+func movieOrderColumn(column string) string {
+	if column == "relevance" {
+		return "-(ts_rank(to_tsvector('simple', title), to_tsquery('simple', $5)) + similarity(title, $1))"
+	}
+	return column
 }
 
 type Movie struct {
@@ -39,6 +193,88 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"`
 	Genres    Genres    `json:"genres,omitempty"`
 	Version   int32     `json:"version,omitempty"`
+	// Rating is the average of user ratings rounded to 2 decimal places
+	Rating      float64 `json:"rating,omitempty"`
+	RatingCount int32   `json:"rating_count,omitempty"`
+	// Poster is nil until the poster is uploaded
+	Poster *Poster `json:"poster,omitempty"`
+	// ExternalIDs are identifiers of the movie at ExternalProviders
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty"`
+	// Highlight is the title with searched words marked, only set on request
+	Highlight string `json:"highlight,omitempty"`
+	// OriginalTitle is only set when Title is localized to the requested language
+	OriginalTitle string `json:"original_title,omitempty"`
+	// DeletedAt is set while the movie is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// movieColumn is a column movie fields are read from
+type movieColumn struct {
+	// fields are the movie fields needing the column
+	fields []string
+	expr   string
+	dest   func(movie *Movie) any
+}
+
+// movieColumns are columns of the fields movies can be narrowed down to
+var movieColumns = []movieColumn{
+	{[]string{"title", "original_title"}, "title", func(m *Movie) any { return &m.Title }},
+	{[]string{"year"}, "year", func(m *Movie) any { return &m.Year }},
+	{[]string{"runtime"}, "runtime", func(m *Movie) any { return &m.Runtime }},
+	{[]string{"genres"}, "genres", func(m *Movie) any { return &m.Genres }},
+	{[]string{"rating"}, "rating", func(m *Movie) any { return &m.Rating }},
+	{[]string{"rating_count"}, "rating_count", func(m *Movie) any { return &m.RatingCount }},
+	{[]string{"poster"}, "poster_key", func(m *Movie) any { return &m.Poster }},
+	{[]string{"external_ids"}, externalIDsColumn("movies"), func(m *Movie) any { return &m.ExternalIDs }},
+}
+
+// selectMovieColumns returns columns read for the movie fields along with scan
+// destinations of a movie for them. Id and version are always read, the other
+// columns only if any of their fields is given or no fields are given at all.
+func selectMovieColumns(fields []string) (string, func(movie *Movie) []any) {
+	columns := []movieColumn{
+		{expr: "id", dest: func(m *Movie) any { return &m.ID }},
+		{expr: "version", dest: func(m *Movie) any { return &m.Version }},
+	}
+	if len(fields) == 0 {
+		columns = append(columns, movieColumn{expr: "created_at", dest: func(m *Movie) any { return &m.CreatedAt }})
+	}
+	for _, c := range movieColumns {
+		if len(fields) == 0 || slices.ContainsFunc(c.fields, func(f string) bool { return slices.Contains(fields, f) }) {
+			columns = append(columns, c)
+		}
+	}
+
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		exprs[i] = c.expr
+	}
+
+	return strings.Join(exprs, ", "), func(movie *Movie) []any {
+		dest := make([]any, len(columns))
+		for i, c := range columns {
+			dest[i] = c.dest(movie)
+		}
+		return dest
+	}
+}
+
+// withFields returns copy of the movie having only the fields read, the same
+// as MovieModel reads them
+func (movie *Movie) withFields(fields []string) *Movie {
+	if len(fields) == 0 {
+		return movie
+	}
+
+	mov := &Movie{}
+	_, dest := selectMovieColumns(fields)
+	for i, src := range dest(movie) {
+		reflect.ValueOf(dest(mov)[i]).Elem().Set(reflect.ValueOf(src).Elem())
+	}
+	if slices.Contains(fields, "highlight") {
+		mov.Highlight = movie.Highlight
+	}
+	return mov
 }
 
 type Genres []string
@@ -62,41 +298,240 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
 	query := `
-		INSERT INTO movies (title, year, runtime, genres)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version`
-	args := []any{movie.Title, movie.Year, movie.Runtime, movie.Genres}
+		WITH movie AS (
+			INSERT INTO movies (title, year, runtime, genres)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, version
+		), external_ids AS (
+			INSERT INTO movie_external_ids (movie_id, provider, external_id)
+			SELECT movie.id, e.key, e.value
+			FROM movie, jsonb_each_text($5::jsonb) e
+		)
+		SELECT id, created_at, version FROM movie`
+
+	externalIDs, err := movie.ExternalIDs.jsonb()
+	if err != nil {
+		return err
+	}
+	args := []any{movie.Title, movie.Year, movie.Runtime, movie.Genres, externalIDs}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	tx, err := beginRevisionTx(ctx, m.DB, userID, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		switch {
+		case isDuplicateMovie(err):
+			return ErrMovieAlreadyExists
+		case isDuplicateExternalID(err):
+			return ErrDuplicateExternalID
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Number of movies inserted by a single INSERT statement of MovieImporter
+const insertBatchSize = 500
+
+const (
+	// Time limit of database work done by a single MovieImporter call
+	importCallTimeout = 10 * time.Second
+	// How long the import transaction may stay idle between two calls, e.g.
+	// while the client is uploading the next batch. Postgres terminates the
+	// session once it's exceeded.
+	importIdleTimeout = 10 * time.Second
+)
+
+// movieImport is a MovieImporter writing movies within a single transaction.
+// The transaction is started by the first Insert, so it isn't held open while
+// the first batch is being received, and it ends with Commit or Rollback
+// rather than after a fixed time: each call gets its own timeout instead.
+type movieImport struct {
+	db     *sql.DB
+	userID int64
+	atomic bool
+	tx     *sql.Tx
+	done   bool
+}
+
+func (m MovieModel) BeginImport(atomic bool, userID int64) (MovieImporter, error) {
+	return &movieImport{db: m.DB, userID: userID, atomic: atomic}, nil
+}
+
+func (imp *movieImport) begin() error {
+	// Context of BeginTx bounds the whole transaction, so it must outlive calls
+	tx, err := beginRevisionTx(context.Background(), imp.db, imp.userID, "")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), importCallTimeout)
+	defer cancel()
+
+	query := `SELECT set_config('idle_in_transaction_session_timeout', $1, true)`
+	if _, err = tx.ExecContext(ctx, query, importIdleTimeout.String()); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	imp.tx = tx
+	return nil
+}
+
+func (imp *movieImport) Insert(movies []*Movie) ([]error, error) {
+	if imp.done {
+		return nil, sql.ErrTxDone
+	}
+	if imp.tx == nil {
+		if err := imp.begin(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), importCallTimeout)
+	defer cancel()
+
+	rowErrs := make([]error, len(movies))
+	for start := 0; start < len(movies); start += insertBatchSize {
+		batch := movies[start:min(start+insertBatchSize, len(movies))]
+
+		if imp.atomic {
+			if err := insertMovies(ctx, imp.tx, batch); err != nil {
+				if isDuplicateMovie(err) {
+					return nil, ErrMovieAlreadyExists
+				}
+				return nil, err
+			}
+			continue
+		}
+
+		// Best effort: try the whole batch and fall back to movie by movie
+		// inserts to find out which ones are failing.
+		err := withSavepoint(ctx, imp.tx, func() error {
+			return insertMovies(ctx, imp.tx, batch)
+		})
+		if err == nil {
+			continue
+		}
+		for i, movie := range batch {
+			rowErrs[start+i] = withSavepoint(ctx, imp.tx, func() error {
+				return insertMovies(ctx, imp.tx, []*Movie{movie})
+			})
+			if isDuplicateMovie(rowErrs[start+i]) {
+				rowErrs[start+i] = ErrMovieAlreadyExists
+			}
+		}
+	}
+
+	return rowErrs, nil
+}
+
+func (imp *movieImport) Commit() error {
+	if imp.done {
+		return sql.ErrTxDone
+	}
+	imp.done = true
+
+	if imp.tx == nil {
+		return nil
+	}
+	return imp.tx.Commit()
+}
+
+func (imp *movieImport) Rollback() error {
+	if imp.done {
+		return sql.ErrTxDone
+	}
+	imp.done = true
+
+	if imp.tx == nil {
+		return nil
+	}
+	return imp.tx.Rollback()
+}
+
+// insertMovies inserts movies with a single multi-row INSERT
+func insertMovies(ctx context.Context, tx *sql.Tx, movies []*Movie) (err error) {
+	values := make([]string, 0, len(movies))
+	args := make([]any, 0, 4*len(movies))
+	for i, movie := range movies {
+		n := 4 * i
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4))
+		args = append(args, movie.Title, movie.Year, movie.Runtime, movie.Genres)
+	}
+
+	// #nosec G201 -- only placeholders are formatted into the query
+	query := fmt.Sprintf(`
+		INSERT INTO movies (title, year, runtime, genres)
+		VALUES %s
+		RETURNING id, created_at, version`, strings.Join(values, ", "))
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	// Rows of a multi-row VALUES list are returned in the order they were listed
+	i := 0
+	for rows.Next() {
+		movie := movies[i]
+		if err = rows.Scan(&movie.ID, &movie.CreatedAt, &movie.Version); err != nil {
+			return err
+		}
+		i++
+	}
+
+	return rows.Err()
 }
 
-func (m MovieModel) GetByID(id int64) (*Movie, error) {
+// withSavepoint runs fn and rolls transaction back to the state before the call if it fails
+func withSavepoint(ctx context.Context, tx *sql.Tx, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT batch"); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		if _, rerr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch"); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch")
+	return err
+}
+
+func (m MovieModel) GetByID(id int64, fields ...string) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	movie := new(Movie)
+	columns, dest := selectMovieColumns(fields)
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT ` + columns + `
 		FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		&movie.Genres,
-		&movie.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(dest(movie)...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -109,70 +544,159 @@ func (m MovieModel) GetByID(id int64) (*Movie, error) {
 	return movie, nil
 }
 
-func (m MovieModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
+func (m MovieModel) GetByIDs(ids []int64, fields ...string) (movies []*Movie, err error) {
+	columns, dest := selectMovieColumns(fields)
+	query := `
+		SELECT ` + columns + `
+		FROM movies
+		WHERE id = ANY($1) AND deleted_at IS NULL
+		ORDER BY array_position($1, id)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	movies = make([]*Movie, 0, len(ids))
+	for rows.Next() {
+		var movie Movie
+		if err = rows.Scan(dest(&movie)...); err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+func (m MovieModel) Delete(movie *Movie, userID int64) error {
 	query := `
-		DELETE FROM movies
-		WHERE id = $1`
+		UPDATE movies
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING deleted_at, version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	res, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := beginRevisionTx(ctx, m.DB, userID, "")
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	rowsAffected, err := res.RowsAffected()
+	err = tx.QueryRowContext(ctx, query, movie.ID, movie.Version).Scan(&movie.DeletedAt, &movie.Version)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
+	return tx.Commit()
+}
 
-	return nil
+func (m MovieModel) Update(movie *Movie, userID int64) error {
+	return m.update(movie, userID, "")
+}
+
+func (m MovieModel) Revert(movie *Movie, userID int64) error {
+	return m.update(movie, userID, RevisionRevert)
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+// update saves the movie recording its revision with the action
+func (m MovieModel) update(movie *Movie, userID int64, action string) error {
+	// External ids are only replaced when $7 isn't NULL. Deleted and upserted
+	// rows are disjoint, as both statements of a query see the same snapshot.
 	query := `
-		UPDATE movies
-		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		WHERE id = $5 and version = $6
-		RETURNING version`
+		WITH movie AS (
+			UPDATE movies
+			SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+			WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+			RETURNING id, version
+		), deleted_ids AS (
+			DELETE FROM movie_external_ids
+			USING movie
+			WHERE movie_external_ids.movie_id = movie.id
+			AND $7::jsonb IS NOT NULL AND NOT $7::jsonb ? movie_external_ids.provider
+		), external_ids AS (
+			INSERT INTO movie_external_ids (movie_id, provider, external_id)
+			SELECT movie.id, e.key, e.value
+			FROM movie, jsonb_each_text(COALESCE($7::jsonb, '{}')) e
+			ON CONFLICT (movie_id, provider) DO UPDATE SET external_id = EXCLUDED.external_id
+		)
+		SELECT version FROM movie`
+
+	var externalIDs *string
+	if movie.ExternalIDs != nil {
+		ids, err := movie.ExternalIDs.jsonb()
+		if err != nil {
+			return err
+		}
+		externalIDs = &ids
+	}
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, movie.Genres, movie.ID, movie.Version}
+	args := []any{movie.Title, movie.Year, movie.Runtime, movie.Genres, movie.ID, movie.Version, externalIDs}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version); err != nil {
+	tx, err := beginRevisionTx(ctx, m.DB, userID, action)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version); err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		case isDuplicateMovie(err):
+			return ErrMovieAlreadyExists
+		case isDuplicateExternalID(err):
+			return ErrDuplicateExternalID
 		default:
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (m MovieModel) GetAll(title string, genres Genres, filters Filters) ([]*Movie, Metadata, error) {
+func (m MovieModel) GetAll(movieFilters MovieFilters, filters Filters, fields ...string) ([]*Movie, Metadata, error) {
+	if filters.Cursor != nil {
+		return m.getAllByCursor(movieFilters, filters, fields)
+	}
+
+	where, args := movieFilters.where()
+	n := len(args)
+	columns, dest := selectMovieColumns(fields)
+
 	// #nosec G201 -- filters validated in handler
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version
+		SELECT COUNT(*) OVER(), %s, %s
 		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
+		WHERE %s
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $%d OFFSET $%d`, columns, movieFilters.headline(), where, movieOrderColumn(filters.sortColumn()), filters.sortDirection(), n+1, n+2)
 
-	args := []any{title, genres, filters.limit(), filters.offset()}
+	args = append(args, filters.limit(), filters.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -197,16 +721,7 @@ func (m MovieModel) GetAll(title string, genres Genres, filters Filters) ([]*Mov
 	for rows.Next() {
 		var movie Movie
 
-		err = rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			&movie.Genres,
-			&movie.Version,
-		)
+		err = rows.Scan(append(append([]any{&totalRecords}, dest(&movie)...), &movie.Highlight)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -223,7 +738,154 @@ func (m MovieModel) GetAll(title string, genres Genres, filters Filters) ([]*Mov
 	return movies, metadata, nil
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+func (m MovieModel) getAllByCursor(movieFilters MovieFilters, filters Filters, fields []string) (movies []*Movie, metadata Metadata, err error) {
+	// Cursors of the page are made of the sort column
+	if len(fields) > 0 {
+		fields = append(slices.Clip(fields), filters.sortColumn())
+	}
+	columns, dest := selectMovieColumns(fields)
+
+	where, args := movieFilters.where()
+	n := len(args)
+	args = append(args, filters.limit()+1)
+
+	keyset := "TRUE"
+	if !filters.Cursor.isStart() {
+		var pivot *Movie
+		pivot, err = movieFromCursor(filters.Cursor, filters.sortColumn())
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		keyset = filters.keysetCondition(fmt.Sprintf("$%d", n+2), fmt.Sprintf("$%d", n+3))
+		args = append(args, movieSortValue(pivot, filters.sortColumn()), pivot.ID)
+	}
+
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM movies
+		WHERE %s
+		AND %s
+		ORDER BY %s
+		LIMIT $%d`, columns, movieFilters.headline(), where, keyset, filters.keysetOrder(), n+1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	movies = []*Movie{}
+	for rows.Next() {
+		var movie Movie
+
+		if err = rows.Scan(append(dest(&movie), &movie.Highlight)...); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(movies) > filters.limit()
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+	if filters.Cursor.Backward {
+		slices.Reverse(movies)
+	}
+
+	return movies, calculateKeysetMetadata(movies, filters, hasMore), nil
+}
+
+// Number of movies fetched from the export cursor at once
+const exportFetchSize = 500
+
+func (m MovieModel) Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error {
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	where, args := movieFilters.where()
+
+	// #nosec G201 -- only static conditions are formatted into the query
+	query := fmt.Sprintf(`
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, year, runtime, genres, version, rating, rating_count, poster_key, %s
+		FROM movies
+		WHERE %s
+		ORDER BY id ASC`, externalIDsColumn("movies"), where)
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM movies_export", exportFetchSize)
+	for {
+		n, err := exportBatch(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+// exportBatch fetches the next batch of movies from the export cursor and
+// returns the number of fetched movies.
+func exportBatch(ctx context.Context, tx *sql.Tx, fetch string, fn func(*Movie) error) (n int, err error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			&movie.Genres,
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.ExternalIDs,
+		)
+		if err != nil {
+			return n, err
+		}
+
+		if err = fn(&movie); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, rows.Err()
+}
+
+// ValidateMovie checks the movie. Genres must be slugs of the taxonomy.
+func ValidateMovie(v *validator.Validator, movie *Movie, taxonomy *Taxonomy) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -239,6 +901,18 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+
+	for _, g := range movie.Genres {
+		if taxonomy.Has(g) {
+			continue
+		}
+
+		msg := fmt.Sprintf("must only contain known genres, %q is unknown", g)
+		if suggestion := taxonomy.Suggest(g); suggestion != "" {
+			msg += fmt.Sprintf(", did you mean %q?", suggestion)
+		}
+		v.AddError("genres", msg)
+	}
 }
 
 type MovieInMemRepo struct {
@@ -246,36 +920,73 @@ type MovieInMemRepo struct {
 	idCounter int64
 	movies    map[int64]*Movie
 	clock     Clock
+	// redirects map ids of merged movies to their survivors
+	redirects map[int64]int64
+	// credits is used to filter movies by credited people. Along with the
+	// other related repositories it's repointed when movies are merged.
+	credits     *CreditInMemRepo
+	ratings     *RatingInMemRepo
+	watchlist   *WatchlistInMemRepo
+	watched     *WatchedInMemRepo
+	collections *CollectionInMemRepo
+	// localizations are used to search alternate titles
+	localizations *LocalizationInMemRepo
+	// changes log movies being created, updated and deleted
+	changes *MovieChangeInMemRepo
+	// revisions record every new version of a movie
+	revisions *MovieRevisionInMemRepo
+	// stills are repointed when movies are merged and deleted when purged
+	stills *StillInMemRepo
 }
 
 func NewMovieInMemRepo() *MovieInMemRepo {
 	return &MovieInMemRepo{
 		idCounter: 1,
 		movies:    make(map[int64]*Movie),
+		redirects: make(map[int64]int64),
 		clock:     MockClock{},
 	}
 }
 
-func (m *MovieInMemRepo) alreadyExists(title string) bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// logChange records the change of the movie if the change log is attached
+func (m *MovieInMemRepo) logChange(action string, movie *Movie) {
+	if m.changes != nil {
+		m.changes.log(action, movie)
+	}
+}
+
+// recordRevision records the new version of the movie if the revision
+// repository is attached
+func (m *MovieInMemRepo) recordRevision(movie *Movie, action string, userID int64) {
+	if m.revisions != nil {
+		m.revisions.record(movie, action, userID)
+	}
+}
 
+// alreadyExists reports whether another movie outside of the trash has the
+// same normalized title and year. Caller must hold the lock.
+func (m *MovieInMemRepo) alreadyExists(movie *Movie) bool {
+	key := normalizedTitle(movie.Title)
 	for _, mov := range m.movies {
-		if mov.Title == title {
+		if mov.ID != movie.ID && mov.DeletedAt == nil && mov.Year == movie.Year && normalizedTitle(mov.Title) == key {
 			return true
 		}
 	}
 	return false
 }
 
-func (m *MovieInMemRepo) Insert(movie *Movie) error {
-	if m.alreadyExists(movie.Title) {
-		return errors.New("movie already exists")
-	}
-
+func (m *MovieInMemRepo) Insert(movie *Movie, userID int64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.alreadyExists(&Movie{Title: movie.Title, Year: movie.Year}) {
+		return ErrMovieAlreadyExists
+	}
+	if m.externalIDsTaken(0, movie.ExternalIDs) {
+		return ErrDuplicateExternalID
+	}
+	movie.ExternalIDs = cloneExternalIDs(movie.ExternalIDs)
+
 	movie.ID = m.idCounter
 	movie.CreatedAt = m.clock.Now()
 	movie.Version++
@@ -283,10 +994,61 @@ func (m *MovieInMemRepo) Insert(movie *Movie) error {
 	m.movies[m.idCounter] = movie
 	m.idCounter++
 
+	m.logChange(ChangeCreated, movie)
+	m.recordRevision(movie, RevisionInsert, userID)
+	return nil
+}
+
+// movieInMemImport holds movies of an import until it's committed
+type movieInMemImport struct {
+	repo   *MovieInMemRepo
+	atomic bool
+	userID int64
+	movies []*Movie
+	keys   []string
+}
+
+func (m *MovieInMemRepo) BeginImport(atomic bool, userID int64) (MovieImporter, error) {
+	return &movieInMemImport{repo: m, atomic: atomic, userID: userID}, nil
+}
+
+func (imp *movieInMemImport) Insert(movies []*Movie) ([]error, error) {
+	imp.repo.mu.RLock()
+	defer imp.repo.mu.RUnlock()
+
+	rowErrs := make([]error, len(movies))
+	for i, movie := range movies {
+		key := fmt.Sprintf("%s/%d", normalizedTitle(movie.Title), movie.Year)
+		if imp.repo.alreadyExists(&Movie{Title: movie.Title, Year: movie.Year}) || slices.Contains(imp.keys, key) {
+			if imp.atomic {
+				return nil, ErrMovieAlreadyExists
+			}
+			rowErrs[i] = ErrMovieAlreadyExists
+			continue
+		}
+		imp.keys = append(imp.keys, key)
+		imp.movies = append(imp.movies, movie)
+	}
+
+	return rowErrs, nil
+}
+
+func (imp *movieInMemImport) Commit() error {
+	for _, movie := range imp.movies {
+		if err := imp.repo.Insert(movie, imp.userID); err != nil {
+			return err
+		}
+	}
+	imp.movies = nil
+	return nil
+}
+
+func (imp *movieInMemImport) Rollback() error {
+	imp.movies = nil
 	return nil
 }
 
-func (m *MovieInMemRepo) GetByID(id int64) (*Movie, error) {
+func (m *MovieInMemRepo) GetByID(id int64, fields ...string) (*Movie, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -295,51 +1057,288 @@ func (m *MovieInMemRepo) GetByID(id int64) (*Movie, error) {
 	}
 
 	movie, ok := m.movies[id]
-	if !ok {
+	if !ok || movie.DeletedAt != nil {
 		return nil, ErrRecordNotFound
 	}
-	return movie, nil
+
+	// Callers modify returned movie before saving it, just like a freshly read row
+	mov := *movie
+	return mov.withFields(fields), nil
+}
+
+func (m *MovieInMemRepo) GetByIDs(ids []int64, fields ...string) ([]*Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movies := make([]*Movie, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		movie, ok := m.movies[id]
+		if !ok || movie.DeletedAt != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		mov := *movie
+		movies = append(movies, mov.withFields(fields))
+	}
+
+	return movies, nil
 }
 
-func (m *MovieInMemRepo) Delete(id int64) error {
+func (m *MovieInMemRepo) Delete(movie *Movie, userID int64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if id < 1 {
+	stored, ok := m.movies[movie.ID]
+	if !ok {
 		return ErrRecordNotFound
 	}
-
-	if _, ok := m.movies[id]; !ok {
-		return ErrRecordNotFound
+	if stored.DeletedAt != nil || stored.Version != movie.Version {
+		return ErrEditConflict
 	}
 
-	delete(m.movies, id)
+	deletedAt := m.clock.Now()
+	stored.DeletedAt = &deletedAt
+	stored.Version++
+
+	movie.DeletedAt = &deletedAt
+	movie.Version = stored.Version
+
+	m.logChange(ChangeDeleted, stored)
+	m.recordRevision(stored, RevisionDelete, userID)
 	return nil
 }
 
-func (m *MovieInMemRepo) Update(movie *Movie) error {
+func (m *MovieInMemRepo) Update(movie *Movie, userID int64) error {
+	return m.update(movie, userID, RevisionUpdate)
+}
+
+func (m *MovieInMemRepo) Revert(movie *Movie, userID int64) error {
+	return m.update(movie, userID, RevisionRevert)
+}
+
+func (m *MovieInMemRepo) update(movie *Movie, userID int64, action string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	id := movie.ID
-	if _, ok := m.movies[id]; !ok {
+	stored, ok := m.movies[id]
+	if !ok {
 		return ErrRecordNotFound
 	}
+	if stored.DeletedAt != nil || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	if m.alreadyExists(movie) {
+		return ErrMovieAlreadyExists
+	}
 
+	if movie.ExternalIDs == nil {
+		movie.ExternalIDs = stored.ExternalIDs
+	} else if m.externalIDsTaken(id, movie.ExternalIDs) {
+		return ErrDuplicateExternalID
+	}
+	movie.ExternalIDs = cloneExternalIDs(movie.ExternalIDs)
+
+	// Ratings are maintained by the ratings repository and posters by SetPoster only
+	movie.Rating = stored.Rating
+	movie.RatingCount = stored.RatingCount
+	movie.Poster = stored.Poster
 	movie.Version = m.movies[id].Version + 1
 	m.movies[id] = movie
+
+	m.logChange(ChangeUpdated, movie)
+	m.recordRevision(movie, action, userID)
 	return nil
 }
 
-func (m *MovieInMemRepo) GetAll(title string, genres Genres, filters Filters) ([]*Movie, Metadata, error) {
+func (m *MovieInMemRepo) GetAll(movieFilters MovieFilters, filters Filters, fields ...string) ([]*Movie, Metadata, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	lowerTitle := strings.ToLower(title)
+	filteredList := m.filter(movieFilters)
+
+	if filters.Sort == "relevance" {
+		sortByRelevance(filteredList, movieFilters.Title)
+	} else {
+		slices.SortFunc(filteredList, func(a, b *Movie) int {
+			return compareMovies(a, b, filters.Sort)
+		})
+	}
+
+	if movieFilters.Highlight && movieFilters.Title != "" {
+		for i, mov := range filteredList {
+			highlighted := *mov
+			highlighted.Highlight = highlightTitle(mov.Title, movieFilters.Title)
+			filteredList[i] = &highlighted
+		}
+	}
+
+	var (
+		page     []*Movie
+		metadata Metadata
+	)
+	if filters.Cursor != nil {
+		var err error
+		if page, metadata, err = m.paginateByCursor(filteredList, filters); err != nil {
+			return nil, Metadata{}, err
+		}
+	} else {
+		totalRecords := len(filteredList)
+		off := min(filters.offset(), totalRecords)
+		end := min(off+filters.limit(), totalRecords)
+		page = filteredList[off:end]
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+
+	movies := make([]*Movie, len(page))
+	for i, movie := range page {
+		movies[i] = movie.withFields(fields)
+	}
+	return movies, metadata, nil
+}
+
+func (m *MovieInMemRepo) Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error {
+	m.mu.RLock()
+	movies := m.filter(movieFilters)
+	m.mu.RUnlock()
+
+	slices.SortFunc(movies, func(a, b *Movie) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	for _, movie := range movies {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(movie); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRating updates aggregated rating of the movie
+func (m *MovieInMemRepo) setRating(id int64, sum int64, count int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return
+	}
+
+	movie.RatingCount = count
+	movie.Rating = 0
+	if count > 0 {
+		movie.Rating = math.Round(float64(sum)/float64(count)*100) / 100
+	}
+}
+
+// genreCounts returns number of movies outside of the trash per genre
+func (m *MovieInMemRepo) genreCounts() map[string]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, mov := range m.movies {
+		if mov.DeletedAt != nil {
+			continue
+		}
+		for _, g := range mov.Genres {
+			counts[g]++
+		}
+	}
+	return counts
+}
+
+// replaceGenre replaces genre from with genre into in all movies dropping from
+// if the movie already has into
+func (m *MovieInMemRepo) replaceGenre(from, into string, userID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, mov := range m.movies {
+		i := slices.Index(mov.Genres, from)
+		if i == -1 {
+			continue
+		}
+
+		// Movies are replaced instead of modified, as readers may hold them
+		updated := *mov
+		updated.Genres = slices.Clone(mov.Genres)
+		if slices.Contains(updated.Genres, into) {
+			updated.Genres = slices.Delete(updated.Genres, i, i+1)
+		} else {
+			updated.Genres[i] = into
+		}
+		updated.Version++
+		m.movies[id] = &updated
+
+		m.logChange(ChangeUpdated, &updated)
+		m.recordRevision(&updated, RevisionUpdate, userID)
+	}
+}
+
+// matchesTitle reports whether the original or any alternate title of the movie
+// matches the search
+func (m *MovieInMemRepo) matchesTitle(movie *Movie, search string) bool {
+	if matchesTitleSearch(movie.Title, search) {
+		return true
+	}
+
+	if m.localizations == nil {
+		return false
+	}
+	return slices.ContainsFunc(m.localizations.titles(movie.ID), func(title string) bool {
+		return matchesTitleSearch(title, search)
+	})
+}
+
+// exists reports whether the movie exists, including the trashed ones
+func (m *MovieInMemRepo) exists(id int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.movies[id]
+	return ok
+}
+
+// filter returns movies outside of the trash matching movieFilters. Caller must
+// hold the lock.
+func (m *MovieInMemRepo) filter(movieFilters MovieFilters) []*Movie {
+	genres := movieFilters.Genres
+
+	var credited []int64
+	if movieFilters.PersonID != 0 && m.credits != nil {
+		credited = m.credits.movieIDsForPerson(movieFilters.PersonID)
+	}
+
+	var collected []int64
+	if movieFilters.CollectionID != 0 && m.collections != nil {
+		collected = m.collections.movieIDs(movieFilters.CollectionID)
+	}
 
 	filteredList := make([]*Movie, 0, len(m.movies))
 	for _, mov := range m.movies {
-		if lowerTitle != "" && !strings.Contains(strings.ToLower(mov.Title), lowerTitle) {
+		if mov.DeletedAt != nil {
+			continue
+		}
+
+		if movieFilters.Title != "" && !m.matchesTitle(mov, movieFilters.Title) {
+			continue
+		}
+
+		if movieFilters.PersonID != 0 && !slices.Contains(credited, mov.ID) {
+			continue
+		}
+
+		if movieFilters.CollectionID != 0 && !slices.Contains(collected, mov.ID) {
+			continue
+		}
+
+		if mov.Rating < float64(movieFilters.MinRating) {
 			continue
 		}
 
@@ -355,43 +1354,204 @@ func (m *MovieInMemRepo) GetAll(title string, genres Genres, filters Filters) ([
 				continue
 			}
 		}
+
+		hasGenre := func(g string) bool { return slices.Contains(mov.Genres, g) }
+		if len(movieFilters.GenresAny) > 0 && !slices.ContainsFunc(movieFilters.GenresAny, hasGenre) {
+			continue
+		}
+		if slices.ContainsFunc(movieFilters.GenresExclude, hasGenre) {
+			continue
+		}
+
+		if !inRange(int(mov.Year), movieFilters.YearMin, movieFilters.YearMax) ||
+			!inRange(int(mov.Runtime), movieFilters.RuntimeMin, movieFilters.RuntimeMax) {
+			continue
+		}
+
+		if !movieFilters.CreatedAfter.IsZero() && mov.CreatedAt.Before(movieFilters.CreatedAfter) ||
+			!movieFilters.CreatedBefore.IsZero() && !mov.CreatedAt.Before(movieFilters.CreatedBefore) {
+			continue
+		}
+
 		filteredList = append(filteredList, mov)
 	}
 
-	totalRecords := len(filteredList)
+	return filteredList
+}
 
-	sort.Slice(filteredList, getSortFunc(filteredList, filters.Sort))
+// inRange reports whether n is within inclusive range. Zero bounds are unbounded.
+func inRange(n, from, to int) bool {
+	return (from == 0 || n >= from) && (to == 0 || n <= to)
+}
 
-	off := filters.offset()
+// paginateByCursor takes a page from movies already sorted by filters.Sort
+func (m *MovieInMemRepo) paginateByCursor(sorted []*Movie, filters Filters) ([]*Movie, Metadata, error) {
 	lim := filters.limit()
-	if off > totalRecords {
-		return []*Movie{}, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+
+	if filters.Cursor.isStart() {
+		hasMore := len(sorted) > lim
+		page := sorted[:min(lim, len(sorted))]
+		return page, calculateKeysetMetadata(page, filters, hasMore), nil
+	}
+
+	pivot, err := movieFromCursor(filters.Cursor, filters.sortColumn())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	page := []*Movie{}
+	for _, mov := range sorted {
+		c := compareMovies(mov, pivot, filters.Sort)
+		if filters.Cursor.Backward && c < 0 || !filters.Cursor.Backward && c > 0 {
+			page = append(page, mov)
+		}
 	}
-	end := min(off+lim, totalRecords)
-	pageSlice := filteredList[off:end]
 
-	return pageSlice, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+	hasMore := len(page) > lim
+	if filters.Cursor.Backward {
+		page = page[max(0, len(page)-lim):]
+	} else {
+		page = page[:min(lim, len(page))]
+	}
+
+	return page, calculateKeysetMetadata(page, filters, hasMore), nil
+}
+
+// sortByRelevance orders movies by rank of their titles for search with the
+// best matches first
+func sortByRelevance(movies []*Movie, search string) {
+	ranks := make(map[int64]float64, len(movies))
+	for _, mov := range movies {
+		ranks[mov.ID] = titleRank(mov.Title, search)
+	}
+
+	slices.SortFunc(movies, func(a, b *Movie) int {
+		return cmp.Or(cmp.Compare(ranks[b.ID], ranks[a.ID]), cmp.Compare(a.ID, b.ID))
+	})
 }
 
-func getSortFunc(movies []*Movie, sortParam string) func(i, j int) bool {
-	switch sortParam {
+// compareMovies orders movies by sort parameter breaking ties by id in ascending order
+func compareMovies(a, b *Movie, sortParam string) int {
+	var c int
+	switch strings.TrimPrefix(sortParam, "-") {
+	case "title":
+		c = strings.Compare(a.Title, b.Title)
+	case "year":
+		c = cmp.Compare(a.Year, b.Year)
+	case "runtime":
+		c = cmp.Compare(a.Runtime, b.Runtime)
+	case "rating":
+		c = cmp.Compare(a.Rating, b.Rating)
 	case "id":
-		return func(i, j int) bool { return movies[i].ID < movies[j].ID }
-	case "-id":
-		return func(i, j int) bool { return movies[i].ID > movies[j].ID }
+		c = cmp.Compare(a.ID, b.ID)
+	case "deleted_at":
+		var aDeleted, bDeleted time.Time
+		if a.DeletedAt != nil {
+			aDeleted = *a.DeletedAt
+		}
+		if b.DeletedAt != nil {
+			bDeleted = *b.DeletedAt
+		}
+		c = aDeleted.Compare(bDeleted)
+	}
+
+	if strings.HasPrefix(sortParam, "-") {
+		c = -c
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+func movieSortValue(movie *Movie, column string) any {
+	switch column {
 	case "title":
-		return func(i, j int) bool { return movies[i].Title < movies[j].Title }
-	case "-title":
-		return func(i, j int) bool { return movies[i].Title > movies[j].Title }
+		return movie.Title
 	case "year":
-		return func(i, j int) bool { return movies[i].Year < movies[j].Year }
-	case "-year":
-		return func(i, j int) bool { return movies[i].Year > movies[j].Year }
+		return int64(movie.Year)
 	case "runtime":
-		return func(i, j int) bool { return movies[i].Runtime < movies[j].Runtime }
-	case "-runtime":
-		return func(i, j int) bool { return movies[i].Runtime > movies[j].Runtime }
+		return int64(movie.Runtime)
+	case "rating":
+		return movie.Rating
 	default:
-		return func(i, j int) bool { return false }
+		return movie.ID
+	}
+}
+
+// movieFromCursor builds a movie placed at the cursor position, so it can be
+// compared with other movies by cursor's sort column.
+func movieFromCursor(c *Cursor, column string) (*Movie, error) {
+	movie := &Movie{ID: c.ID}
+
+	if column == "title" {
+		title, ok := c.Value.(string)
+		if !ok {
+			return nil, ErrInvalidCursor
+		}
+		movie.Title = title
+		return movie, nil
+	}
+
+	num, ok := c.Value.(json.Number)
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	if column == "rating" {
+		rating, err := num.Float64()
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		movie.Rating = rating
+		return movie, nil
+	}
+	n, err := num.Int64()
+	if err != nil || column != "id" && (n < math.MinInt32 || n > math.MaxInt32) {
+		return nil, ErrInvalidCursor
+	}
+
+	switch column {
+	case "year":
+		movie.Year = int32(n)
+	case "runtime":
+		movie.Runtime = Runtime(n)
+	case "id":
+		if n != c.ID {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return movie, nil
+}
+
+func movieCursor(movie *Movie, sort string, backward bool) string {
+	return Cursor{
+		Sort:     sort,
+		Value:    movieSortValue(movie, strings.TrimPrefix(sort, "-")),
+		ID:       movie.ID,
+		Backward: backward,
+	}.Encode()
+}
+
+// calculateKeysetMetadata builds cursors to the neighbouring pages. hasMore reports
+// whether there are rows beyond the page in the direction of the requested cursor.
+func calculateKeysetMetadata(movies []*Movie, filters Filters, hasMore bool) Metadata {
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(movies) == 0 {
+		return metadata
+	}
+
+	first, last := movies[0], movies[len(movies)-1]
+	hasNext, hasPrev := hasMore, !filters.Cursor.isStart()
+	if filters.Cursor.Backward {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if hasNext {
+		metadata.NextCursor = movieCursor(last, filters.Sort, false)
+	}
+	if hasPrev {
+		metadata.PrevCursor = movieCursor(first, filters.Sort, true)
 	}
+	return metadata
 }
@@ -1,7 +1,11 @@
 package data_test
 
 import (
+	"errors"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/shrtyk/greenlight/internal/data"
 	"github.com/shrtyk/greenlight/internal/testutils/assertions"
@@ -17,14 +21,14 @@ func TestMovies(t *testing.T) {
 		Runtime: 107,
 		Genres:  data.Genres{"animation", "adventure"},
 	}
-	err := movies.Insert(moana)
+	err := movies.Insert(moana, 0)
 	assertions.AssertNoError(t, err)
 
 	gotMov, err := movies.GetByID(1)
 	assertions.AssertNoError(t, err)
 	assertions.AssertMovies(t, *gotMov, *moana)
 
-	err = movies.Insert(moana)
+	err = movies.Insert(moana, 0)
 	assertions.AssertExpectedError(t, err)
 
 	blackPanther := &data.Movie{
@@ -33,7 +37,7 @@ func TestMovies(t *testing.T) {
 		Runtime: 134,
 		Genres:  data.Genres{"action", "adventure"},
 	}
-	_ = movies.Insert(blackPanther)
+	_ = movies.Insert(blackPanther, 0)
 
 	deadPool := &data.Movie{
 		Title:   "Deadpool",
@@ -41,16 +45,22 @@ func TestMovies(t *testing.T) {
 		Runtime: 108,
 		Genres:  data.Genres{"action", "comedy"},
 	}
-	_ = movies.Insert(deadPool)
+	_ = movies.Insert(deadPool, 0)
 
-	err = movies.Delete(3)
+	stale := *deadPool
+	stale.Version--
+	if err = movies.Delete(&stale, 0); !errors.Is(err, data.ErrEditConflict) {
+		t.Errorf("expected edit conflict deleting stale movie, got %v", err)
+	}
+
+	err = movies.Delete(deadPool, 0)
 	assertions.AssertNoError(t, err)
 
 	_, err = movies.GetByID(3)
 	assertions.AssertNotFoundError(t, err)
 
 	moana.Title = "moana"
-	err = movies.Update(moana)
+	err = movies.Update(moana, 0)
 	assertions.AssertNoError(t, err)
 
 	gotMov, _ = movies.GetByID(1)
@@ -68,7 +78,7 @@ func TestMovies(t *testing.T) {
 		},
 	}
 
-	gotMovs, gotMeta, err := movies.GetAll("", data.Genres{}, filters)
+	gotMovs, gotMeta, err := movies.GetAll(data.MovieFilters{}, filters)
 	assertions.AssertNoError(t, err)
 	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{moana, blackPanther})
 	assertions.AssertMoviesMetadata(t, gotMeta, data.Metadata{
@@ -82,7 +92,7 @@ func TestMovies(t *testing.T) {
 	filters.PageSize = 1
 	filters.Sort = "-id"
 
-	gotMovs, gotMeta, _ = movies.GetAll("", data.Genres{}, filters)
+	gotMovs, gotMeta, _ = movies.GetAll(data.MovieFilters{}, filters)
 	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{blackPanther})
 	assertions.AssertMoviesMetadata(t, gotMeta, data.Metadata{
 		CurrentPage:  1,
@@ -91,12 +101,12 @@ func TestMovies(t *testing.T) {
 		LastPage:     2,
 		TotalRecords: 2,
 	})
-	gotMovs, _, _ = movies.GetAll("mo", data.Genres{}, filters)
+	gotMovs, _, _ = movies.GetAll(data.MovieFilters{Title: "mo"}, filters)
 	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{moana})
 
 	filters.PageSize = 5
 
-	gotMovs, gotMeta, _ = movies.GetAll("", data.Genres{"adventure"}, filters)
+	gotMovs, gotMeta, _ = movies.GetAll(data.MovieFilters{Genres: data.Genres{"adventure"}}, filters)
 	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{blackPanther, moana})
 	assertions.AssertMoviesMetadata(t, gotMeta, data.Metadata{
 		CurrentPage:  1,
@@ -106,3 +116,394 @@ func TestMovies(t *testing.T) {
 		TotalRecords: 2,
 	})
 }
+
+func TestMoviesCursor(t *testing.T) {
+	movies := data.NewMovieInMemRepo()
+
+	for _, m := range []*data.Movie{
+		{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}},
+		{Title: "Black Panther", Year: 2018, Runtime: 134, Genres: data.Genres{"action"}},
+		{Title: "Deadpool", Year: 2016, Runtime: 108, Genres: data.Genres{"action"}},
+		{Title: "The Breakfast Club", Year: 1986, Runtime: 96, Genres: data.Genres{"drama"}},
+	} {
+		assertions.AssertNoError(t, movies.Insert(m, 0))
+	}
+
+	filters := data.Filters{
+		PageSize: 2,
+		Sort:     "-year",
+		SortSafelist: []string{
+			"id", "title", "year", "runtime",
+			"-id", "-title", "-year", "-runtime",
+		},
+		Cursor: &data.Cursor{},
+	}
+
+	page := func(movs []*data.Movie) []int64 {
+		ids := make([]int64, len(movs))
+		for i, m := range movs {
+			ids[i] = m.ID
+		}
+		return ids
+	}
+
+	gotMovs, gotMeta, err := movies.GetAll(data.MovieFilters{}, filters)
+	assertions.AssertNoError(t, err)
+	if !slices.Equal(page(gotMovs), []int64{2, 1}) {
+		t.Errorf("first page: got %v, want %v", page(gotMovs), []int64{2, 1})
+	}
+	if gotMeta.NextCursor == "" || gotMeta.PrevCursor != "" {
+		t.Fatalf("first page: unexpected cursors %+v", gotMeta)
+	}
+
+	filters.Cursor, err = data.DecodeCursor(gotMeta.NextCursor)
+	assertions.AssertNoError(t, err)
+
+	gotMovs, gotMeta, err = movies.GetAll(data.MovieFilters{}, filters)
+	assertions.AssertNoError(t, err)
+	if !slices.Equal(page(gotMovs), []int64{3, 4}) {
+		t.Errorf("second page: got %v, want %v", page(gotMovs), []int64{3, 4})
+	}
+	if gotMeta.NextCursor != "" || gotMeta.PrevCursor == "" {
+		t.Fatalf("second page: unexpected cursors %+v", gotMeta)
+	}
+
+	// Rows inserted before the cursor position must not shift following pages
+	assertions.AssertNoError(t, movies.Insert(&data.Movie{
+		Title: "Encanto", Year: 2021, Runtime: 102, Genres: data.Genres{"animation"},
+	}, 0))
+
+	filters.Cursor, err = data.DecodeCursor(gotMeta.PrevCursor)
+	assertions.AssertNoError(t, err)
+
+	gotMovs, gotMeta, err = movies.GetAll(data.MovieFilters{}, filters)
+	assertions.AssertNoError(t, err)
+	if !slices.Equal(page(gotMovs), []int64{2, 1}) {
+		t.Errorf("previous page: got %v, want %v", page(gotMovs), []int64{2, 1})
+	}
+	if gotMeta.NextCursor == "" || gotMeta.PrevCursor == "" {
+		t.Fatalf("previous page: unexpected cursors %+v", gotMeta)
+	}
+
+	filters.Cursor = &data.Cursor{Sort: "-year", Value: "1986", ID: 4}
+	_, _, err = movies.GetAll(data.MovieFilters{}, filters)
+	if !errors.Is(err, data.ErrInvalidCursor) {
+		t.Errorf("expected invalid cursor error but got: %v", err)
+	}
+}
+
+func TestMoviesSearch(t *testing.T) {
+	movies := data.NewMockModels().Movies
+
+	starWars := &data.Movie{Title: "Star Wars", Year: 1977, Runtime: 121, Genres: data.Genres{"sci-fi"}}
+	starTrek := &data.Movie{Title: "Star Trek", Year: 2009, Runtime: 127, Genres: data.Genres{"sci-fi"}}
+	warGames := &data.Movie{Title: "WarGames", Year: 1983, Runtime: 114, Genres: data.Genres{"thriller"}}
+	for _, m := range []*data.Movie{warGames, starTrek, starWars} {
+		assertions.AssertNoError(t, movies.Insert(m, 0))
+	}
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         "relevance",
+		SortSafelist: []string{"id", "relevance"},
+	}
+
+	// Star Trek is still similar enough, but ranks lower
+	gotMovs, _, err := movies.GetAll(data.MovieFilters{Title: "star wa"}, filters)
+	assertions.AssertNoError(t, err)
+	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{starWars, starTrek})
+
+	gotMovs, _, err = movies.GetAll(data.MovieFilters{Title: "star"}, filters)
+	assertions.AssertNoError(t, err)
+	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{starTrek, starWars})
+
+	gotMovs, _, err = movies.GetAll(data.MovieFilters{Title: "wars"}, filters)
+	assertions.AssertNoError(t, err)
+	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{starWars})
+
+	gotMovs, _, err = movies.GetAll(data.MovieFilters{Title: "wargams"}, filters)
+	assertions.AssertNoError(t, err)
+	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{warGames})
+
+	gotMovs, _, err = movies.GetAll(data.MovieFilters{Title: "wars", Highlight: true}, filters)
+	assertions.AssertNoError(t, err)
+	if len(gotMovs) != 1 || gotMovs[0].Highlight != "Star <mark>Wars</mark>" {
+		t.Errorf("expected highlighted title of %q, got: %v", starWars.Title, gotMovs)
+	}
+
+	stored, err := movies.GetByID(starWars.ID)
+	assertions.AssertNoError(t, err)
+	if stored.Highlight != "" {
+		t.Errorf("expected stored movie not to be highlighted, got: %q", stored.Highlight)
+	}
+}
+
+func TestMoviesGetByIDs(t *testing.T) {
+	movies := data.NewMockModels().Movies
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	heat := &data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"crime"}}
+	alien := &data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: data.Genres{"horror"}}
+	for _, m := range []*data.Movie{moana, heat, alien} {
+		assertions.AssertNoError(t, movies.Insert(m, 0))
+	}
+	assertions.AssertNoError(t, movies.Delete(heat, 0))
+
+	gotMovs, err := movies.GetByIDs([]int64{alien.ID, 99, heat.ID, moana.ID, alien.ID})
+	assertions.AssertNoError(t, err)
+	assertions.AssertMovieLists(t, gotMovs, []*data.Movie{alien, moana})
+}
+
+func TestMoviesSelectedFields(t *testing.T) {
+	movies := data.NewMockModels().Movies
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, movies.Insert(moana, 0))
+
+	want := &data.Movie{ID: moana.ID, Version: moana.Version, Title: "Moana", Year: 2016}
+
+	got, err := movies.GetByID(moana.ID, "title", "year")
+	assertions.AssertNoError(t, err)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	gotMovs, err := movies.GetByIDs([]int64{moana.ID}, "title", "year")
+	assertions.AssertNoError(t, err)
+	if len(gotMovs) != 1 || !reflect.DeepEqual(gotMovs[0], want) {
+		t.Errorf("got %+v, want [%+v]", gotMovs, want)
+	}
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}}
+	gotMovs, _, err = movies.GetAll(data.MovieFilters{}, filters, "title", "year")
+	assertions.AssertNoError(t, err)
+	if len(gotMovs) != 1 || !reflect.DeepEqual(gotMovs[0], want) {
+		t.Errorf("got %+v, want [%+v]", gotMovs, want)
+	}
+
+	// Movies read without fields are whole
+	got, err = movies.GetByID(moana.ID)
+	assertions.AssertNoError(t, err)
+	if !reflect.DeepEqual(got.Genres, moana.Genres) || got.Runtime != moana.Runtime {
+		t.Errorf("got %+v, want %+v", got, moana)
+	}
+}
+
+func TestMoviesFacets(t *testing.T) {
+	movies := data.NewMockModels().Movies
+
+	for _, m := range []*data.Movie{
+		{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation", "adventure"}},
+		{Title: "Black Panther", Year: 2018, Runtime: 134, Genres: data.Genres{"action", "adventure"}},
+		{Title: "The Breakfast Club", Year: 1985, Runtime: 97, Genres: data.Genres{"comedy", "drama"}},
+		{Title: "Heat", Year: 1995, Runtime: 170, Genres: data.Genres{"action", "crime"}},
+	} {
+		assertions.AssertNoError(t, movies.Insert(m, 0))
+	}
+
+	got, err := movies.Facets(data.MovieFilters{}, data.MovieFacets)
+	assertions.AssertNoError(t, err)
+
+	want := data.Facets{
+		"genres": {
+			{Value: "action", Count: 2},
+			{Value: "adventure", Count: 2},
+			{Value: "animation", Count: 1},
+			{Value: "comedy", Count: 1},
+			{Value: "crime", Count: 1},
+			{Value: "drama", Count: 1},
+		},
+		"decade": {
+			{Value: "1980s", Count: 1},
+			{Value: "1990s", Count: 1},
+			{Value: "2010s", Count: 2},
+		},
+		"runtime_bucket": {
+			{Value: "90-119", Count: 2},
+			{Value: "120-149", Count: 1},
+			{Value: "150+", Count: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	got, err = movies.Facets(data.MovieFilters{Genres: data.Genres{"adventure"}}, []string{"decade"})
+	assertions.AssertNoError(t, err)
+
+	want = data.Facets{"decade": {{Value: "2010s", Count: 2}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestMoviesRangeFilters(t *testing.T) {
+	movies := data.NewMockModels().Movies
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation", "adventure"}}
+	blackPanther := &data.Movie{Title: "Black Panther", Year: 2018, Runtime: 134, Genres: data.Genres{"action", "adventure"}}
+	breakfastClub := &data.Movie{Title: "The Breakfast Club", Year: 1985, Runtime: 97, Genres: data.Genres{"comedy", "drama"}}
+	for _, m := range []*data.Movie{moana, blackPanther, breakfastClub} {
+		assertions.AssertNoError(t, movies.Insert(m, 0))
+	}
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}}
+
+	tests := []struct {
+		name         string
+		movieFilters data.MovieFilters
+		want         []*data.Movie
+	}{
+		{
+			name:         "year range",
+			movieFilters: data.MovieFilters{YearMin: 2000, YearMax: 2016},
+			want:         []*data.Movie{moana},
+		},
+		{
+			name:         "runtime range",
+			movieFilters: data.MovieFilters{RuntimeMin: 100},
+			want:         []*data.Movie{moana, blackPanther},
+		},
+		{
+			name:         "any of genres",
+			movieFilters: data.MovieFilters{GenresAny: data.Genres{"animation", "drama"}},
+			want:         []*data.Movie{moana, breakfastClub},
+		},
+		{
+			name:         "excluded genres",
+			movieFilters: data.MovieFilters{Genres: data.Genres{"adventure"}, GenresExclude: data.Genres{"action"}},
+			want:         []*data.Movie{moana},
+		},
+		{
+			name:         "created after",
+			movieFilters: data.MovieFilters{CreatedAfter: data.MockTimeStamp},
+			want:         []*data.Movie{moana, blackPanther, breakfastClub},
+		},
+		{
+			name:         "created before",
+			movieFilters: data.MovieFilters{CreatedBefore: data.MockTimeStamp},
+			want:         []*data.Movie{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := movies.GetAll(tt.movieFilters, filters)
+			assertions.AssertNoError(t, err)
+			assertions.AssertMovieLists(t, got, tt.want)
+		})
+	}
+}
+
+func TestMoviesImport(t *testing.T) {
+	movies := data.NewMovieInMemRepo()
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	deadpool := &data.Movie{Title: "Deadpool", Year: 2016, Runtime: 108, Genres: data.Genres{"action"}}
+
+	imp, err := movies.BeginImport(true, 0)
+	assertions.AssertNoError(t, err)
+	for _, movie := range []*data.Movie{moana, deadpool} {
+		rowErrs, err := imp.Insert([]*data.Movie{movie})
+		assertions.AssertNoError(t, err)
+		assertions.AssertNoError(t, errors.Join(rowErrs...))
+	}
+	assertions.AssertNoError(t, imp.Commit())
+	if moana.ID != 1 || deadpool.ID != 2 {
+		t.Errorf("expected ids 1 and 2, got %d and %d", moana.ID, deadpool.ID)
+	}
+
+	up := &data.Movie{Title: "Up", Year: 2009, Runtime: 96, Genres: data.Genres{"animation"}}
+	dup := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+
+	imp, err = movies.BeginImport(true, 0)
+	assertions.AssertNoError(t, err)
+	_, err = imp.Insert([]*data.Movie{up})
+	assertions.AssertNoError(t, err)
+	if _, err = imp.Insert([]*data.Movie{dup}); !errors.Is(err, data.ErrMovieAlreadyExists) {
+		t.Fatalf("expected already exists error but got: %v", err)
+	}
+	assertions.AssertNoError(t, imp.Rollback())
+	if _, err = movies.GetByID(3); !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("rolled back import must not be partially inserted")
+	}
+
+	imp, err = movies.BeginImport(false, 0)
+	assertions.AssertNoError(t, err)
+	rowErrs, err := imp.Insert([]*data.Movie{up, dup})
+	assertions.AssertNoError(t, err)
+	assertions.AssertNoError(t, imp.Commit())
+	assertions.AssertNoError(t, rowErrs[0])
+	if !errors.Is(rowErrs[1], data.ErrMovieAlreadyExists) {
+		t.Errorf("expected already exists error but got: %v", rowErrs[1])
+	}
+	if up.ID != 3 {
+		t.Errorf("expected id 3, got %d", up.ID)
+	}
+}
+
+func TestMoviesTrash(t *testing.T) {
+	movies := data.NewMovieInMemRepo()
+
+	moana := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	deadpool := &data.Movie{Title: "Deadpool", Year: 2016, Runtime: 108, Genres: data.Genres{"action"}}
+	assertions.AssertNoError(t, movies.Insert(moana, 0))
+	assertions.AssertNoError(t, movies.Insert(deadpool, 0))
+
+	assertions.AssertNoError(t, movies.Delete(moana, 0))
+	if err := movies.Delete(moana, 0); !errors.Is(err, data.ErrEditConflict) {
+		t.Errorf("expected edit conflict deleting trashed movie, got %v", err)
+	}
+
+	_, err := movies.GetByID(moana.ID)
+	assertions.AssertNotFoundError(t, err)
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "-deleted_at", SortSafelist: []string{"-deleted_at"}}
+
+	trash, meta, err := movies.GetAllDeleted(filters)
+	assertions.AssertNoError(t, err)
+	assertions.AssertMovieLists(t, trash, []*data.Movie{moana})
+	if meta.TotalRecords != 1 {
+		t.Errorf("expected 1 movie in trash, got %d", meta.TotalRecords)
+	}
+
+	_, err = movies.Purge(deadpool.ID)
+	assertions.AssertNotFoundError(t, err)
+
+	restored, err := movies.Restore(moana.ID, 0)
+	assertions.AssertNoError(t, err)
+	if restored.DeletedAt != nil || restored.Version != 3 {
+		t.Errorf("unexpected restored movie: %+v", restored)
+	}
+
+	restored.Title = "Moana 2"
+	if stored, _ := movies.GetByID(moana.ID); stored.Title != "Moana" {
+		t.Errorf("restored movie shares state with the stored one: %+v", stored)
+	}
+
+	_, err = movies.Restore(moana.ID, 0)
+	assertions.AssertNotFoundError(t, err)
+
+	poster := data.NewPoster("posters/2/ab12")
+	assertions.AssertNoError(t, movies.SetPoster(deadpool, poster, 0))
+	assertions.AssertNoError(t, movies.Delete(deadpool, 0))
+
+	purged, keys, err := movies.PurgeDeletedBefore(data.MockTimeStamp)
+	assertions.AssertNoError(t, err)
+	if purged != 0 || len(keys) != 0 {
+		t.Errorf("expected nothing to be purged, got %d movies and blobs %v", purged, keys)
+	}
+
+	purged, keys, err = movies.PurgeDeletedBefore(data.MockTimeStamp.Add(time.Second))
+	assertions.AssertNoError(t, err)
+	if purged != 1 {
+		t.Errorf("expected 1 purged movie, got %d", purged)
+	}
+	if !slices.Equal(keys, poster.BlobKeys()) {
+		t.Errorf("got purged blobs %v, want %v", keys, poster.BlobKeys())
+	}
+
+	_, err = movies.Restore(deadpool.ID, 0)
+	assertions.AssertNotFoundError(t, err)
+}
@@ -0,0 +1,294 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// MovieTrash manages movies deleted by MovieWriter.Delete
+type MovieTrash interface {
+	GetAllDeleted(filters Filters) ([]*Movie, Metadata, error)
+	// Restore moves the movie out of the trash. It returns ErrMovieAlreadyExists
+	// if a duplicate of the movie was created meanwhile.
+	Restore(id, userID int64) (*Movie, error)
+	// Purge permanently deletes the movie from the trash. It returns keys of
+	// the poster and still image blobs of the movie, which are left to the
+	// caller to delete.
+	Purge(id int64) ([]string, error)
+	// PurgeDeletedBefore permanently deletes movies trashed before the given
+	// time. It returns their number along with keys of their image blobs.
+	PurgeDeletedBefore(t time.Time) (int64, []string, error)
+}
+
+func (m MovieModel) GetAllDeleted(filters Filters) (movies []*Movie, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, rating, rating_count, poster_key, %s, deleted_at
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`, externalIDsColumn("movies"), filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	movies = []*Movie{}
+	totalRecords := 0
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			&movie.Genres,
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.ExternalIDs,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MovieModel) Restore(id, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, runtime, genres, version, rating, rating_count, poster_key, ` + externalIDsColumn("movies")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginRevisionTx(ctx, m.DB, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	movie := new(Movie)
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		&movie.Genres,
+		&movie.Version,
+		&movie.Rating,
+		&movie.RatingCount,
+		&movie.Poster,
+		&movie.ExternalIDs,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		case isDuplicateMovie(err):
+			return nil, ErrMovieAlreadyExists
+		default:
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// purgedImagesColumns are poster key and still keys of the deleted movie
+const purgedImagesColumns = `poster_key, ARRAY(SELECT key FROM movie_stills WHERE movie_id = movies.id)`
+
+// purgedBlobKeys returns keys of all image blobs of the poster and stills
+func purgedBlobKeys(poster *Poster, stillKeys []string) []string {
+	var keys []string
+	if poster != nil {
+		keys = append(keys, poster.BlobKeys()...)
+	}
+	for _, key := range stillKeys {
+		keys = append(keys, NewPoster(key).BlobKeys()...)
+	}
+	return keys
+}
+
+func (m MovieModel) Purge(id int64) ([]string, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM movies
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING ` + purgedImagesColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var poster *Poster
+	var stillKeys []string
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&poster, (*Genres)(&stillKeys))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return purgedBlobKeys(poster, stillKeys), nil
+}
+
+func (m MovieModel) PurgeDeletedBefore(t time.Time) (purged int64, keys []string, err error) {
+	query := `
+		DELETE FROM movies
+		WHERE deleted_at < $1
+		RETURNING ` + purgedImagesColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, t)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	for rows.Next() {
+		var poster *Poster
+		var stillKeys []string
+		if err = rows.Scan(&poster, (*Genres)(&stillKeys)); err != nil {
+			return 0, nil, err
+		}
+		keys = append(keys, purgedBlobKeys(poster, stillKeys)...)
+		purged++
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return purged, keys, nil
+}
+
+func (m *MovieInMemRepo) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deleted := make([]*Movie, 0)
+	for _, mov := range m.movies {
+		if mov.DeletedAt != nil {
+			movie := *mov
+			deleted = append(deleted, &movie)
+		}
+	}
+
+	slices.SortFunc(deleted, func(a, b *Movie) int {
+		return compareMovies(a, b, filters.Sort)
+	})
+
+	totalRecords := len(deleted)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return deleted[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *MovieInMemRepo) Restore(id, userID int64) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok || movie.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+	if m.alreadyExists(movie) {
+		return nil, ErrMovieAlreadyExists
+	}
+
+	movie.DeletedAt = nil
+	movie.Version++
+
+	m.logChange(ChangeCreated, movie)
+	m.recordRevision(movie, RevisionRestore, userID)
+
+	mov := *movie
+	return &mov, nil
+}
+
+func (m *MovieInMemRepo) Purge(id int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok || movie.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.purge(movie), nil
+}
+
+func (m *MovieInMemRepo) PurgeDeletedBefore(t time.Time) (int64, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	var keys []string
+	for _, movie := range m.movies {
+		if movie.DeletedAt != nil && movie.DeletedAt.Before(t) {
+			keys = append(keys, m.purge(movie)...)
+			purged++
+		}
+	}
+	return purged, keys, nil
+}
+
+// purge deletes the movie along with its stills and returns keys of their
+// image blobs
+func (m *MovieInMemRepo) purge(movie *Movie) []string {
+	delete(m.movies, movie.ID)
+
+	keys := purgedBlobKeys(movie.Poster, nil)
+	if m.stills != nil {
+		keys = append(keys, m.stills.purge(movie.ID)...)
+	}
+	return keys
+}
@@ -0,0 +1,302 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type PersonRepository interface {
+	Insert(person *Person) error
+	GetByID(id int64) (*Person, error)
+	GetAll(name string, filters Filters) ([]*Person, Metadata, error)
+	Update(person *Person) error
+	// Delete permanently deletes the person along with all of their credits
+	Delete(id int64) error
+}
+
+// Person is anyone credited in movies: directors, cast and crew
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitempty"`
+	Bio       string    `json:"bio,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	if person.BirthYear != 0 {
+		v.Check(person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(int(person.BirthYear) <= time.Now().Year(), "birth_year", "must not be in the future")
+	}
+
+	v.Check(len(person.Bio) <= 5000, "bio", "must not be more than 5000 bytes long")
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (m PersonModel) Insert(person *Person) error {
+	query := `
+		INSERT INTO people (name, birth_year, bio)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+
+	args := []any{person.Name, person.BirthYear, person.Bio}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (m PersonModel) GetByID(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, birth_year, bio, version
+		FROM people
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var person Person
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.Bio,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (m PersonModel) GetAll(name string, filters Filters) (people []*Person, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, created_at, name, birth_year, bio, version
+		FROM people
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	people = []*Person{}
+	totalRecords := 0
+	for rows.Next() {
+		var person Person
+
+		err = rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Bio,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return people, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m PersonModel) Update(person *Person) error {
+	query := `
+		UPDATE people
+		SET name = $1, birth_year = $2, bio = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+
+	args := []any{person.Name, person.BirthYear, person.Bio, person.ID, person.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "DELETE FROM people WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type PersonInMemRepo struct {
+	mu        sync.RWMutex
+	idCounter int64
+	people    map[int64]*Person
+	clock     Clock
+}
+
+func NewPersonInMemRepo() *PersonInMemRepo {
+	return &PersonInMemRepo{
+		idCounter: 1,
+		people:    make(map[int64]*Person),
+		clock:     MockClock{},
+	}
+}
+
+func (m *PersonInMemRepo) Insert(person *Person) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	person.ID = m.idCounter
+	person.CreatedAt = m.clock.Now()
+	person.Version = 1
+
+	p := *person
+	m.people[m.idCounter] = &p
+	m.idCounter++
+
+	return nil
+}
+
+func (m *PersonInMemRepo) GetByID(id int64) (*Person, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	person, ok := m.people[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	p := *person
+	return &p, nil
+}
+
+func (m *PersonInMemRepo) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lowerName := strings.ToLower(name)
+
+	people := make([]*Person, 0, len(m.people))
+	for _, person := range m.people {
+		if lowerName == "" || strings.Contains(strings.ToLower(person.Name), lowerName) {
+			people = append(people, person)
+		}
+	}
+
+	slices.SortFunc(people, func(a, b *Person) int {
+		var c int
+		if filters.sortColumn() == "name" {
+			c = strings.Compare(a.Name, b.Name)
+		}
+		if filters.sortDirection() == "DESC" {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		if filters.sortColumn() == "id" && filters.sortDirection() == "DESC" {
+			return cmp.Compare(b.ID, a.ID)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	totalRecords := len(people)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return people[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *PersonInMemRepo) Update(person *Person) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.people[person.ID]
+	if !ok || stored.Version != person.Version {
+		return ErrEditConflict
+	}
+
+	person.Version++
+	p := *person
+	m.people[person.ID] = &p
+	return nil
+}
+
+func (m *PersonInMemRepo) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.people[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.people, id)
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 const (
 	MoviesWrite = "movies:write"
 	MoviesRead  = "movies:read"
+	Admin       = "admin"
 )
 
 type PermissionRepository interface {
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PosterSizes are names and widths in pixels of poster thumbnails
+var PosterSizes = []struct {
+	Name  string
+	Width int
+}{
+	{Name: "small", Width: 92},
+	{Name: "medium", Width: 185},
+	{Name: "large", Width: 500},
+}
+
+// PosterOriginal is the name of uploaded poster image
+const PosterOriginal = "original"
+
+// Poster holds URLs of the movie poster and its thumbnails. Images are stored
+// as blobs named by the key followed by the size name, e.g. "posters/1/ab12/small".
+type Poster struct {
+	Key      string `json:"-"`
+	Original string `json:"original"`
+	Small    string `json:"small"`
+	Medium   string `json:"medium"`
+	Large    string `json:"large"`
+}
+
+// NewPoster returns poster stored under key. Its images are served by the API
+// under the same path.
+func NewPoster(key string) *Poster {
+	url := func(size string) string {
+		return "/v1/" + key + "/" + size
+	}
+
+	return &Poster{
+		Key:      key,
+		Original: url(PosterOriginal),
+		Small:    url("small"),
+		Medium:   url("medium"),
+		Large:    url("large"),
+	}
+}
+
+// BlobKeys returns keys of the original image and all of the thumbnails
+func (p *Poster) BlobKeys() []string {
+	keys := []string{p.Key + "/" + PosterOriginal}
+	for _, size := range PosterSizes {
+		keys = append(keys, p.Key+"/"+size.Name)
+	}
+	return keys
+}
+
+func (p *Poster) Scan(src any) error {
+	switch key := src.(type) {
+	case string:
+		*p = *NewPoster(key)
+	case []byte:
+		*p = *NewPoster(string(key))
+	default:
+		return fmt.Errorf("cannot scan %T into poster", src)
+	}
+	return nil
+}
+
+func (m MovieModel) SetPoster(movie *Movie, poster *Poster, userID int64) error {
+	query := `
+		UPDATE movies
+		SET poster_key = $1, version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING version`
+
+	var key *string
+	if poster != nil {
+		key = &poster.Key
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginRevisionTx(ctx, m.DB, userID, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = tx.QueryRowContext(ctx, query, key, movie.ID, movie.Version).Scan(&movie.Version); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	movie.Poster = poster
+	return nil
+}
+
+func (m *MovieInMemRepo) SetPoster(movie *Movie, poster *Poster, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movie.ID]
+	if !ok || stored.DeletedAt != nil || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	updated := *stored
+	updated.Poster = poster
+	updated.Version++
+	m.movies[movie.ID] = &updated
+	m.logChange(ChangeUpdated, &updated)
+	m.recordRevision(&updated, RevisionUpdate, userID)
+
+	movie.Poster = poster
+	movie.Version = updated.Version
+	return nil
+}
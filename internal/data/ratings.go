@@ -0,0 +1,378 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+var ErrDuplicateRating = errors.New("duplicate rating")
+
+// RatingRepository stores user ratings keeping aggregated rating of movies up
+// to date within the same transaction.
+type RatingRepository interface {
+	// Insert returns ErrDuplicateRating if the user has already rated the movie
+	Insert(rating *Rating) error
+	Get(movieID, userID int64) (*Rating, error)
+	Update(rating *Rating) error
+	Delete(movieID, userID int64) error
+	GetAllForMovie(movieID int64, filters Filters) ([]*Rating, Metadata, error)
+}
+
+// Rating is a score from 1 to 10 given to the movie by a user with an optional review
+type Rating struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Rating    int32     `json:"rating"`
+	Review    string    `json:"review,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Rating >= 1 && rating.Rating <= 10, "rating", "must be between 1 and 10")
+	v.Check(len(rating.Review) <= 10_000, "review", "must not be more than 10000 bytes long")
+}
+
+type RatingModel struct {
+	DB *sql.DB
+}
+
+func (m RatingModel) Insert(rating *Rating) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		INSERT INTO movie_ratings (movie_id, user_id, rating, review)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at, updated_at`
+
+	args := []any{rating.MovieID, rating.UserID, rating.Rating, rating.Review}
+
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&rating.CreatedAt, &rating.UpdatedAt); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateRating
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if err = adjustMovieRating(ctx, tx, rating.MovieID, int64(rating.Rating), 1); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m RatingModel) Get(movieID, userID int64) (*Rating, error) {
+	query := `
+		SELECT movie_id, user_id, rating, review, created_at, updated_at
+		FROM movie_ratings
+		WHERE movie_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rating Rating
+	err := m.DB.QueryRowContext(ctx, query, movieID, userID).Scan(
+		&rating.MovieID,
+		&rating.UserID,
+		&rating.Rating,
+		&rating.Review,
+		&rating.CreatedAt,
+		&rating.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rating, nil
+}
+
+func (m RatingModel) Update(rating *Rating) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		WITH old AS (
+			SELECT rating FROM movie_ratings
+			WHERE movie_id = $1 AND user_id = $2
+			FOR UPDATE
+		)
+		UPDATE movie_ratings r
+		SET rating = $3, review = $4, updated_at = NOW()
+		FROM old
+		WHERE r.movie_id = $1 AND r.user_id = $2
+		RETURNING old.rating, r.created_at, r.updated_at`
+
+	args := []any{rating.MovieID, rating.UserID, rating.Rating, rating.Review}
+
+	var old int64
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&old, &rating.CreatedAt, &rating.UpdatedAt); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if err = adjustMovieRating(ctx, tx, rating.MovieID, int64(rating.Rating)-old, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m RatingModel) Delete(movieID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		DELETE FROM movie_ratings
+		WHERE movie_id = $1 AND user_id = $2
+		RETURNING rating`
+
+	var old int64
+	if err = tx.QueryRowContext(ctx, query, movieID, userID).Scan(&old); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if err = adjustMovieRating(ctx, tx, movieID, -old, -1); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// adjustMovieRating updates running totals of movie ratings. The average is a
+// generated column, so it's kept in sync by Postgres.
+func adjustMovieRating(ctx context.Context, tx *sql.Tx, movieID, sumDelta, countDelta int64) error {
+	query := `
+		UPDATE movies
+		SET rating_sum = rating_sum + $2, rating_count = rating_count + $3
+		WHERE id = $1`
+
+	_, err := tx.ExecContext(ctx, query, movieID, sumDelta, countDelta)
+	return err
+}
+
+func (m RatingModel) GetAllForMovie(movieID int64, filters Filters) (ratings []*Rating, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), movie_id, user_id, rating, review, created_at, updated_at
+		FROM movie_ratings
+		WHERE movie_id = $1
+		ORDER BY %s %s, user_id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	ratings = []*Rating{}
+	totalRecords := 0
+	for rows.Next() {
+		var rating Rating
+
+		err = rows.Scan(
+			&totalRecords,
+			&rating.MovieID,
+			&rating.UserID,
+			&rating.Rating,
+			&rating.Review,
+			&rating.CreatedAt,
+			&rating.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		ratings = append(ratings, &rating)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return ratings, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+type RatingInMemRepo struct {
+	mu      sync.RWMutex
+	ratings map[int64][]*Rating
+	movies  *MovieInMemRepo
+	clock   Clock
+}
+
+func NewRatingInMemRepo(movies *MovieInMemRepo) *RatingInMemRepo {
+	return &RatingInMemRepo{
+		ratings: make(map[int64][]*Rating),
+		movies:  movies,
+		clock:   MockClock{},
+	}
+}
+
+func (m *RatingInMemRepo) Insert(rating *Rating) error {
+	if _, err := m.movies.GetByID(rating.MovieID); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.find(rating.MovieID, rating.UserID) != -1 {
+		return ErrDuplicateRating
+	}
+
+	rating.CreatedAt = m.clock.Now()
+	rating.UpdatedAt = rating.CreatedAt
+
+	r := *rating
+	m.ratings[rating.MovieID] = append(m.ratings[rating.MovieID], &r)
+	m.aggregate(rating.MovieID)
+
+	return nil
+}
+
+func (m *RatingInMemRepo) Get(movieID, userID int64) (*Rating, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.find(movieID, userID)
+	if i == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	r := *m.ratings[movieID][i]
+	return &r, nil
+}
+
+func (m *RatingInMemRepo) Update(rating *Rating) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.find(rating.MovieID, rating.UserID)
+	if i == -1 {
+		return ErrRecordNotFound
+	}
+
+	rating.CreatedAt = m.ratings[rating.MovieID][i].CreatedAt
+	rating.UpdatedAt = m.clock.Now()
+
+	r := *rating
+	m.ratings[rating.MovieID][i] = &r
+	m.aggregate(rating.MovieID)
+
+	return nil
+}
+
+func (m *RatingInMemRepo) Delete(movieID, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.find(movieID, userID)
+	if i == -1 {
+		return ErrRecordNotFound
+	}
+
+	m.ratings[movieID] = slices.Delete(m.ratings[movieID], i, i+1)
+	m.aggregate(movieID)
+
+	return nil
+}
+
+func (m *RatingInMemRepo) GetAllForMovie(movieID int64, filters Filters) ([]*Rating, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ratings := slices.Clone(m.ratings[movieID])
+	slices.SortFunc(ratings, func(a, b *Rating) int {
+		var c int
+		switch filters.sortColumn() {
+		case "rating":
+			c = cmp.Compare(a.Rating, b.Rating)
+		case "created_at":
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if filters.sortDirection() == "DESC" {
+			c = -c
+		}
+		return cmp.Or(c, cmp.Compare(a.UserID, b.UserID))
+	})
+
+	totalRecords := len(ratings)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return ratings[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// find returns index of the user's rating of the movie or -1. Caller must hold the lock.
+func (m *RatingInMemRepo) find(movieID, userID int64) int {
+	return slices.IndexFunc(m.ratings[movieID], func(r *Rating) bool {
+		return r.UserID == userID
+	})
+}
+
+// aggregate updates movie rating from the stored ratings. Caller must hold the lock.
+func (m *RatingInMemRepo) aggregate(movieID int64) {
+	var sum int64
+	for _, r := range m.ratings[movieID] {
+		sum += int64(r.Rating)
+	}
+	m.movies.setRating(movieID, sum, int32(len(m.ratings[movieID])))
+}
@@ -0,0 +1,85 @@
+package data_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func TestRatings(t *testing.T) {
+	movies := data.NewMovieInMemRepo()
+	ratings := data.NewRatingInMemRepo(movies)
+
+	for _, m := range []*data.Movie{
+		{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}},
+		{Title: "Deadpool", Year: 2016, Runtime: 108, Genres: data.Genres{"action"}},
+		{Title: "Cars", Year: 2006, Runtime: 117, Genres: data.Genres{"animation"}},
+	} {
+		assertions.AssertNoError(t, movies.Insert(m, 0))
+	}
+
+	for _, r := range []*data.Rating{
+		{MovieID: 1, UserID: 1, Rating: 7},
+		{MovieID: 1, UserID: 2, Rating: 8},
+		{MovieID: 1, UserID: 3, Rating: 8},
+		{MovieID: 2, UserID: 1, Rating: 9},
+	} {
+		assertions.AssertNoError(t, ratings.Insert(r))
+	}
+
+	err := ratings.Insert(&data.Rating{MovieID: 1, UserID: 1, Rating: 1})
+	if !errors.Is(err, data.ErrDuplicateRating) {
+		t.Errorf("expected duplicate rating error but got: %v", err)
+	}
+	assertions.AssertNotFoundError(t, ratings.Insert(&data.Rating{MovieID: 7, UserID: 1, Rating: 1}))
+
+	moana, err := movies.GetByID(1)
+	assertions.AssertNoError(t, err)
+	if moana.Rating != 7.67 || moana.RatingCount != 3 {
+		t.Errorf("got rating %v of %d, want 7.67 of 3", moana.Rating, moana.RatingCount)
+	}
+
+	assertions.AssertNoError(t, ratings.Update(&data.Rating{MovieID: 1, UserID: 1, Rating: 2}))
+	assertions.AssertNoError(t, ratings.Delete(1, 3))
+
+	moana, err = movies.GetByID(1)
+	assertions.AssertNoError(t, err)
+	if moana.Rating != 5 || moana.RatingCount != 2 {
+		t.Errorf("got rating %v of %d, want 5 of 2", moana.Rating, moana.RatingCount)
+	}
+
+	// Updating the movie must keep its rating
+	moana.Title = "Moana!"
+	assertions.AssertNoError(t, movies.Update(moana, 0))
+	if moana.Rating != 5 || moana.RatingCount != 2 {
+		t.Errorf("update changed rating to %v of %d", moana.Rating, moana.RatingCount)
+	}
+
+	filters := data.Filters{
+		PageSize:     1,
+		Sort:         "-rating",
+		SortSafelist: []string{"-rating"},
+		Cursor:       &data.Cursor{},
+	}
+
+	var ids []int64
+	for {
+		page, meta, err := movies.GetAll(data.MovieFilters{}, filters)
+		assertions.AssertNoError(t, err)
+		for _, m := range page {
+			ids = append(ids, m.ID)
+		}
+		if meta.NextCursor == "" {
+			break
+		}
+		filters.Cursor, err = data.DecodeCursor(meta.NextCursor)
+		assertions.AssertNoError(t, err)
+	}
+
+	if !slices.Equal(ids, []int64{2, 1, 3}) {
+		t.Errorf("got movies %v by rating, want %v", ids, []int64{2, 1, 3})
+	}
+}
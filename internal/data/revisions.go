@@ -0,0 +1,266 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+	RevisionMerge   = "merge"
+)
+
+// MovieRevisionRepository reads movie revisions. They are recorded by
+// MovieWriter methods along with every new version of a movie.
+type MovieRevisionRepository interface {
+	Get(movieID int64, version int32) (*MovieRevision, error)
+	GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error)
+}
+
+// MovieRevision is a snapshot of the movie state produced by a single change
+type MovieRevision struct {
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Action    string    `json:"action"`
+	UserID    int64     `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	Runtime   Runtime   `json:"runtime"`
+	Genres    Genres    `json:"genres"`
+}
+
+func NewMovieRevision(movie *Movie, action string, userID int64) *MovieRevision {
+	return &MovieRevision{
+		MovieID: movie.ID,
+		Version: movie.Version,
+		Action:  action,
+		UserID:  userID,
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  slices.Clone(movie.Genres),
+	}
+}
+
+// Apply sets movie fields to the state recorded in the revision
+func (rev *MovieRevision) Apply(movie *Movie) {
+	movie.Title = rev.Title
+	movie.Year = rev.Year
+	movie.Runtime = rev.Runtime
+	movie.Genres = slices.Clone(rev.Genres)
+}
+
+type FieldDiff struct {
+	From    any      `json:"from"`
+	To      any      `json:"to"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// DiffRevisions returns fields changed between two revisions keyed by JSON field names
+func DiffRevisions(from, to *MovieRevision) map[string]FieldDiff {
+	diff := make(map[string]FieldDiff)
+
+	if from.Title != to.Title {
+		diff["title"] = FieldDiff{From: from.Title, To: to.Title}
+	}
+	if from.Year != to.Year {
+		diff["year"] = FieldDiff{From: from.Year, To: to.Year}
+	}
+	if from.Runtime != to.Runtime {
+		diff["runtime"] = FieldDiff{From: from.Runtime, To: to.Runtime}
+	}
+	if !slices.Equal(from.Genres, to.Genres) {
+		genres := FieldDiff{From: from.Genres, To: to.Genres}
+		for _, g := range to.Genres {
+			if !slices.Contains(from.Genres, g) {
+				genres.Added = append(genres.Added, g)
+			}
+		}
+		for _, g := range from.Genres {
+			if !slices.Contains(to.Genres, g) {
+				genres.Removed = append(genres.Removed, g)
+			}
+		}
+		diff["genres"] = genres
+	}
+
+	return diff
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+// beginRevisionTx starts a transaction attributing movie revisions recorded by
+// the movies table trigger to the user. Empty action lets the trigger derive it
+// from the change.
+func beginRevisionTx(ctx context.Context, db *sql.DB, userID int64, action string) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	user := ""
+	if userID != 0 {
+		user = strconv.FormatInt(userID, 10)
+	}
+
+	query := `SELECT set_config('greenlight.user_id', $1, true), set_config('greenlight.revision_action', $2, true)`
+	if _, err = tx.ExecContext(ctx, query, user, action); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func (m MovieRevisionModel) Get(movieID int64, version int32) (*MovieRevision, error) {
+	query := `
+		SELECT movie_id, version, action, COALESCE(user_id, 0), created_at, title, year, runtime, genres
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rev MovieRevision
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&rev.MovieID,
+		&rev.Version,
+		&rev.Action,
+		&rev.UserID,
+		&rev.CreatedAt,
+		&rev.Title,
+		&rev.Year,
+		&rev.Runtime,
+		&rev.Genres,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
+
+func (m MovieRevisionModel) GetAllForMovie(movieID int64, filters Filters) (revisions []*MovieRevision, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), movie_id, version, action, COALESCE(user_id, 0), created_at, title, year, runtime, genres
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY %s %s
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	revisions = []*MovieRevision{}
+	totalRecords := 0
+	for rows.Next() {
+		var rev MovieRevision
+
+		err = rows.Scan(
+			&totalRecords,
+			&rev.MovieID,
+			&rev.Version,
+			&rev.Action,
+			&rev.UserID,
+			&rev.CreatedAt,
+			&rev.Title,
+			&rev.Year,
+			&rev.Runtime,
+			&rev.Genres,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return revisions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+type MovieRevisionInMemRepo struct {
+	mu        sync.RWMutex
+	revisions map[int64][]*MovieRevision
+	clock     Clock
+}
+
+func NewMovieRevisionInMemRepo() *MovieRevisionInMemRepo {
+	return &MovieRevisionInMemRepo{
+		revisions: make(map[int64][]*MovieRevision),
+		clock:     MockClock{},
+	}
+}
+
+// record stores revision of the movie, just like the movies table trigger does
+func (m *MovieRevisionInMemRepo) record(movie *Movie, action string, userID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rev := NewMovieRevision(movie, action, userID)
+	rev.CreatedAt = m.clock.Now()
+	m.revisions[movie.ID] = append(m.revisions[movie.ID], rev)
+}
+
+func (m *MovieRevisionInMemRepo) Get(movieID int64, version int32) (*MovieRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rev := range m.revisions[movieID] {
+		if rev.Version == version {
+			return rev, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m *MovieRevisionInMemRepo) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := slices.Clone(m.revisions[movieID])
+	slices.SortFunc(revisions, func(a, b *MovieRevision) int {
+		if filters.sortDirection() == "DESC" {
+			return cmp.Compare(b.Version, a.Version)
+		}
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	totalRecords := len(revisions)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return revisions[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,92 @@
+package data_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/data"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func TestMovieRevisions(t *testing.T) {
+	models := data.NewMockModels()
+	revisions := models.MovieRevisions
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, models.Movies.Insert(movie, 1))
+
+	movie.Title = "Moana 2"
+	movie.Year = 2024
+	movie.Genres = data.Genres{"adventure", "animation"}
+	assertions.AssertNoError(t, models.Movies.Update(movie, 2))
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "-version", SortSafelist: []string{"-version"}}
+	got, meta, err := revisions.GetAllForMovie(1, filters)
+	assertions.AssertNoError(t, err)
+	if len(got) != 2 || got[0].Version != 2 || got[1].Version != 1 || meta.TotalRecords != 2 {
+		t.Fatalf("unexpected revisions: %+v, %+v", got, meta)
+	}
+	if got[0].Action != data.RevisionUpdate || got[0].UserID != 2 || got[1].Action != data.RevisionInsert || got[1].UserID != 1 {
+		t.Errorf("unexpected revision attribution: %+v, %+v", got[0], got[1])
+	}
+
+	first, err := revisions.Get(1, 1)
+	assertions.AssertNoError(t, err)
+	_, err = revisions.Get(1, 3)
+	assertions.AssertNotFoundError(t, err)
+
+	gotDiff := data.DiffRevisions(first, got[0])
+	wantDiff := map[string]data.FieldDiff{
+		"title": {From: "Moana", To: "Moana 2"},
+		"year":  {From: int32(2016), To: int32(2024)},
+		"genres": {
+			From:  data.Genres{"animation"},
+			To:    data.Genres{"adventure", "animation"},
+			Added: []string{"adventure"},
+		},
+	}
+	if !reflect.DeepEqual(gotDiff, wantDiff) {
+		t.Errorf("got: %+v, want: %+v", gotDiff, wantDiff)
+	}
+
+	first.Apply(movie)
+	if movie.Title != "Moana" || movie.Year != 2016 || !reflect.DeepEqual(movie.Genres, data.Genres{"animation"}) {
+		t.Errorf("revision wasn't applied: %+v", movie)
+	}
+}
+
+func TestMovieRevisionsOfEveryVersion(t *testing.T) {
+	models := data.NewMockModels()
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: data.Genres{"animation"}}
+	assertions.AssertNoError(t, models.Movies.Insert(movie, 1))
+
+	genre, err := models.Genres.Get("animation")
+	assertions.AssertNoError(t, err)
+	genre.Slug = "animated"
+	assertions.AssertNoError(t, models.Genres.Update("animation", genre, 1))
+
+	movie, err = models.Movies.GetByID(movie.ID)
+	assertions.AssertNoError(t, err)
+	assertions.AssertNoError(t, models.Movies.SetPoster(movie, data.NewPoster("posters/1/ab12"), 1))
+	assertions.AssertNoError(t, models.Movies.Delete(movie, 1))
+	_, err = models.Movies.Restore(movie.ID, 1)
+	assertions.AssertNoError(t, err)
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "version", SortSafelist: []string{"version"}}
+	revisions, _, err := models.MovieRevisions.GetAllForMovie(movie.ID, filters)
+	assertions.AssertNoError(t, err)
+
+	want := []string{data.RevisionInsert, data.RevisionUpdate, data.RevisionUpdate, data.RevisionDelete, data.RevisionRestore}
+	if len(revisions) != len(want) {
+		t.Fatalf("got %d revisions, want %d", len(revisions), len(want))
+	}
+	for i, rev := range revisions {
+		if rev.Version != int32(i+1) || rev.Action != want[i] {
+			t.Errorf("got revision %d %q, want %d %q", rev.Version, rev.Action, i+1, want[i])
+		}
+	}
+	if !reflect.DeepEqual(revisions[1].Genres, data.Genres{"animated"}) {
+		t.Errorf("got genres %v after rename, want [animated]", revisions[1].Genres)
+	}
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Minimal trigram similarity of a misspelled title, same as the default
+// pg_trgm.similarity_threshold used by the % operator.
+const trigramThreshold = 0.3
+
+// Marks wrapped around matched words of highlighted titles
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+// searchWords splits s into lowercase words the same way the 'simple' text
+// search configuration does for plain words.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixQuery builds to_tsquery input matching titles having words starting
+// with every word of the search string, so "star wa" matches "Star Wars".
+// Operators of the tsquery syntax never reach the query, as only letters and
+// digits are kept.
+func prefixQuery(search string) string {
+	words := searchWords(search)
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// matchesPrefixQuery reports whether every word of search is a prefix of some
+// word of the title
+func matchesPrefixQuery(title, search string) bool {
+	words := searchWords(search)
+	if len(words) == 0 {
+		return false
+	}
+
+	titleWords := searchWords(title)
+	for _, w := range words {
+		if !hasWordWithPrefix(titleWords, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasWordWithPrefix(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// trigrams returns the set of trigrams of s as computed by pg_trgm: every word
+// is padded with two spaces in front and one space after.
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range searchWords(s) {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// trigramSimilarity mirrors pg_trgm similarity(): the number of shared trigrams
+// divided by the number of trigrams in both strings.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// matchesTitleSearch reports whether the title is found by search either by
+// words prefixes or by trigram similarity
+func matchesTitleSearch(title, search string) bool {
+	return matchesPrefixQuery(title, search) || trigramSimilarity(title, search) >= trigramThreshold
+}
+
+// titleRank approximates ts_rank combined with trigram similarity: titles with
+// more of their words matched by search rank higher.
+func titleRank(title, search string) float64 {
+	rank := trigramSimilarity(title, search)
+
+	if matchesPrefixQuery(title, search) {
+		words := searchWords(search)
+		titleWords := searchWords(title)
+
+		matched := 0
+		for _, tw := range titleWords {
+			for _, w := range words {
+				if strings.HasPrefix(tw, w) {
+					matched++
+					break
+				}
+			}
+		}
+		rank += float64(matched) / float64(len(titleWords))
+	}
+
+	return rank
+}
+
+// highlightTitle wraps words of the title matched by search in highlight
+// marks, like ts_headline with HighlightAll option.
+func highlightTitle(title, search string) string {
+	words := searchWords(search)
+
+	var b strings.Builder
+	runes := []rune(title)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+
+		word := string(runes[i:j])
+		if hasPrefixOfAny(strings.ToLower(word), words) {
+			b.WriteString(highlightStart + word + highlightStop)
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+
+	return b.String()
+}
+
+func hasPrefixOfAny(word string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(word, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{search: "star wa", want: "star:* & wa:*"},
+		{search: "Star & !Wars", want: "star:* & wars:*"},
+		{search: "  ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			if got := prefixQuery(tt.search); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesTitleSearch(t *testing.T) {
+	tests := []struct {
+		title  string
+		search string
+		want   bool
+	}{
+		{title: "Star Wars", search: "star wa", want: true},
+		{title: "Star Wars", search: "wars", want: true},
+		{title: "Star Wars", search: "ars", want: false},
+		{title: "The Godfather", search: "godfahter", want: true},
+		{title: "The Godfather", search: "casablanca", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title+"/"+tt.search, func(t *testing.T) {
+			if got := matchesTitleSearch(tt.title, tt.search); got != tt.want {
+				t.Errorf("got: %t, want: %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	if got := trigramSimilarity("word", "word"); got != 1 {
+		t.Errorf("got: %v, want: 1", got)
+	}
+
+	// "  w", " wo", "wor", "ord", "rd " against "  w", " wo", "wor", "ore", "re "
+	if got, want := trigramSimilarity("word", "wore"), 3.0/7.0; got != want {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	if got := trigramSimilarity("word", ""); got != 0 {
+		t.Errorf("got: %v, want: 0", got)
+	}
+}
+
+func TestHighlightTitle(t *testing.T) {
+	got := highlightTitle("Star Wars: Episode IV", "star wa")
+	want := "<mark>Star</mark> <mark>Wars</mark>: Episode IV"
+	if got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MaxMovieStills is the number of stills a movie may have. Merged movies keep
+// stills of both movies, so they may exceed it.
+const MaxMovieStills = 20
+
+var ErrTooManyStills = errors.New("too many stills")
+
+type StillRepository interface {
+	// GetAllForMovie returns stills of the movie in the order they were added
+	GetAllForMovie(movieID int64) ([]*Still, error)
+	// Insert adds the still to the movie. It returns ErrRecordNotFound if the
+	// movie doesn't exist and ErrTooManyStills if it already has MaxMovieStills.
+	Insert(still *Still) error
+	// Delete removes the still of the movie and returns it, so that its images
+	// can be deleted
+	Delete(movieID, id int64) (*Still, error)
+}
+
+// Still is a frame of the movie. Its images are stored and served the same way
+// as the poster ones, under keys starting with "stills/".
+type Still struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	Images    *Poster   `json:"images"`
+}
+
+type StillModel struct {
+	DB *sql.DB
+}
+
+func (m StillModel) GetAllForMovie(movieID int64) (stills []*Still, err error) {
+	query := `
+		SELECT id, movie_id, created_at, key
+		FROM movie_stills
+		WHERE movie_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	stills = []*Still{}
+	for rows.Next() {
+		still := Still{Images: new(Poster)}
+		if err = rows.Scan(&still.ID, &still.MovieID, &still.CreatedAt, still.Images); err != nil {
+			return nil, err
+		}
+		stills = append(stills, &still)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stills, nil
+}
+
+func (m StillModel) Insert(still *Still) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// The movie is locked, so that concurrent uploads can't exceed the limit
+	var count int
+	err = tx.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM movie_stills WHERE movie_id = $1)
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE`, still.MovieID).Scan(&count)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if count >= MaxMovieStills {
+		return ErrTooManyStills
+	}
+
+	query := `
+		INSERT INTO movie_stills (movie_id, key)
+		VALUES ($1, $2)
+		RETURNING id, created_at`
+
+	if err = tx.QueryRowContext(ctx, query, still.MovieID, still.Images.Key).Scan(&still.ID, &still.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m StillModel) Delete(movieID, id int64) (*Still, error) {
+	query := `
+		DELETE FROM movie_stills
+		WHERE id = $1 AND movie_id = $2
+		RETURNING id, movie_id, created_at, key`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	still := Still{Images: new(Poster)}
+	err := m.DB.QueryRowContext(ctx, query, id, movieID).Scan(&still.ID, &still.MovieID, &still.CreatedAt, still.Images)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &still, nil
+}
+
+type StillInMemRepo struct {
+	mu        sync.RWMutex
+	idCounter int64
+	stills    []*Still
+	movies    MovieReader
+	clock     Clock
+}
+
+func NewStillInMemRepo(movies MovieReader) *StillInMemRepo {
+	return &StillInMemRepo{
+		idCounter: 1,
+		stills:    make([]*Still, 0),
+		movies:    movies,
+		clock:     MockClock{},
+	}
+}
+
+func (m *StillInMemRepo) GetAllForMovie(movieID int64) ([]*Still, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stills := []*Still{}
+	for _, still := range m.stills {
+		if still.MovieID == movieID {
+			s := *still
+			stills = append(stills, &s)
+		}
+	}
+	return stills, nil
+}
+
+func (m *StillInMemRepo) Insert(still *Still) error {
+	if _, err := m.movies.GetByID(still.MovieID); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, s := range m.stills {
+		if s.MovieID == still.MovieID {
+			count++
+		}
+	}
+	if count >= MaxMovieStills {
+		return ErrTooManyStills
+	}
+
+	still.ID = m.idCounter
+	still.CreatedAt = m.clock.Now()
+	m.idCounter++
+
+	stored := *still
+	m.stills = append(m.stills, &stored)
+	return nil
+}
+
+func (m *StillInMemRepo) Delete(movieID, id int64) (*Still, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.stills, func(s *Still) bool {
+		return s.ID == id && s.MovieID == movieID
+	})
+	if i == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	still := m.stills[i]
+	m.stills = slices.Delete(m.stills, i, i+1)
+	return still, nil
+}
+
+// repoint moves stills of the merged movie to the survivor
+func (m *StillInMemRepo) repoint(from, into int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, still := range m.stills {
+		if still.MovieID == from {
+			still.MovieID = into
+		}
+	}
+}
+
+// purge deletes stills of the purged movie and returns their blob keys
+func (m *StillInMemRepo) purge(movieID int64) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	m.stills = slices.DeleteFunc(m.stills, func(s *Still) bool {
+		if s.MovieID != movieID {
+			return false
+		}
+		keys = append(keys, s.Images.BlobKeys()...)
+		return true
+	})
+	return keys
+}
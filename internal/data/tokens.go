@@ -17,6 +17,7 @@ const (
 
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
 )
 
 type TokenRepository interface {
@@ -174,6 +175,7 @@ func (m *TokenInMemRepo) GetToken(scope string, hash []byte) (*Token, bool) {
 type Tokens struct {
 	Activation     *string
 	Authentication *string
+	PasswordReset  *string
 }
 
 func (m *TokenInMemRepo) GetUserTokens(userID int64) *Tokens {
@@ -191,6 +193,8 @@ func (m *TokenInMemRepo) GetUserTokens(userID int64) *Tokens {
 			tokens.Activation = &t
 		case ScopeAuthentication:
 			tokens.Authentication = &t
+		case ScopePasswordReset:
+			tokens.PasswordReset = &t
 		}
 	}
 	return tokens
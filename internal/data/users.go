@@ -103,6 +103,9 @@ type UserReader interface {
 type UserWriter interface {
 	Insert(user *User) error
 	Update(user *User) error
+	// UpdatePassword saves the new password of the user and deletes its tokens
+	// of the scopes in one transaction, so that they can't outlive the old one
+	UpdatePassword(user *User, revokeScopes ...string) error
 }
 
 type UserModel struct {
@@ -202,6 +205,45 @@ func (u UserModel) Update(user *User) error {
 	return nil
 }
 
+func (u UserModel) UpdatePassword(user *User, revokeScopes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		UPDATE users
+		SET password_hash = $1, version = version + 1
+		WHERE id = $2 and version = $3
+		RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, user.Password.hash, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope = ANY($2)`
+
+	if _, err = tx.ExecContext(ctx, query, user.ID, revokeScopes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	query := `
 		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
@@ -244,7 +286,7 @@ type UserInMemRepo struct {
 	mu          sync.RWMutex
 	idCounter   int64
 	users       map[int64]*User
-	tokens      TokenReader
+	tokens      TokenRepository
 	permissions PermissionRepository
 	clock       Clock
 }
@@ -316,6 +358,19 @@ func (m *UserInMemRepo) Update(user *User) error {
 	return nil
 }
 
+func (m *UserInMemRepo) UpdatePassword(user *User, revokeScopes ...string) error {
+	if err := m.Update(user); err != nil {
+		return err
+	}
+
+	for _, scope := range revokeScopes {
+		if err := m.tokens.DeleteAllForUser(scope, user.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *UserInMemRepo) GetForToken(scope, tokenPlaintext string) (*User, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -42,6 +42,17 @@ func TestUserInMem(t *testing.T) {
 
 	_, err = users.GetForToken(data.ScopeActivation, "abcde")
 	assertions.AssertNotFoundError(t, err)
+
+	reset, err := tokens.New(alice.ID, time.Minute, data.ScopePasswordReset)
+	assertions.AssertNoError(t, err)
+	assertions.AssertNoError(t, alice.Password.Set("n3wpa55word"))
+	err = users.UpdatePassword(alice, data.ScopePasswordReset)
+	assertions.AssertNoError(t, err)
+
+	_, err = users.GetForToken(data.ScopePasswordReset, reset.Plaintext)
+	assertions.AssertNotFoundError(t, err)
+	_, err = users.GetForToken(data.ScopeActivation, tkn.Plaintext)
+	assertions.AssertNoError(t, err)
 }
 
 func newUser(name, email, plainPassword string) (*data.User, error) {
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+type WatchedRepository interface {
+	// Insert logs the movie as watched. Zero WatchedAt is set to the current time.
+	Insert(userID int64, entry *WatchedEntry) error
+	Delete(userID, id int64) error
+	// GetAll returns watched log of the user skipping movies in the trash
+	GetAll(userID int64, filters Filters) ([]*WatchedEntry, Metadata, error)
+}
+
+// WatchedEntry records a single viewing of the movie. The same movie may be
+// logged any number of times.
+type WatchedEntry struct {
+	ID        int64     `json:"id"`
+	Movie     *Movie    `json:"movie"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+func ValidateWatchedEntry(v *validator.Validator, entry *WatchedEntry) {
+	if !entry.WatchedAt.IsZero() {
+		v.Check(entry.WatchedAt.Year() >= 1888, "watched_at", "must be greater than 1888")
+		v.Check(!entry.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+	}
+}
+
+type WatchedModel struct {
+	DB *sql.DB
+}
+
+func (m WatchedModel) Insert(userID int64, entry *WatchedEntry) error {
+	query := `
+		INSERT INTO watched (user_id, movie_id, watched_at)
+		VALUES ($1, $2, COALESCE($3, NOW()))
+		RETURNING id, watched_at`
+
+	var watchedAt *time.Time
+	if !entry.WatchedAt.IsZero() {
+		watchedAt = &entry.WatchedAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, entry.Movie.ID, watchedAt).Scan(&entry.ID, &entry.WatchedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m WatchedModel) Delete(userID, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "DELETE FROM watched WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m WatchedModel) GetAll(userID int64, filters Filters) (entries []*WatchedEntry, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), w.id, w.watched_at,
+			m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version, m.rating, m.rating_count, m.poster_key,
+			%s
+		FROM watched w
+		INNER JOIN movies m ON m.id = w.movie_id
+		WHERE w.user_id = $1 AND m.deleted_at IS NULL
+		ORDER BY %s %s, w.id ASC
+		LIMIT $2 OFFSET $3`, externalIDsColumn("m"), filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	entries = []*WatchedEntry{}
+	totalRecords := 0
+	for rows.Next() {
+		var movie Movie
+		entry := WatchedEntry{Movie: &movie}
+
+		err = rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.WatchedAt,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			&movie.Genres,
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.ExternalIDs,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return entries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+type watchedItem struct {
+	id        int64
+	movieID   int64
+	watchedAt time.Time
+}
+
+type WatchedInMemRepo struct {
+	mu        sync.RWMutex
+	idCounter int64
+	watched   map[int64][]watchedItem
+	movies    MovieReader
+	clock     Clock
+}
+
+func NewWatchedInMemRepo(movies MovieReader) *WatchedInMemRepo {
+	return &WatchedInMemRepo{
+		idCounter: 1,
+		watched:   make(map[int64][]watchedItem),
+		movies:    movies,
+		clock:     MockClock{},
+	}
+}
+
+func (m *WatchedInMemRepo) Insert(userID int64, entry *WatchedEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry.WatchedAt.IsZero() {
+		entry.WatchedAt = m.clock.Now()
+	}
+	entry.ID = m.idCounter
+	m.idCounter++
+
+	m.watched[userID] = append(m.watched[userID], watchedItem{
+		id:        entry.ID,
+		movieID:   entry.Movie.ID,
+		watchedAt: entry.WatchedAt,
+	})
+	return nil
+}
+
+func (m *WatchedInMemRepo) Delete(userID, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.watched[userID], func(item watchedItem) bool {
+		return item.id == id
+	})
+	if i == -1 {
+		return ErrRecordNotFound
+	}
+
+	m.watched[userID] = slices.Delete(m.watched[userID], i, i+1)
+	return nil
+}
+
+func (m *WatchedInMemRepo) GetAll(userID int64, filters Filters) ([]*WatchedEntry, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]*WatchedEntry, 0, len(m.watched[userID]))
+	for _, item := range m.watched[userID] {
+		movie, err := m.movies.GetByID(item.movieID)
+		if err != nil {
+			if errors.Is(err, ErrRecordNotFound) {
+				continue
+			}
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &WatchedEntry{ID: item.id, Movie: movie, WatchedAt: item.watchedAt})
+	}
+
+	slices.SortFunc(entries, func(a, b *WatchedEntry) int {
+		var c int
+		switch filters.sortColumn() {
+		case "watched_at":
+			c = a.WatchedAt.Compare(b.WatchedAt)
+		case "title":
+			c = strings.Compare(a.Movie.Title, b.Movie.Title)
+		case "year":
+			c = cmp.Compare(a.Movie.Year, b.Movie.Year)
+		}
+		if filters.sortDirection() == "DESC" {
+			c = -c
+		}
+		return cmp.Or(c, cmp.Compare(a.ID, b.ID))
+	})
+
+	totalRecords := len(entries)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return entries[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
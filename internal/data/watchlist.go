@@ -0,0 +1,229 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrAlreadyInWatchlist = errors.New("movie already in watchlist")
+
+type WatchlistRepository interface {
+	// Add returns ErrAlreadyInWatchlist if the movie is already in user's watchlist
+	Add(userID int64, movie *Movie) (*WatchlistEntry, error)
+	Remove(userID, movieID int64) error
+	// GetAll returns watchlist entries of the user skipping movies in the trash
+	GetAll(userID int64, filters Filters) ([]*WatchlistEntry, Metadata, error)
+}
+
+// WatchlistEntry is a movie the user is going to watch
+type WatchlistEntry struct {
+	Movie   *Movie    `json:"movie"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+func (m WatchlistModel) Add(userID int64, movie *Movie) (*WatchlistEntry, error) {
+	query := `
+		INSERT INTO watchlist (user_id, movie_id)
+		VALUES ($1, $2)
+		RETURNING added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	entry := &WatchlistEntry{Movie: movie}
+	if err := m.DB.QueryRowContext(ctx, query, userID, movie.ID).Scan(&entry.AddedAt); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return nil, ErrAlreadyInWatchlist
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+func (m WatchlistModel) Remove(userID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "DELETE FROM watchlist WHERE user_id = $1 AND movie_id = $2", userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m WatchlistModel) GetAll(userID int64, filters Filters) (entries []*WatchlistEntry, metadata Metadata, err error) {
+	// #nosec G201 -- filters validated in handler
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), w.added_at,
+			m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version, m.rating, m.rating_count, m.poster_key,
+			%s
+		FROM watchlist w
+		INNER JOIN movies m ON m.id = w.movie_id
+		WHERE w.user_id = $1 AND m.deleted_at IS NULL
+		ORDER BY %s %s, m.id ASC
+		LIMIT $2 OFFSET $3`, externalIDsColumn("m"), filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	entries = []*WatchlistEntry{}
+	totalRecords := 0
+	for rows.Next() {
+		var movie Movie
+		entry := WatchlistEntry{Movie: &movie}
+
+		err = rows.Scan(
+			&totalRecords,
+			&entry.AddedAt,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			&movie.Genres,
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.ExternalIDs,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return entries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+type watchlistItem struct {
+	movieID int64
+	addedAt time.Time
+}
+
+type WatchlistInMemRepo struct {
+	mu        sync.RWMutex
+	watchlist map[int64][]watchlistItem
+	movies    MovieReader
+	clock     Clock
+}
+
+func NewWatchlistInMemRepo(movies MovieReader) *WatchlistInMemRepo {
+	return &WatchlistInMemRepo{
+		watchlist: make(map[int64][]watchlistItem),
+		movies:    movies,
+		clock:     MockClock{},
+	}
+}
+
+func (m *WatchlistInMemRepo) Add(userID int64, movie *Movie) (*WatchlistEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if slices.ContainsFunc(m.watchlist[userID], func(item watchlistItem) bool {
+		return item.movieID == movie.ID
+	}) {
+		return nil, ErrAlreadyInWatchlist
+	}
+
+	item := watchlistItem{movieID: movie.ID, addedAt: m.clock.Now()}
+	m.watchlist[userID] = append(m.watchlist[userID], item)
+
+	return &WatchlistEntry{Movie: movie, AddedAt: item.addedAt}, nil
+}
+
+func (m *WatchlistInMemRepo) Remove(userID, movieID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.watchlist[userID], func(item watchlistItem) bool {
+		return item.movieID == movieID
+	})
+	if i == -1 {
+		return ErrRecordNotFound
+	}
+
+	m.watchlist[userID] = slices.Delete(m.watchlist[userID], i, i+1)
+	return nil
+}
+
+func (m *WatchlistInMemRepo) GetAll(userID int64, filters Filters) ([]*WatchlistEntry, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]*WatchlistEntry, 0, len(m.watchlist[userID]))
+	for _, item := range m.watchlist[userID] {
+		movie, err := m.movies.GetByID(item.movieID)
+		if err != nil {
+			if errors.Is(err, ErrRecordNotFound) {
+				continue
+			}
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &WatchlistEntry{Movie: movie, AddedAt: item.addedAt})
+	}
+
+	slices.SortFunc(entries, func(a, b *WatchlistEntry) int {
+		var c int
+		switch filters.sortColumn() {
+		case "added_at":
+			c = a.AddedAt.Compare(b.AddedAt)
+		case "title":
+			c = strings.Compare(a.Movie.Title, b.Movie.Title)
+		case "year":
+			c = cmp.Compare(a.Movie.Year, b.Movie.Year)
+		}
+		if filters.sortDirection() == "DESC" {
+			c = -c
+		}
+		return cmp.Or(c, cmp.Compare(a.Movie.ID, b.Movie.ID))
+	})
+
+	totalRecords := len(entries)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return entries[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,856 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/validator"
+)
+
+const (
+	EventMovieCreated  = "movie.created"
+	EventMovieUpdated  = "movie.updated"
+	EventMovieDeleted  = "movie.deleted"
+	EventUserActivated = "user.activated"
+	// EventPing is only sent as a test event and can't be subscribed to
+	EventPing = "ping"
+
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead is the state of deliveries which ran out of attempts. They're
+	// kept for inspection and may be retried manually.
+	DeliveryDead = "dead"
+
+	// WebhookMaxAttempts is the number of attempts made before a delivery is dead
+	WebhookMaxAttempts = 10
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = 6 * time.Hour
+)
+
+// WebhookEvents are event types webhooks can subscribe to
+var WebhookEvents = []string{EventMovieCreated, EventMovieUpdated, EventMovieDeleted, EventUserActivated}
+
+type WebhookRepository interface {
+	Insert(webhook *Webhook) error
+	Get(id int64) (*Webhook, error)
+	GetAll(filters Filters) ([]*Webhook, Metadata, error)
+	// GetSubscribed returns active webhooks subscribed to the event type
+	GetSubscribed(eventType string) ([]*Webhook, error)
+	Update(webhook *Webhook) error
+	Delete(id int64) error
+}
+
+type WebhookDeliveryRepository interface {
+	Insert(deliveries ...*WebhookDelivery) error
+	Get(webhookID, id int64) (*WebhookDelivery, error)
+	// GetAllForWebhook returns deliveries of the webhook, optionally only
+	// the ones with the given status
+	GetAllForWebhook(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error)
+	// ClaimDue returns up to limit pending deliveries due at the given time.
+	// Claimed deliveries aren't due again until the lease expires, so that
+	// deliveries of crashed senders are eventually retried.
+	ClaimDue(now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error)
+	// Update saves the outcome of the latest delivery attempt
+	Update(delivery *WebhookDelivery) error
+	// MovieChangesCursor returns id of the movie change up to which events
+	// were enqueued
+	MovieChangesCursor() (int64, error)
+	// InsertForMovieChanges inserts deliveries of events about movie changes
+	// logged after the change prevID up to lastID and moves the cursor to
+	// lastID. It returns ErrEditConflict if the cursor was moved meanwhile.
+	InsertForMovieChanges(prevID, lastID int64, deliveries ...*WebhookDelivery) error
+}
+
+// Webhook is a subscription of an URL to events. Payloads are signed with the
+// secret which is only shown once the webhook is created.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Version   int32     `json:"version"`
+}
+
+// Subscribed reports whether the webhook is active and receives events of the type
+func (w *Webhook) Subscribed(eventType string) bool {
+	return w.Active && slices.Contains(w.Events, eventType)
+}
+
+// NewWebhookSecret returns a random secret payloads are signed with
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhookPayload returns the signature of the payload sent at the given
+// time in "t=<unix time>,v1=<hex HMAC-SHA256>" format. The HMAC covers the
+// time and the payload joined with a dot, so receivers can reject replays.
+func SignWebhookPayload(secret string, t time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+	if webhook.URL != "" {
+		u, err := url.Parse(webhook.URL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	}
+
+	v.Check(webhook.Events != nil, "events", "must be provided")
+	v.Check(len(webhook.Events) >= 1, "events", "must contain at least 1 event")
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+	for _, event := range webhook.Events {
+		v.Check(validator.PermittedValue(event, WebhookEvents...), "events", "must only contain "+strings.Join(WebhookEvents, ", "))
+	}
+}
+
+// WebhookDelivery is an event queued for delivery to a webhook along with the
+// outcome of the latest attempt
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int64  `json:"webhook_id"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Payload is the request body, signatures are computed over these exact bytes
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// RecordAttempt updates the delivery with the outcome of the attempt made at
+// the given time. Zero status means no response was received. Failed deliveries
+// are retried with exponential backoff until they run out of attempts.
+func (d *WebhookDelivery) RecordAttempt(at time.Time, status int, err error) {
+	d.Attempts++
+	d.ResponseStatus = status
+
+	if err == nil && status >= 200 && status < 300 {
+		d.Status = DeliverySucceeded
+		d.LastError = ""
+		d.DeliveredAt = &at
+		return
+	}
+
+	switch {
+	case err != nil:
+		d.LastError = err.Error()
+	default:
+		d.LastError = fmt.Sprintf("unexpected response status %d", status)
+	}
+
+	if d.Attempts >= WebhookMaxAttempts {
+		d.Status = DeliveryDead
+		return
+	}
+
+	d.Status = DeliveryPending
+	d.NextAttemptAt = at.Add(min(webhookRetryBase<<(d.Attempts-1), webhookRetryMax))
+}
+
+// Abandon makes the delivery dead without an attempt
+func (d *WebhookDelivery) Abandon(reason string) {
+	d.Status = DeliveryDead
+	d.LastError = reason
+}
+
+// Retry queues the dead delivery again with a fresh set of attempts
+func (d *WebhookDelivery) Retry(at time.Time) {
+	d.Status = DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = at
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (url, secret, events, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	args := []any{webhook.URL, webhook.Secret, Genres(webhook.Events), webhook.Active}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Version)
+}
+
+const webhookColumns = "id, created_at, url, secret, events, active, version"
+
+func scanWebhook(row rowScanner, webhook *Webhook, dest ...any) error {
+	return row.Scan(append(dest,
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.URL,
+		&webhook.Secret,
+		(*Genres)(&webhook.Events),
+		&webhook.Active,
+		&webhook.Version,
+	)...)
+}
+
+func (m WebhookModel) Get(id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+	if err := scanWebhook(m.DB.QueryRowContext(ctx, query, id), &webhook); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+func (m WebhookModel) GetAll(filters Filters) (webhooks []*Webhook, metadata Metadata, err error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + webhookColumns + `
+		FROM webhooks
+		ORDER BY id
+		LIMIT $1 OFFSET $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	webhooks = []*Webhook{}
+	totalRecords := 0
+	for rows.Next() {
+		var webhook Webhook
+		if err = scanWebhook(rows, &webhook, &totalRecords); err != nil {
+			return nil, Metadata{}, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return webhooks, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m WebhookModel) GetSubscribed(eventType string) (webhooks []*Webhook, err error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE active AND events @> ARRAY[$1::text]
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, eventType)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	webhooks = []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		if err = scanWebhook(rows, &webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, active = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+
+	args := []any{webhook.URL, Genres(webhook.Events), webhook.Active, webhook.ID, webhook.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m WebhookModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type WebhookDeliveryModel struct {
+	DB *sql.DB
+}
+
+func (m WebhookDeliveryModel) Insert(deliveries ...*WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = insertWebhookDeliveries(ctx, tx, deliveries); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertWebhookDeliveries(ctx context.Context, tx *sql.Tx, deliveries []*WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, next_attempt_at, created_at`
+
+	for _, d := range deliveries {
+		err := tx.QueryRowContext(ctx, query, d.WebhookID, d.EventID, d.EventType, []byte(d.Payload)).Scan(
+			&d.ID,
+			&d.Status,
+			&d.NextAttemptAt,
+			&d.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m WebhookDeliveryModel) MovieChangesCursor() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, "SELECT change_id FROM webhook_movie_changes_cursor").Scan(&id)
+	return id, err
+}
+
+func (m WebhookDeliveryModel) InsertForMovieChanges(prevID, lastID int64, deliveries ...*WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE webhook_movie_changes_cursor
+		SET change_id = $2
+		WHERE change_id = $1`, prevID, lastID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	if err = insertWebhookDeliveries(ctx, tx, deliveries); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_error, response_status, created_at, delivered_at`
+
+func scanWebhookDelivery(row rowScanner, d *WebhookDelivery, dest ...any) error {
+	var payload []byte
+	err := row.Scan(append(dest,
+		&d.ID,
+		&d.WebhookID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastError,
+		&d.ResponseStatus,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	)...)
+	d.Payload = payload
+	return err
+}
+
+func (m WebhookDeliveryModel) Get(webhookID, id int64) (*WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var d WebhookDelivery
+	if err := scanWebhookDelivery(m.DB.QueryRowContext(ctx, query, id, webhookID), &d); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+func (m WebhookDeliveryModel) GetAllForWebhook(webhookID int64, status string, filters Filters) (deliveries []*WebhookDelivery, metadata Metadata, err error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	deliveries = []*WebhookDelivery{}
+	totalRecords := 0
+	for rows.Next() {
+		var d WebhookDelivery
+		if err = scanWebhookDelivery(rows, &d, &totalRecords); err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return deliveries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m WebhookDeliveryModel) ClaimDue(now time.Time, lease time.Duration, limit int) (deliveries []*WebhookDelivery, err error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+
+	deliveries = []*WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err = scanWebhookDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (m WebhookDeliveryModel) Update(d *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4,
+			response_status = $5, delivered_at = $6
+		WHERE id = $7`
+
+	args := []any{d.Status, d.Attempts, d.NextAttemptAt, d.LastError, d.ResponseStatus, d.DeliveredAt, d.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type WebhookInMemRepo struct {
+	mu        sync.RWMutex
+	idCounter int64
+	webhooks  map[int64]*Webhook
+	clock     Clock
+	// deliveries of deleted webhooks are deleted along with them
+	deliveries *WebhookDeliveryInMemRepo
+}
+
+func NewWebhookInMemRepo(deliveries *WebhookDeliveryInMemRepo) *WebhookInMemRepo {
+	return &WebhookInMemRepo{
+		idCounter:  1,
+		webhooks:   make(map[int64]*Webhook),
+		clock:      MockClock{},
+		deliveries: deliveries,
+	}
+}
+
+func (m *WebhookInMemRepo) Insert(webhook *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook.ID = m.idCounter
+	webhook.CreatedAt = m.clock.Now()
+	webhook.Version = 1
+	m.idCounter++
+
+	stored := *webhook
+	stored.Events = slices.Clone(webhook.Events)
+	m.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (m *WebhookInMemRepo) Get(id int64) (*Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhook, ok := m.webhooks[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	w := *webhook
+	return &w, nil
+}
+
+func (m *WebhookInMemRepo) sorted() []*Webhook {
+	webhooks := make([]*Webhook, 0, len(m.webhooks))
+	for _, webhook := range m.webhooks {
+		w := *webhook
+		webhooks = append(webhooks, &w)
+	}
+	slices.SortFunc(webhooks, func(a, b *Webhook) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return webhooks
+}
+
+func (m *WebhookInMemRepo) GetAll(filters Filters) ([]*Webhook, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := m.sorted()
+
+	totalRecords := len(webhooks)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return webhooks[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *WebhookInMemRepo) GetSubscribed(eventType string) ([]*Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := slices.DeleteFunc(m.sorted(), func(w *Webhook) bool {
+		return !w.Subscribed(eventType)
+	})
+	return webhooks, nil
+}
+
+func (m *WebhookInMemRepo) Update(webhook *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.webhooks[webhook.ID]
+	if !ok || stored.Version != webhook.Version {
+		return ErrEditConflict
+	}
+
+	webhook.Version++
+	updated := *webhook
+	updated.Secret = stored.Secret
+	updated.Events = slices.Clone(webhook.Events)
+	m.webhooks[webhook.ID] = &updated
+	return nil
+}
+
+func (m *WebhookInMemRepo) Delete(id int64) error {
+	m.mu.Lock()
+	if _, ok := m.webhooks[id]; !ok {
+		m.mu.Unlock()
+		return ErrRecordNotFound
+	}
+	delete(m.webhooks, id)
+	m.mu.Unlock()
+
+	if m.deliveries != nil {
+		m.deliveries.deleteForWebhook(id)
+	}
+	return nil
+}
+
+type WebhookDeliveryInMemRepo struct {
+	mu         sync.RWMutex
+	idCounter  int64
+	deliveries map[int64]*WebhookDelivery
+	clock      Clock
+	// changeCursor is id of the movie change up to which events were enqueued
+	changeCursor int64
+}
+
+func NewWebhookDeliveryInMemRepo() *WebhookDeliveryInMemRepo {
+	return &WebhookDeliveryInMemRepo{
+		idCounter:  1,
+		deliveries: make(map[int64]*WebhookDelivery),
+		clock:      MockClock{},
+	}
+}
+
+func (m *WebhookDeliveryInMemRepo) Insert(deliveries ...*WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insert(deliveries)
+	return nil
+}
+
+func (m *WebhookDeliveryInMemRepo) insert(deliveries []*WebhookDelivery) {
+	for _, d := range deliveries {
+		d.ID = m.idCounter
+		d.Status = DeliveryPending
+		d.CreatedAt = m.clock.Now()
+		// Unlike creation times, due times are compared with the real clock
+		d.NextAttemptAt = time.Now()
+		m.idCounter++
+
+		stored := *d
+		m.deliveries[d.ID] = &stored
+	}
+}
+
+func (m *WebhookDeliveryInMemRepo) MovieChangesCursor() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.changeCursor, nil
+}
+
+func (m *WebhookDeliveryInMemRepo) InsertForMovieChanges(prevID, lastID int64, deliveries ...*WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.changeCursor != prevID {
+		return ErrEditConflict
+	}
+
+	m.changeCursor = lastID
+	m.insert(deliveries)
+	return nil
+}
+
+func (m *WebhookDeliveryInMemRepo) Get(webhookID, id int64) (*WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.deliveries[id]
+	if !ok || d.WebhookID != webhookID {
+		return nil, ErrRecordNotFound
+	}
+
+	delivery := *d
+	return &delivery, nil
+}
+
+func (m *WebhookDeliveryInMemRepo) GetAllForWebhook(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := make([]*WebhookDelivery, 0)
+	for _, d := range m.deliveries {
+		if d.WebhookID == webhookID && (status == "" || d.Status == status) {
+			delivery := *d
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	slices.SortFunc(deliveries, func(a, b *WebhookDelivery) int {
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	totalRecords := len(deliveries)
+	off := min(filters.offset(), totalRecords)
+	end := min(off+filters.limit(), totalRecords)
+
+	return deliveries[off:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *WebhookDeliveryInMemRepo) ClaimDue(now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]*WebhookDelivery, 0)
+	for _, d := range m.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	slices.SortFunc(due, func(a, b *WebhookDelivery) int {
+		return cmp.Or(a.NextAttemptAt.Compare(b.NextAttemptAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	claimed := make([]*WebhookDelivery, 0, min(len(due), limit))
+	for _, d := range due[:min(len(due), limit)] {
+		d.NextAttemptAt = now.Add(lease)
+		delivery := *d
+		claimed = append(claimed, &delivery)
+	}
+	return claimed, nil
+}
+
+func (m *WebhookDeliveryInMemRepo) Update(d *WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	stored := *d
+	m.deliveries[d.ID] = &stored
+	return nil
+}
+
+// deleteForWebhook deletes deliveries of the deleted webhook
+func (m *WebhookDeliveryInMemRepo) deleteForWebhook(webhookID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, d := range m.deliveries {
+		if d.WebhookID == webhookID {
+			delete(m.deliveries, id)
+		}
+	}
+}
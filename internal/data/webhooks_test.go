@@ -0,0 +1,70 @@
+package data_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shrtyk/greenlight/internal/data"
+)
+
+func TestWebhookDeliveryRecordAttempt(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("backoff", func(t *testing.T) {
+		d := &data.WebhookDelivery{Status: data.DeliveryPending}
+
+		delays := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+		for _, delay := range delays {
+			d.RecordAttempt(start, http.StatusBadGateway, nil)
+
+			if d.Status != data.DeliveryPending {
+				t.Fatalf("got status %q, wanted %q", d.Status, data.DeliveryPending)
+			}
+			if got := d.NextAttemptAt.Sub(start); got != delay {
+				t.Errorf("got delay %v after %d attempts, wanted %v", got, d.Attempts, delay)
+			}
+		}
+	})
+
+	t.Run("dead after max attempts", func(t *testing.T) {
+		d := &data.WebhookDelivery{Status: data.DeliveryPending}
+
+		for range data.WebhookMaxAttempts {
+			d.RecordAttempt(start, 0, errors.New("connection refused"))
+		}
+
+		if d.Status != data.DeliveryDead {
+			t.Errorf("got status %q, wanted %q", d.Status, data.DeliveryDead)
+		}
+		if d.LastError != "connection refused" {
+			t.Errorf("got last error %q, wanted %q", d.LastError, "connection refused")
+		}
+	})
+
+	t.Run("succeeded", func(t *testing.T) {
+		d := &data.WebhookDelivery{Status: data.DeliveryPending, LastError: "timeout"}
+
+		d.RecordAttempt(start, http.StatusOK, nil)
+
+		if d.Status != data.DeliverySucceeded {
+			t.Errorf("got status %q, wanted %q", d.Status, data.DeliverySucceeded)
+		}
+		if d.DeliveredAt == nil || !d.DeliveredAt.Equal(start) {
+			t.Errorf("got delivered at %v, wanted %v", d.DeliveredAt, start)
+		}
+		if d.LastError != "" {
+			t.Errorf("got last error %q, wanted none", d.LastError)
+		}
+	})
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	got := data.SignWebhookPayload("secret", time.Unix(1700000000, 0), []byte(`{"id":1}`))
+	want := "t=1700000000,v1=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"
+
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+}
@@ -18,8 +18,9 @@ type MailWriter interface {
 }
 
 type MailData struct {
-	UserName        string `json:"userName"`
-	ActivationToken string `json:"activationToken"`
+	UserName           string `json:"userName"`
+	ActivationToken    string `json:"activationToken"`
+	PasswordResetToken string `json:"passwordResetToken"`
 }
 
 type Mailer struct {
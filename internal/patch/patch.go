@@ -0,0 +1,299 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to JSON values decoded into maps, slices and scalars.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidOperation = errors.New("invalid operation")
+	ErrInvalidPointer   = errors.New("invalid JSON pointer")
+	ErrPathNotFound     = errors.New("path not found")
+	ErrTestFailed       = errors.New("test failed")
+)
+
+// Operation is a single JSON Patch operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// OperationError reports which operation of the patch failed and why
+type OperationError struct {
+	Index int
+	Op    Operation
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op.Op, e.Op.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// MergePatch applies the merge patch to the target. Objects of the patch are
+// merged into the target recursively, nulls remove members and any other value
+// replaces the target one. The target may be modified.
+func MergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = MergePatch(t[key], value)
+		}
+	}
+	return t
+}
+
+// Apply applies the operations to the document in order stopping at the first
+// failing one, which is reported as *OperationError. The document may be
+// modified even if the patch fails.
+func Apply(doc any, ops []Operation) (any, error) {
+	for i, op := range ops {
+		var err error
+		if doc, err = apply(doc, op); err != nil {
+			return nil, &OperationError{Index: i, Op: op, Err: err}
+		}
+	}
+	return doc, nil
+}
+
+func apply(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: value must be provided", ErrInvalidOperation)
+		}
+		var value any
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidOperation, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			return add(doc, path, deepCopy(value))
+		}
+
+		if len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+			return nil, fmt.Errorf("%w: value can't be moved into itself", ErrInvalidOperation)
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidOperation, op.Op)
+	}
+}
+
+// parsePointer splits the JSON pointer (RFC 6901) into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q must start with /", ErrInvalidPointer, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		var err error
+		if doc, err = child(doc, token); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	return update(doc, path, value, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			if token == "-" {
+				return append(c, value), nil
+			}
+			i, err := index(token, len(c)+1)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(c, i, value), nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+func replace(doc any, path []string, value any) (any, error) {
+	return update(doc, path, value, func(container any, token string) (any, error) {
+		if _, err := child(container, token); err != nil {
+			return nil, err
+		}
+		return set(container, token, value), nil
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: the whole document can't be removed", ErrInvalidOperation)
+	}
+
+	return update(doc, path, nil, func(container any, token string) (any, error) {
+		if _, err := child(container, token); err != nil {
+			return nil, err
+		}
+		switch c := container.(type) {
+		case map[string]any:
+			delete(c, token)
+			return c, nil
+		default:
+			i, _ := index(token, len(c.([]any)))
+			return slices.Delete(c.([]any), i, i+1), nil
+		}
+	})
+}
+
+// update rebuilds containers along the path with fn changing the last one.
+// Empty path replaces the whole document with the value.
+func update(doc any, path []string, value any, fn func(container any, token string) (any, error)) (any, error) {
+	switch len(path) {
+	case 0:
+		return value, nil
+	case 1:
+		return fn(doc, path[0])
+	}
+
+	c, err := child(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if c, err = update(c, path[1:], value, fn); err != nil {
+		return nil, err
+	}
+	return set(doc, path[0], c), nil
+}
+
+// child returns the member or the element of the container referenced by token
+func child(container any, token string) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		value, ok := c[token]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		return value, nil
+	case []any:
+		i, err := index(token, len(c))
+		if err != nil {
+			return nil, err
+		}
+		return c[i], nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// set stores the value at the existing member or element of the container
+func set(container any, token string, value any) any {
+	switch c := container.(type) {
+	case map[string]any:
+		c[token] = value
+	case []any:
+		i, _ := index(token, len(c))
+		c[i] = value
+	}
+	return container
+}
+
+// index parses the array index token which must be less than n
+func index(token string, n int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrPathNotFound
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= n {
+		return 0, ErrPathNotFound
+	}
+	return i, nil
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for key, member := range v {
+			c[key] = deepCopy(member)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, element := range v {
+			c[i] = deepCopy(element)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,208 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/shrtyk/greenlight/internal/patch"
+	"github.com/shrtyk/greenlight/internal/testutils/assertions"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+
+	var v any
+	assertions.AssertNoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func encode(t *testing.T, v any) string {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	assertions.AssertNoError(t, err)
+	return string(b)
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples of RFC 7396 Appendix A
+	cases := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target+" "+c.patch, func(t *testing.T) {
+			got := patch.MergePatch(decode(t, c.target), decode(t, c.patch))
+			assertions.AssertStrings(t, encode(t, got), c.want)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name string
+		doc  string
+		ops  string
+		want string
+		err  error
+	}{
+		{
+			name: "add member",
+			doc:  `{"foo":"bar"}`,
+			ops:  `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want: `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name: "add array element",
+			doc:  `{"foo":["bar","baz"]}`,
+			ops:  `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name: "append array element",
+			doc:  `{"foo":["bar"]}`,
+			ops:  `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want: `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name: "add out of bounds",
+			doc:  `{"foo":["bar"]}`,
+			ops:  `[{"op":"add","path":"/foo/2","value":"qux"}]`,
+			err:  patch.ErrPathNotFound,
+		},
+		{
+			name: "add to missing parent",
+			doc:  `{"foo":"bar"}`,
+			ops:  `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			err:  patch.ErrPathNotFound,
+		},
+		{
+			name: "remove array element",
+			doc:  `{"foo":["bar","qux","baz"]}`,
+			ops:  `[{"op":"remove","path":"/foo/1"}]`,
+			want: `{"foo":["bar","baz"]}`,
+		},
+		{
+			name: "remove missing member",
+			doc:  `{"foo":"bar"}`,
+			ops:  `[{"op":"remove","path":"/baz"}]`,
+			err:  patch.ErrPathNotFound,
+		},
+		{
+			name: "replace",
+			doc:  `{"baz":"qux","foo":"bar"}`,
+			ops:  `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name: "move member",
+			doc:  `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			ops:  `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name: "move array element",
+			doc:  `{"foo":["all","grass","cows","eat"]}`,
+			ops:  `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want: `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name: "move into itself",
+			doc:  `{"foo":{"bar":1}}`,
+			ops:  `[{"op":"move","from":"/foo","path":"/foo/bar"}]`,
+			err:  patch.ErrInvalidOperation,
+		},
+		{
+			name: "copy",
+			doc:  `{"foo":{"bar":1}}`,
+			ops:  `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`,
+			want: `{"baz":{"bar":2},"foo":{"bar":1}}`,
+		},
+		{
+			name: "test",
+			doc:  `{"baz":"qux","foo":["a",2,"c"]}`,
+			ops:  `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			want: `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name: "failed test",
+			doc:  `{"baz":"qux"}`,
+			ops:  `[{"op":"test","path":"/baz","value":"bar"}]`,
+			err:  patch.ErrTestFailed,
+		},
+		{
+			name: "escaped pointer",
+			doc:  `{"a/b":1,"m~n":2}`,
+			ops:  `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`,
+			want: `{"a/b":1}`,
+		},
+		{
+			name: "null value",
+			doc:  `{"foo":1}`,
+			ops:  `[{"op":"replace","path":"/foo","value":null}]`,
+			want: `{"foo":null}`,
+		},
+		{
+			name: "missing value",
+			doc:  `{"foo":1}`,
+			ops:  `[{"op":"replace","path":"/foo"}]`,
+			err:  patch.ErrInvalidOperation,
+		},
+		{
+			name: "unknown op",
+			doc:  `{"foo":1}`,
+			ops:  `[{"op":"increment","path":"/foo"}]`,
+			err:  patch.ErrInvalidOperation,
+		},
+		{
+			name: "invalid pointer",
+			doc:  `{"foo":1}`,
+			ops:  `[{"op":"remove","path":"foo"}]`,
+			err:  patch.ErrInvalidPointer,
+		},
+		{
+			name: "leading zero index",
+			doc:  `{"foo":[1,2]}`,
+			ops:  `[{"op":"remove","path":"/foo/01"}]`,
+			err:  patch.ErrPathNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ops []patch.Operation
+			assertions.AssertNoError(t, json.Unmarshal([]byte(c.ops), &ops))
+
+			got, err := patch.Apply(decode(t, c.doc), ops)
+			if c.err != nil {
+				var opErr *patch.OperationError
+				if !errors.Is(err, c.err) || !errors.As(err, &opErr) {
+					t.Fatalf("got error %v, want %v", err, c.err)
+				}
+				return
+			}
+
+			assertions.AssertNoError(t, err)
+			assertions.AssertStrings(t, encode(t, got), c.want)
+		})
+	}
+}
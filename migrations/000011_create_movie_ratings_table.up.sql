@@ -0,0 +1,17 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_sum bigint NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating double precision GENERATED ALWAYS AS (
+    CASE WHEN rating_count = 0 THEN 0 ELSE round(rating_sum::numeric / rating_count, 2)::double precision END
+) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_rating_idx ON movies (rating, id);
+
+CREATE TABLE IF NOT EXISTS movie_ratings (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 10),
+    review text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, user_id)
+);
@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS genres (
+    slug text PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+INSERT INTO genres (slug, name, aliases)
+VALUES
+    ('action', 'Action', '{}'),
+    ('adventure', 'Adventure', '{}'),
+    ('animation', 'Animation', '{"animated"}'),
+    ('biography', 'Biography', '{"biopic"}'),
+    ('comedy', 'Comedy', '{}'),
+    ('crime', 'Crime', '{}'),
+    ('documentary', 'Documentary', '{}'),
+    ('drama', 'Drama', '{}'),
+    ('family', 'Family', '{}'),
+    ('fantasy', 'Fantasy', '{}'),
+    ('history', 'History', '{"historical"}'),
+    ('horror', 'Horror', '{}'),
+    ('music', 'Music', '{}'),
+    ('musical', 'Musical', '{}'),
+    ('mystery', 'Mystery', '{}'),
+    ('romance', 'Romance', '{"romantic"}'),
+    ('sci-fi', 'Science Fiction', '{"science fiction", "scifi", "sf"}'),
+    ('sport', 'Sport', '{"sports"}'),
+    ('thriller', 'Thriller', '{}'),
+    ('war', 'War', '{}'),
+    ('western', 'Western', '{}')
+ON CONFLICT DO NOTHING;
+
+-- Existing free-text genres are rewritten to slugs of matching genres keeping
+-- their order. Genres without a match are slugified and added to the taxonomy.
+UPDATE movies SET genres = ARRAY(
+    SELECT slug
+    FROM (
+        SELECT COALESCE(
+            (SELECT gr.slug FROM genres gr WHERE gr.slug = lower(g) OR lower(g) = ANY(gr.aliases)),
+            trim(BOTH '-' FROM regexp_replace(lower(g), '[^a-z0-9]+', '-', 'g'))
+        ) AS slug, i
+        FROM unnest(genres) WITH ORDINALITY AS t(g, i)
+    ) s
+    GROUP BY slug
+    ORDER BY MIN(i)
+);
+
+INSERT INTO genres (slug, name)
+SELECT DISTINCT g, initcap(replace(g, '-', ' '))
+FROM movies, unnest(genres) AS g
+ON CONFLICT DO NOTHING;
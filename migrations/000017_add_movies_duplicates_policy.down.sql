@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS movie_redirects;
+DROP INDEX IF EXISTS movies_title_key_year_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS title_key;
@@ -0,0 +1,26 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS title_key text GENERATED ALWAYS AS (
+    btrim(regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g'))
+) STORED;
+
+-- Newer duplicates are moved to the trash to let the unique index be created.
+-- They can't be restored while the oldest movie exists.
+UPDATE movies SET deleted_at = NOW(), version = version + 1
+WHERE id IN (
+    SELECT id
+    FROM (
+        SELECT id, row_number() OVER (PARTITION BY title_key, year ORDER BY id) AS n
+        FROM movies
+        WHERE deleted_at IS NULL
+    ) d
+    WHERE n > 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS movies_title_key_year_idx ON movies (title_key, year) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    id bigint PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_movie_id_idx ON movie_redirects (movie_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS movie_titles (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    locale text NOT NULL,
+    title text NOT NULL,
+    PRIMARY KEY (movie_id, locale)
+);
+
+CREATE INDEX IF NOT EXISTS movie_titles_title_idx ON movie_titles USING GIN (to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS movie_titles_title_trgm_idx ON movie_titles USING GIN (title gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS movie_releases (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    country char(2) NOT NULL,
+    released_on date NOT NULL,
+    PRIMARY KEY (movie_id, country)
+);
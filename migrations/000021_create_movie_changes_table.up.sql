@@ -0,0 +1,54 @@
+CREATE TABLE IF NOT EXISTS movie_changes (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL,
+    action text NOT NULL,
+    version integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- Logs movies entering or leaving the catalog and versioned edits, so that
+-- trashed movies and aggregated ratings don't produce changes, and notifies
+-- listeners of the movie_changes channel with the change id.
+CREATE OR REPLACE FUNCTION log_movie_change() RETURNS trigger AS $$
+DECLARE
+    change_action text;
+    change_movie movies;
+    change_id bigint;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        change_movie := NEW;
+        IF NEW.deleted_at IS NULL THEN
+            change_action := 'created';
+        END IF;
+    ELSIF TG_OP = 'DELETE' THEN
+        change_movie := OLD;
+        IF OLD.deleted_at IS NULL THEN
+            change_action := 'deleted';
+        END IF;
+    ELSE
+        change_movie := NEW;
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            change_action := 'deleted';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            change_action := 'created';
+        ELSIF NEW.deleted_at IS NULL AND NEW.version <> OLD.version THEN
+            change_action := 'updated';
+        END IF;
+    END IF;
+
+    IF change_action IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO movie_changes (movie_id, action, version)
+    VALUES (change_movie.id, change_action, change_movie.version)
+    RETURNING id INTO change_id;
+
+    PERFORM pg_notify('movie_changes', change_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_log_change
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION log_movie_change();
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS movies_update_revision ON movies;
+DROP TRIGGER IF EXISTS movies_insert_revision ON movies;
+DROP FUNCTION IF EXISTS record_movie_revision();
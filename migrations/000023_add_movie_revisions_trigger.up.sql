@@ -0,0 +1,43 @@
+-- Records a revision along with every movie version in the same transaction.
+-- Writers attribute revisions by setting greenlight.user_id and may override
+-- the action derived from the change by setting greenlight.revision_action,
+-- both local to their transaction.
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+DECLARE
+    revision_action text := NULLIF(current_setting('greenlight.revision_action', true), '');
+BEGIN
+    IF revision_action IS NULL THEN
+        IF TG_OP = 'INSERT' THEN
+            revision_action := 'insert';
+        ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            revision_action := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            revision_action := 'restore';
+        ELSE
+            revision_action := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres)
+    VALUES (
+        NEW.id,
+        NEW.version,
+        revision_action,
+        NULLIF(current_setting('greenlight.user_id', true), '')::bigint,
+        NEW.title,
+        NEW.year,
+        NEW.runtime,
+        NEW.genres
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_insert_revision
+AFTER INSERT ON movies
+FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+CREATE TRIGGER movies_update_revision
+AFTER UPDATE ON movies
+FOR EACH ROW WHEN (NEW.version <> OLD.version) EXECUTE FUNCTION record_movie_revision();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movie_changes_xid_idx;
+ALTER TABLE movie_changes DROP COLUMN IF EXISTS xid;
@@ -0,0 +1,6 @@
+-- Id of the transaction which logged the change. Readers only return changes
+-- of transactions older than any still in progress, ordered by it, so that a
+-- change committed late can't be skipped by a reader which went past its id.
+ALTER TABLE movie_changes ADD COLUMN IF NOT EXISTS xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE INDEX IF NOT EXISTS movie_changes_xid_idx ON movie_changes (xid, id);
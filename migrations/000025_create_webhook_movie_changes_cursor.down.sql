@@ -0,0 +1 @@
+DROP TABLE IF EXISTS webhook_movie_changes_cursor;
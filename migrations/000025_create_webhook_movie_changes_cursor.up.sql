@@ -0,0 +1,11 @@
+-- Id of the movie change up to which webhook events were enqueued. The single
+-- row is moved along with the deliveries it enqueues, so that every change is
+-- published once however many processes are publishing.
+CREATE TABLE IF NOT EXISTS webhook_movie_changes_cursor (
+    id boolean PRIMARY KEY DEFAULT true CHECK (id),
+    change_id bigint NOT NULL
+);
+
+INSERT INTO webhook_movie_changes_cursor (change_id)
+SELECT COALESCE((SELECT id FROM movie_changes ORDER BY xid DESC, id DESC LIMIT 1), 0)
+ON CONFLICT DO NOTHING;
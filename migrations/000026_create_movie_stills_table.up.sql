@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS movie_stills (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    key text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_stills_movie_id_idx ON movie_stills (movie_id, id);